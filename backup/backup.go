@@ -30,36 +30,45 @@ import (
 func initializeFlags(cmd *cobra.Command) {
 	SetFlagDefaults(cmd.Flags())
 
-	_ = cmd.MarkFlagRequired(options.DBNAME)
-
 	cmdFlags = cmd.Flags()
 }
 
 func SetFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(options.BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written")
+	flagSet.String(options.CONFIG, "", "A YAML file containing values for any of the flags listed here, which are overridden by flags given on the command line")
 	flagSet.Int(options.COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Valid values are between 1 and 9.")
+	flagSet.Int(options.COPY_TIMEOUT, 0, "Fail the backup if the COPY of any table's data runs for longer than the specified number of minutes")
 	flagSet.Bool(options.DATA_ONLY, false, "Only back up data, do not back up metadata")
+	flagSet.Int(options.DATA_TIMEOUT, 0, "Fail the backup if backing up table data takes longer than the specified number of minutes")
 	flagSet.String(options.DBNAME, "", "The database to be backed up")
 	flagSet.Bool(options.DEBUG, false, "Print verbose and debug log messages")
+	flagSet.String(options.DELETE_BACKUP, "", "Delete the backup with the specified timestamp from the plugin destination and exit")
 	flagSet.StringArray(options.EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(options.EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas to be excluded from the backup")
 	flagSet.StringArray(options.EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
 	flagSet.String(options.EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be excluded from the backup")
 	flagSet.String(options.FROM_TIMESTAMP, "", "A timestamp to use to base the current incremental backup off")
 	flagSet.Bool("help", false, "Help for gpbackup")
+	flagSet.String(options.HOOK_CONFIG, "", "The configuration file listing hooks to run before and after phases of the backup")
+	flagSet.Int(options.INACTIVITY_TIMEOUT, 0, "Fail the backup if no table data is backed up for the specified number of minutes")
 	flagSet.StringArray(options.INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.String(options.INCLUDE_SCHEMA_FILE, "", "A file containing a list of schema(s) to be included in the backup")
 	flagSet.StringArray(options.INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
 	flagSet.String(options.INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be included in the backup")
 	flagSet.Bool(options.INCREMENTAL, false, "Only back up data for AO tables that have been modified since the last backup")
+	flagSet.Int(options.IO_NICE_LEVEL, -1, "The best-effort I/O scheduling priority, from 0 (highest) to 7 (lowest), with which to write data files on the segments")
 	flagSet.Int(options.JOBS, 1, "The number of parallel connections to use when backing up data")
+	flagSet.Bool(options.LIST_BACKUPS, false, "List the timestamps of the backups stored at the plugin destination and exit")
 	flagSet.Bool(options.LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	flagSet.String(options.MAX_BANDWIDTH, "", "The maximum rate, such as 500MB, at which all segments together may write data files, per second")
+	flagSet.String(options.MAX_BANDWIDTH_PER_HOST, "", "The maximum rate, such as 100MB, at which the segments on each host may write data files, per second")
+	flagSet.Bool(options.MATERIALIZE_EXTERNAL, false, "Back up the current contents of readable external tables, as is done for regular tables")
 	flagSet.Bool(options.METADATA_ONLY, false, "Only back up metadata, do not back up data")
 	flagSet.Bool(options.NO_COMPRESSION, false, "Disable compression of data files")
 	flagSet.String(options.PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(options.QUIET, false, "Suppress non-warning, non-error log messages")
-	flagSet.Bool(options.SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table")
+	flagSet.Bool(options.SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table, or to one file per job if --jobs is specified")
 	flagSet.Bool(options.VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(options.WITH_STATS, false, "Back up query plan statistics")
 }
@@ -75,6 +84,12 @@ func DoInit(cmd *cobra.Command) {
 }
 
 func DoFlagValidation(cmd *cobra.Command) {
+	err := options.ApplyConfigFile(cmd.Flags())
+	gplog.FatalOnError(err)
+	// Listing and deleting backups only reads the cluster configuration, which every database can provide
+	if !IsPluginBackupCommand() {
+		options.CheckRequiredFlags(cmd.Flags(), options.DBNAME)
+	}
 	validateFlagCombinations(cmd.Flags())
 	validateFlagValues()
 }
@@ -86,6 +101,14 @@ func DoSetup() {
 
 	utils.CheckGpexpandRunning(utils.BackupPreventedByGpexpandMessage)
 	timestamp := history.CurrentTimestamp()
+	// Saved for the on_failure hooks, which may run before globalFPInfo is initialized
+	backupTimestamp = timestamp
+	if MustGetFlagString(options.HOOK_CONFIG) != "" {
+		var err error
+		hookConfig, err = utils.ReadHookConfig(MustGetFlagString(options.HOOK_CONFIG))
+		gplog.FatalOnError(err)
+	}
+	hookConfig.RunHooks(utils.HOOK_BEFORE_SETUP, getHookEnvironment())
 	createBackupLockFile(timestamp)
 	initializeConnectionPool()
 
@@ -102,6 +125,8 @@ func DoSetup() {
 	globalCluster = cluster.NewCluster(segConfig)
 	segPrefix := filepath.GetSegPrefix(connectionPool)
 	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
+	err = utils.InitializeDataThrottle(globalCluster, MustGetFlagString(options.MAX_BANDWIDTH), MustGetFlagString(options.MAX_BANDWIDTH_PER_HOST), MustGetFlagInt(options.IO_NICE_LEVEL))
+	gplog.FatalOnError(err)
 	if MustGetFlagBool(options.METADATA_ONLY) {
 		_, err = globalCluster.ExecuteLocalCommand(fmt.Sprintf("mkdir -p %s", globalFPInfo.GetDirForContent(-1)))
 		gplog.FatalOnError(err)
@@ -132,6 +157,7 @@ func DoSetup() {
 		pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
 		pluginConfig.SetupPluginForBackup(globalCluster, globalFPInfo)
 	}
+	hookConfig.RunHooks(utils.HOOK_AFTER_SETUP, getHookEnvironment())
 }
 
 func DoBackup() {
@@ -172,8 +198,13 @@ func DoBackup() {
 			tableOnlyBackup = false
 			backupGlobal(metadataFile)
 		}
+		// Post-data metadata is backed up before any data, so its hooks also run before the data hooks
+		hookConfig.RunHooks(utils.HOOK_BEFORE_PREDATA, getHookEnvironment())
 		backupPredata(metadataFile, metadataTables, tableOnlyBackup)
+		hookConfig.RunHooks(utils.HOOK_AFTER_PREDATA, getHookEnvironment())
+		hookConfig.RunHooks(utils.HOOK_BEFORE_POSTDATA, getHookEnvironment())
 		backupPostdata(metadataFile)
+		hookConfig.RunHooks(utils.HOOK_AFTER_POSTDATA, getHookEnvironment())
 	}
 
 	/*
@@ -194,7 +225,9 @@ func DoBackup() {
 		}
 
 		backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
+		hookConfig.RunHooks(utils.HOOK_BEFORE_DATA, getHookEnvironment())
 		backupData(backupSetTables)
+		hookConfig.RunHooks(utils.HOOK_AFTER_DATA, getHookEnvironment())
 	}
 
 	if MustGetFlagBool(options.WITH_STATS) {
@@ -333,14 +366,26 @@ func backupData(tables []Table) {
 			}
 		}
 		utils.WriteOidListToSegments(oidList, globalCluster, globalFPInfo)
-		utils.CreateFirstSegmentPipeOnAllHosts(oidList[0], globalCluster, globalFPInfo)
+		// Each connection writes to its own data file on each segment
+		oidsByFile := utils.AssignOidsToHelperJobs(getDataBackupOids(tables), connectionPool.NumConns)
+		firstOids := make([]string, len(oidsByFile))
+		for fileIndex, fileOids := range oidsByFile {
+			firstOids[fileIndex] = fmt.Sprintf("%d", fileOids[0])
+		}
+		backupReport.DataFilesPerSegment = len(oidsByFile)
+		// gpbackup_helper writes each table in its own frame, so that restores can read tables by range
+		backupReport.FramedDataFiles = true
+		if len(oidsByFile) > 1 {
+			backupReport.DataFormatVersion = history.DATA_FORMAT_MULTIPLE_DATA_FILES
+		}
+		utils.CreateFirstSegmentPipesOnAllHosts(firstOids, globalCluster, globalFPInfo)
 		compressStr := fmt.Sprintf(" --compression-level %d", MustGetFlagInt(options.COMPRESSION_LEVEL))
 		if MustGetFlagBool(options.NO_COMPRESSION) {
 			compressStr = " --compression-level 0"
 		}
 		// Do not pass through the --on-error-continue flag because it does not apply to gpbackup
 		utils.StartGpbackupHelpers(globalCluster, globalFPInfo, "--backup-agent",
-			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false)
+			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false, len(oidsByFile))
 	}
 	gplog.Info("Writing data to file")
 	rowsCopiedMaps := backupDataForAllTables(tables)
@@ -396,10 +441,13 @@ func backupStatistics(tables []Table) {
 func DoTeardown() {
 	backupFailed := false
 	defer func() {
+		if backupFailed {
+			hookConfig.RunHooks(utils.HOOK_ON_FAILURE, getHookEnvironment())
+		}
 		DoCleanup(backupFailed)
 
 		errorCode := gplog.GetErrorCode()
-		if errorCode == 0 {
+		if errorCode == 0 && !IsPluginBackupCommand() {
 			gplog.Info("Backup completed successfully")
 		}
 		os.Exit(errorCode)
@@ -455,6 +503,7 @@ func DoTeardown() {
 			endtime, _ := time.ParseInLocation("20060102150405", backupReport.BackupConfig.EndTime, operating.System.Local)
 			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, endtime, objectCounts, errMsg)
 			report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup")
+			report.SendNotifications(globalFPInfo.Timestamp, reportFilename, "gpbackup")
 			if pluginConfig != nil {
 				err := pluginConfig.BackupFile(configFilename)
 				if err != nil {
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -43,7 +44,7 @@ func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64)
 				}
 			}
 			attributes := ConstructTableAttributesList(table.ColumnDefs)
-			globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName)
+			globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName, table.IsExternal)
 		}
 	}
 }
@@ -56,7 +57,9 @@ type BackupProgressCounters struct {
 
 func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
 	checkPipeExistsCommand := ""
+	ioNiceCommand := ""
 	customPipeThroughCommand := utils.GetPipeThroughProgram().OutputCommand
+	throttleCommand := ""
 	sendToDestinationCommand := ">"
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		/*
@@ -67,15 +70,43 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 		 */
 		checkPipeExistsCommand = fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found %s\">&2; exit 1)) && ", destinationToWrite, destinationToWrite)
 		customPipeThroughCommand = "cat -"
-	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+	} else {
+		ioNiceCommand, throttleCommand = utils.GetPipelineThrottleCommands(connectionPool.NumConns, globalFPInfo)
+		if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+			sendToDestinationCommand = fmt.Sprintf("| %s", pluginConfig.GetPluginCommand("backup_data"))
+		}
 	}
 
-	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+	copyCommand := fmt.Sprintf("PROGRAM '%s%s%s%s %s %s'", checkPipeExistsCommand, ioNiceCommand, customPipeThroughCommand, throttleCommand, sendToDestinationCommand, destinationToWrite)
 
-	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), copyCommand, tableDelim)
+	tableToCopy := table.FQN()
+	if table.IsExternal {
+		/*
+		 * External tables cannot be copied out directly, so their current
+		 * contents are first materialized into a temporary table.
+		 */
+		tableToCopy = fmt.Sprintf("gpbackup_materialized_%d", table.Oid)
+		materializeQuery := fmt.Sprintf("CREATE TEMP TABLE %s AS SELECT * FROM %s DISTRIBUTED RANDOMLY;", tableToCopy, table.FQN())
+		gplog.Verbose(materializeQuery)
+		_, err := connectionPool.Exec(materializeQuery, connNum)
+		if err != nil {
+			return 0, err
+		}
+		defer func() {
+			/*
+			 * If the COPY failed, the transaction is aborted and the DROP fails
+			 * as well, but the temporary table is gone on rollback anyway and the
+			 * COPY error is the one that should be reported.
+			 */
+			_, _ = connectionPool.Exec(fmt.Sprintf("DROP TABLE %s;", tableToCopy), connNum)
+		}()
+	}
+
+	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", tableToCopy, copyCommand, tableDelim)
 	gplog.Verbose(query)
-	result, err := connectionPool.Exec(query, connNum)
+	copyContext, finishCopy := copyWatchdog.StartCopy(connNum, table.FQN())
+	result, err := connectionPool.ExecContext(copyContext, query, connNum)
+	err = finishCopy(err)
 	if err != nil {
 		return 0, err
 	}
@@ -123,6 +154,15 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables)) - numExtOrForeignTables}
 	counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
 	counters.ProgressBar.Start()
+	copyWatchdog = utils.NewCopyWatchdogFromMinutes(MustGetFlagInt(options.COPY_TIMEOUT), MustGetFlagInt(options.DATA_TIMEOUT), MustGetFlagInt(options.INACTIVITY_TIMEOUT))
+	var statusMonitor *utils.HelperStatusMonitor
+	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		copyWatchdog.StopHelpersOnTimeout(globalCluster, globalFPInfo, "backup")
+		statusMonitor = utils.NewHelperStatusMonitor(globalCluster, globalFPInfo, counters.ProgressBar, copyWatchdog.RecordActivity)
+		statusMonitor.Start()
+	}
+	copyWatchdog.Start()
+	startTime := time.Now()
 	rowsCopiedMaps := make([]map[uint32]int64, connectionPool.NumConns)
 	/*
 	 * We break when an interrupt is received and rely on
@@ -130,14 +170,19 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	 * in progress if they don't finish on their own.
 	 */
 	tasks := make(chan Table, len(tables))
+	connTasks := make([]chan Table, connectionPool.NumConns)
 	var workerPool sync.WaitGroup
 	var copyErr error
 	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
 		rowsCopiedMaps[connNum] = make(map[uint32]int64)
+		connTasks[connNum] = tasks
+		if MustGetFlagBool(options.SINGLE_DATA_FILE) {
+			connTasks[connNum] = make(chan Table, len(tables))
+		}
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
-			for table := range tasks {
+			for table := range connTasks[whichConn] {
 				if wasTerminated || copyErr != nil {
 					counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
@@ -149,14 +194,25 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 			}
 		}(connNum)
 	}
-	for _, table := range tables {
-		tasks <- table
+	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		queueTablesForDataFiles(tables, connTasks)
+	} else {
+		for _, table := range tables {
+			tasks <- table
+		}
+	}
+	for _, connTask := range connTasks {
+		if connTask != tasks {
+			close(connTask)
+		}
 	}
 	close(tasks)
 	workerPool.Wait()
+	copyWatchdog.Stop()
 
 	var agentErr error
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		statusMonitor.Stop()
 		agentErr = utils.CheckAgentErrorsOnSegments(globalCluster, globalFPInfo)
 	}
 
@@ -169,11 +225,44 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 		gplog.Fatal(agentErr, "")
 	}
 
+	utils.RecordThrottledDataTransfer(globalCluster, globalFPInfo, MustGetFlagBool(options.SINGLE_DATA_FILE), time.Since(startTime))
 	counters.ProgressBar.Finish()
 	printDataBackupWarnings(numExtOrForeignTables)
 	return rowsCopiedMaps
 }
 
+func getDataBackupOids(tables []Table) []int {
+	oids := make([]int, 0, len(tables))
+	for _, table := range tables {
+		if !table.SkipDataBackup() {
+			oids = append(oids, int(table.Oid))
+		}
+	}
+	return oids
+}
+
+/*
+ * In a single-data-file backup, each connection copies the tables for one of
+ * the data files on each segment, in the order that gpbackup_helper reads
+ * them, as a COPY cannot start until the helper has created its pipe.
+ * Tables whose data is not backed up are given to the first connection.
+ */
+func queueTablesForDataFiles(tables []Table, connTasks []chan Table) {
+	tablesByOid := make(map[int]Table, len(tables))
+	for _, table := range tables {
+		if table.SkipDataBackup() {
+			connTasks[0] <- table
+		} else {
+			tablesByOid[int(table.Oid)] = table
+		}
+	}
+	for fileIndex, fileOids := range utils.AssignOidsToHelperJobs(getDataBackupOids(tables), len(connTasks)) {
+		for _, oid := range fileOids {
+			connTasks[fileIndex] <- tablesByOid[oid]
+		}
+	}
+}
+
 func printDataBackupWarnings(numExtTables int64) {
 	if numExtTables > 0 {
 		gplog.Info("Skipped data backup of %d external/foreign table(s).", numExtTables)
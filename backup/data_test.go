@@ -5,12 +5,15 @@ import (
 	"regexp"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
 
 	. "github.com/onsi/ginkgo"
@@ -63,6 +66,24 @@ var _ = Describe("backup/data tests", func() {
 			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
 			Expect(tocfile.DataEntries).To(BeNil())
 		})
+		It("adds an entry marked as external for a materialized external table to the TOC", func() {
+			_ = cmdFlags.Set(options.MATERIALIZE_EXTERNAL, "true")
+			defer cmdFlags.Set(options.MATERIALIZE_EXTERNAL, "false")
+			table.IsExternal = true
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", IsExternal: true}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
+		It("does not add an entry for a writable external table to the TOC when materializing external tables", func() {
+			_ = cmdFlags.Set(options.MATERIALIZE_EXTERNAL, "true")
+			defer cmdFlags.Set(options.MATERIALIZE_EXTERNAL, "false")
+			table.IsExternal = true
+			table.ExtTableDef.Writable = true
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			Expect(tocfile.DataEntries).To(BeNil())
+		})
 		It("does not add an entry for a foreign table to the TOC", func() {
 			foreignDef := backup.ForeignTableDefinition{Oid: 23, Options: "", Server: "fs"}
 			table.ForeignDef = foreignDef
@@ -96,6 +117,35 @@ var _ = Describe("backup/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will back up an external table by first materializing it into a temporary table", func() {
+			externalTable := testTable
+			externalTable.IsExternal = true
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
+			mock.ExpectExec(regexp.QuoteMeta("CREATE TEMP TABLE gpbackup_materialized_3456 AS SELECT * FROM public.foo DISTRIBUTED RANDOMLY;")).WillReturnResult(sqlmock.NewResult(10, 10))
+			execStr := regexp.QuoteMeta("COPY gpbackup_materialized_3456 TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			mock.ExpectExec(regexp.QuoteMeta("DROP TABLE gpbackup_materialized_3456;")).WillReturnResult(sqlmock.NewResult(0, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			_, err := backup.CopyTableOut(connectionPool, externalTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("returns the COPY error for a materialized external table if the temporary table cannot be dropped", func() {
+			externalTable := testTable
+			externalTable.IsExternal = true
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
+			mock.ExpectExec(regexp.QuoteMeta("CREATE TEMP TABLE gpbackup_materialized_3456 AS SELECT * FROM public.foo DISTRIBUTED RANDOMLY;")).WillReturnResult(sqlmock.NewResult(10, 10))
+			mock.ExpectExec("COPY gpbackup_materialized_3456 TO .*").WillReturnError(errors.New("copy failed"))
+			mock.ExpectExec(regexp.QuoteMeta("DROP TABLE gpbackup_materialized_3456;")).WillReturnError(errors.New("current transaction is aborted"))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			_, err := backup.CopyTableOut(connectionPool, externalTable, filename, defaultConnNum)
+
+			Expect(err).To(MatchError("copy failed"))
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
 		It("will back up a table to its own file without compression", func() {
 			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
 			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
@@ -119,6 +169,24 @@ var _ = Describe("backup/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will back up a table to its own file with compression at a limited rate and I/O priority", func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: 7})
+			backup.SetFPInfo(filepath.FilePathInfo{Timestamp: "20170101010101", PID: 1234})
+			defer func() {
+				operating.System = operating.InitializeSystemFunctions()
+				utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+				backup.SetFPInfo(filepath.FilePathInfo{})
+			}()
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -8", InputCommand: "gzip -d -c", Extension: ".gz"})
+			execStr := regexp.QuoteMeta("COPY public.foo TO PROGRAM 'ionice -c 2 -n 7 -p $$ > /dev/null 2>&1; gzip -c -8 | /usr/local/gpdb/bin/gpbackup_helper --throttle --max-bandwidth 1048576 --byte-count-file <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_bytes_1234 > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+
+			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 		It("will back up a table to a single file", func() {
 			_ = cmdFlags.Set(options.SINGLE_DATA_FILE, "true")
 			execStr := regexp.QuoteMeta(`COPY public.foo TO PROGRAM '(test -p "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456" || (echo "Pipe not found <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456">&2; exit 1)) && cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;`)
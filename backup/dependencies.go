@@ -2,6 +2,7 @@ package backup
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -138,6 +139,42 @@ func TopologicalSort(slice []Sortable, dependencies DependencyMap) []Sortable {
 
 type DependencyMap map[UniqueID]map[UniqueID]bool
 
+/*
+ * Records the dependencies of each sorted object in the first TOC entry for
+ * that object, so that gprestore can order and filter metadata by dependency.
+ * Dependencies on schemas and on the tables referenced by post-data objects are
+ * implicit in the TOC and are not recorded here.
+ */
+func AddDependenciesToTOC(tocfile *toc.TOC, objects []Sortable, dependencies DependencyMap) {
+	objectKeys := make(map[UniqueID]toc.ObjectKey)
+	for _, object := range objects {
+		if tocObject, ok := object.(toc.TOCObject); ok {
+			_, entry := tocObject.GetMetadataEntry()
+			objectKeys[object.GetUniqueID()] = entry.Key()
+		}
+	}
+	objectDependencies := make(map[toc.ObjectKey][]toc.ObjectKey)
+	for uniqueID, objectKey := range objectKeys {
+		for dependency := range dependencies[uniqueID] {
+			if dependencyKey, ok := objectKeys[dependency]; ok {
+				objectDependencies[objectKey] = append(objectDependencies[objectKey], dependencyKey)
+			}
+		}
+	}
+	for i, entry := range tocfile.PredataEntries {
+		entryDependencies, ok := objectDependencies[entry.Key()]
+		if !ok {
+			continue
+		}
+		sort.Slice(entryDependencies, func(i int, j int) bool {
+			return entryDependencies[i].Less(entryDependencies[j])
+		})
+		tocfile.PredataEntries[i].Dependencies = entryDependencies
+		delete(objectDependencies, entry.Key())
+	}
+	tocfile.HasDependencies = true
+}
+
 type UniqueID struct {
 	ClassID uint32
 	Oid     uint32
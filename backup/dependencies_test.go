@@ -4,6 +4,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/toc"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -224,4 +225,30 @@ COMMENT ON PROTOCOL ext_protocol IS 'protocol';
 `)
 		})
 	})
+	Describe("AddDependenciesToTOC", func() {
+		It("records the dependencies of each object in its TOC entry", func() {
+			view1 := backup.View{Oid: 1, Schema: "public", Name: "view1"}
+			view2 := backup.View{Oid: 2, Schema: "public", Name: "view2"}
+			view3 := backup.View{Oid: 3, Schema: "public", Name: "view3"}
+			for _, view := range []backup.View{view1, view2, view3} {
+				section, entry := view.GetMetadataEntry()
+				tocfile.AddMetadataEntry(section, entry, 0, 0)
+			}
+			depMap[backup.UniqueID{ClassID: backup.PG_CLASS_OID, Oid: 3}] = map[backup.UniqueID]bool{
+				{ClassID: backup.PG_CLASS_OID, Oid: 2}: true,
+				{ClassID: backup.PG_CLASS_OID, Oid: 1}: true,
+				{ClassID: backup.PG_PROC_OID, Oid: 4}:  true,
+			}
+
+			backup.AddDependenciesToTOC(tocfile, []backup.Sortable{view1, view2, view3}, depMap)
+
+			Expect(tocfile.PredataEntries[0].Dependencies).To(BeEmpty())
+			Expect(tocfile.PredataEntries[1].Dependencies).To(BeEmpty())
+			Expect(tocfile.HasDependencies).To(BeTrue())
+			Expect(tocfile.PredataEntries[2].Dependencies).To(Equal([]toc.ObjectKey{
+				{Schema: "public", Name: "view1", ObjectType: "VIEW"},
+				{Schema: "public", Name: "view2", ObjectType: "VIEW"},
+			}))
+		})
+	})
 })
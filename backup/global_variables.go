@@ -25,7 +25,9 @@ import (
  */
 var (
 	backupReport         *report.Report
+	backupTimestamp      string
 	connectionPool       *dbconn.DBConn
+	copyWatchdog         = utils.NewCopyWatchdog(0, 0, 0)
 	queryContext         context.Context
 	queryCancelFunc      context.CancelFunc
 	globalCluster        *cluster.Cluster
@@ -33,6 +35,7 @@ var (
 	globalTOC            *toc.TOC
 	objectCounts         map[string]int
 	pluginConfig         *utils.PluginConfig
+	hookConfig           *utils.HookConfig
 	version              string
 	wasTerminated        bool
 	backupLockFile       lockfile.Lockfile
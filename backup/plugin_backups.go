@@ -0,0 +1,95 @@
+package backup
+
+/*
+ * This file contains functions for listing and deleting the backups stored at
+ * a plugin destination, which run in place of a backup when --list-backups or
+ * --delete-backup is given.
+ */
+
+import (
+	"os"
+	path "path/filepath"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func IsPluginBackupCommand() bool {
+	return MustGetFlagBool(options.LIST_BACKUPS) || MustGetFlagString(options.DELETE_BACKUP) != ""
+}
+
+func DoPluginBackupCommand() {
+	SetLoggerVerbosity()
+	gplog.Verbose("Backup Command: %s", os.Args)
+
+	dbName := MustGetFlagString(options.DBNAME)
+	if dbName == "" {
+		dbName = "postgres"
+	}
+	connectionPool = dbconn.NewDBConnFromEnvironment(dbName)
+	connectionPool.MustConnect(1)
+	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
+	globalCluster = cluster.NewCluster(segConfig)
+	// The timestamp is left unset so that no report is written for this command
+	fpInfo := filepath.NewFilePathInfo(globalCluster, "", "", filepath.GetSegPrefix(connectionPool))
+	historyFilePath := fpInfo.GetBackupHistoryFilePath()
+
+	var err error
+	pluginConfig, err = utils.ReadPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG))
+	gplog.FatalOnError(err)
+	configFilename := path.Base(pluginConfig.ConfigPath)
+	configDirname := path.Dir(pluginConfig.ConfigPath)
+	pluginConfig.ConfigPath = path.Join(configDirname, history.CurrentTimestamp()+"_"+configFilename)
+	pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
+	defer pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+
+	if MustGetFlagBool(options.LIST_BACKUPS) {
+		listPluginBackups(globalCluster, historyFilePath)
+	} else {
+		deletePluginBackup(globalCluster, historyFilePath, MustGetFlagString(options.DELETE_BACKUP))
+	}
+}
+
+func listPluginBackups(c *cluster.Cluster, historyFilePath string) {
+	timestamps, err := pluginConfig.ListBackups(c)
+	gplog.FatalOnError(err)
+
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilePath) {
+		backupHistory, err = history.NewHistory(historyFilePath)
+		gplog.FatalOnError(err)
+	}
+
+	gplog.Info("Found %d backup(s) at plugin destination", len(timestamps))
+	for _, timestamp := range timestamps {
+		backupConfig := backupHistory.FindBackupConfig(timestamp)
+		if backupConfig == nil {
+			gplog.Info("%s: not found in history file", timestamp)
+		} else if backupConfig.DateDeleted != "" {
+			gplog.Info("%s: database %s, marked as deleted on %s in history file", timestamp, backupConfig.DatabaseName, backupConfig.DateDeleted)
+		} else {
+			gplog.Info("%s: database %s", timestamp, backupConfig.DatabaseName)
+		}
+	}
+}
+
+func deletePluginBackup(c *cluster.Cluster, historyFilePath string, timestamp string) {
+	err := pluginConfig.DeleteBackup(c, timestamp)
+	gplog.FatalOnError(err)
+	gplog.Info("Deleted backup %s from plugin destination", timestamp)
+
+	if !iohelper.FileExistsAndIsReadable(historyFilePath) {
+		gplog.Warn("History file %s does not exist, so the deletion could not be recorded", historyFilePath)
+		return
+	}
+	err = history.MarkBackupDeleted(historyFilePath, timestamp)
+	if err != nil {
+		gplog.Warn("%v", err)
+	}
+}
@@ -23,9 +23,21 @@ type Table struct {
 
 func (t Table) SkipDataBackup() bool {
 	def := t.TableDefinition
+	if def.IsExternal && MustGetFlagBool(options.MATERIALIZE_EXTERNAL) && t.CanMaterializeData() {
+		return false
+	}
 	return def.IsExternal || (def.ForeignDef != ForeignTableDefinition{})
 }
 
+/*
+ * Readable external tables can have their contents backed up, except for
+ * external partitions, whose data could not be restored once they have been
+ * exchanged into their parent table.
+ */
+func (t Table) CanMaterializeData() bool {
+	return t.IsExternal && !t.ExtTableDef.Writable && t.PartitionLevelInfo.Level != "l"
+}
+
 func (t Table) GetMetadataEntry() (string, toc.MetadataEntry) {
 	objectType := "TABLE"
 	if (t.ForeignDef != ForeignTableDefinition{}) {
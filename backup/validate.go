@@ -104,8 +104,10 @@ func validateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE)
 	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE)
 	options.CheckExclusiveFlags(flags, options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.LEAF_PARTITION_DATA)
-	options.CheckExclusiveFlags(flags, options.JOBS, options.METADATA_ONLY, options.SINGLE_DATA_FILE)
+	options.CheckExclusiveFlags(flags, options.JOBS, options.METADATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.SINGLE_DATA_FILE)
 	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.LEAF_PARTITION_DATA)
+	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.MATERIALIZE_EXTERNAL)
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_LEVEL)
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !MustGetFlagBool(options.INCREMENTAL) {
@@ -114,6 +116,10 @@ func validateFlagCombinations(flags *pflag.FlagSet) {
 	if MustGetFlagBool(options.INCREMENTAL) && !MustGetFlagBool(options.LEAF_PARTITION_DATA) {
 		gplog.Fatal(errors.Errorf("--leaf-partition-data must be specified with --incremental"), "")
 	}
+	options.CheckExclusiveFlags(flags, options.LIST_BACKUPS, options.DELETE_BACKUP)
+	if IsPluginBackupCommand() && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		gplog.Fatal(errors.Errorf("--list-backups and --delete-backup must be specified with --plugin-config"), "")
+	}
 }
 
 func validateFlagValues() {
@@ -121,12 +127,28 @@ func validateFlagValues() {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.HOOK_CONFIG))
+	gplog.FatalOnError(err)
 	err = utils.ValidateCompressionLevel(MustGetFlagInt(options.COMPRESSION_LEVEL))
 	gplog.FatalOnError(err)
+	for _, timeoutFlag := range []string{options.COPY_TIMEOUT, options.DATA_TIMEOUT, options.INACTIVITY_TIMEOUT} {
+		err = utils.ValidateTimeout(timeoutFlag, MustGetFlagInt(timeoutFlag))
+		gplog.FatalOnError(err)
+	}
+	for _, bandwidthFlag := range []string{options.MAX_BANDWIDTH, options.MAX_BANDWIDTH_PER_HOST} {
+		_, err = utils.ParseBandwidth(MustGetFlagString(bandwidthFlag))
+		gplog.FatalOnError(err)
+	}
+	err = utils.ValidateIONiceLevel(MustGetFlagInt(options.IO_NICE_LEVEL))
+	gplog.FatalOnError(err)
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.FROM_TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
 			MustGetFlagString(options.FROM_TIMESTAMP)), "")
 	}
+	if MustGetFlagString(options.DELETE_BACKUP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.DELETE_BACKUP)) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
+			MustGetFlagString(options.DELETE_BACKUP)), "")
+	}
 }
 
 func validateFromTimestamp(fromTimestamp string) {
@@ -35,6 +35,10 @@ func SetLoggerVerbosity() {
 	}
 }
 
+func getHookEnvironment() utils.HookEnvironment {
+	return utils.HookEnvironment{Utility: "gpbackup", Timestamp: backupTimestamp, DBName: MustGetFlagString(options.DBNAME)}
+}
+
 func initializeConnectionPool() {
 	connectionPool = dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
 	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
@@ -80,6 +84,7 @@ func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plug
 		DatabaseName:          dbName,
 		DatabaseVersion:       dbVersion,
 		DataOnly:              MustGetFlagBool(options.DATA_ONLY),
+		EffectiveFlags:        options.GetEffectiveFlags(cmdFlags),
 		ExcludeRelations:      MustGetFlagStringArray(options.EXCLUDE_RELATION),
 		ExcludeSchemaFiltered: len(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)) > 0,
 		ExcludeSchemas:        MustGetFlagStringArray(options.EXCLUDE_SCHEMA),
@@ -103,7 +108,9 @@ func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plug
 func initializeBackupReport(opts options.Options) {
 	escapedDBName := dbconn.MustSelectString(connectionPool, fmt.Sprintf("select quote_ident(datname) AS string FROM pg_database where datname='%s'", utils.EscapeSingleQuotes(connectionPool.DBName)))
 	plugin := ""
-	if pluginConfig != nil {
+	if pluginConfig != nil && pluginConfig.UsesStorageBackend() {
+		plugin = fmt.Sprintf("%s storage backend", pluginConfig.Backend)
+	} else if pluginConfig != nil {
 		plugin = pluginConfig.ExecutablePath
 	}
 	config := NewBackupConfig(escapedDBName, connectionPool.Version.VersionString, version,
@@ -518,6 +525,7 @@ func backupDependentObjects(metadataFile *utils.FileWithByteCount, tables []Tabl
 	sortedSlice := TopologicalSort(sortables, relevantDeps)
 
 	PrintDependentObjectStatements(metadataFile, globalTOC, sortedSlice, filteredMetadata, constraints, funcInfoMap)
+	AddDependenciesToTOC(globalTOC, sortedSlice, relevantDeps)
 	extPartInfo, partInfoMap := GetExternalPartitionInfo(connectionPool)
 	if len(extPartInfo) > 0 {
 		gplog.Verbose("Writing EXCHANGE PARTITION statements to metadata file")
@@ -96,6 +96,23 @@ func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid
 	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath)
 }
 
+/*
+ * Single-data-file backups taken with multiple jobs write several data files
+ * per segment.  The first keeps the name of the only data file in other
+ * single-data-file backups, and the rest have the file index appended.
+ */
+func GetSegmentDataFilePath(dataFile string, fileIndex int) string {
+	if fileIndex == 0 {
+		return dataFile
+	}
+	dir, filename := path.Split(dataFile)
+	extension := ""
+	if extensionIndex := strings.Index(filename, "."); extensionIndex != -1 {
+		filename, extension = filename[:extensionIndex], filename[extensionIndex:]
+	}
+	return fmt.Sprintf("%s%s_part%d%s", dir, filename, fileIndex, extension)
+}
+
 var metadataFilenameMap = map[string]string{
 	"config":                "config.yaml",
 	"metadata":              "metadata.sql",
@@ -105,6 +122,7 @@ var metadataFilenameMap = map[string]string{
 	"plugin_config":         "plugin_config.yaml",
 	"error_tables_metadata": "error_tables_metadata",
 	"error_tables_data":     "error_tables_data",
+	"postdata_timings":      "postdata_timings.csv",
 }
 
 func (backupFPInfo *FilePathInfo) GetBackupFilePath(filetype string) string {
@@ -148,6 +166,10 @@ func (backupFPInfo *FilePathInfo) GetErrorTablesDataFilePath(restoreTimestamp st
 	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "error_tables_data")
 }
 
+func (backupFPInfo *FilePathInfo) GetPostdataTimingsFilePath(restoreTimestamp string) string {
+	return backupFPInfo.GetRestoreFilePath(restoreTimestamp, "postdata_timings")
+}
+
 func (backupFPInfo *FilePathInfo) GetConfigFilePath() string {
 	return backupFPInfo.GetBackupFilePath("config")
 }
@@ -161,7 +183,12 @@ func (backupFPInfo *FilePathInfo) GetPluginConfigPath() string {
 }
 
 func (backupFPInfo *FilePathInfo) GetSegmentHelperFilePath(contentID int, suffix string) string {
-	return path.Join(backupFPInfo.SegDirMap[contentID], fmt.Sprintf("gpbackup_%d_%s_%s_%d", contentID, backupFPInfo.Timestamp, suffix, backupFPInfo.PID))
+	templateFilePath := backupFPInfo.GetSegmentHelperFilePathForCopyCommand(suffix)
+	return backupFPInfo.replaceCopyFormatStringsInPath(templateFilePath, contentID)
+}
+
+func (backupFPInfo *FilePathInfo) GetSegmentHelperFilePathForCopyCommand(suffix string) string {
+	return path.Join("<SEG_DATA_DIR>", fmt.Sprintf("gpbackup_<SEGID>_%s_%s_%d", backupFPInfo.Timestamp, suffix, backupFPInfo.PID))
 }
 
 func (backupFPInfo *FilePathInfo) GetHelperLogPath() string {
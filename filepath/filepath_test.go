@@ -121,6 +121,24 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetTableBackupFilePath(-1, 1234, "", true)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101"))
 		})
 	})
+	Describe("GetSegmentDataFilePath", func() {
+		It("returns the single data file path for the first data file", func() {
+			Expect(GetSegmentDataFilePath("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101.gz", 0)).To(Equal("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101.gz"))
+		})
+		It("appends the file index before the extension for other data files", func() {
+			Expect(GetSegmentDataFilePath("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101.gz", 2)).To(Equal("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_part2.gz"))
+			Expect(GetSegmentDataFilePath("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101", 1)).To(Equal("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_part1"))
+		})
+	})
+	Describe("GetSegmentHelperFilePath", func() {
+		It("returns the same path as the copy command path once the segment is substituted", func() {
+			c.Segments[0] = cluster.SegConfig{DataDir: segDirOne}
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			fpInfo.PID = 1234
+			Expect(fpInfo.GetSegmentHelperFilePathForCopyCommand("bytes")).To(Equal("<SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_bytes_1234"))
+			Expect(fpInfo.GetSegmentHelperFilePath(0, "bytes")).To(Equal("/data/gpseg0/gpbackup_0_20170101010101_bytes_1234"))
+		})
+	})
 	Describe("ParseSegPrefix", func() {
 		AfterEach(func() {
 			operating.System.Glob = path.Glob
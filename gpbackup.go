@@ -19,6 +19,10 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			defer DoTeardown()
 			DoFlagValidation(cmd)
+			if IsPluginBackupCommand() {
+				DoPluginBackupCommand()
+				return
+			}
 			DoSetup()
 			DoBackup()
 		}}
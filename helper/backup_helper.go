@@ -8,7 +8,9 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
@@ -19,23 +21,67 @@ import (
  */
 
 func doBackupAgent() error {
+	oidList, err := getOidListFromFile()
+	if err != nil {
+		return err
+	}
+
+	/*
+	 * Each data file has its own chain of pipes, so that the tables in
+	 * different data files can be backed up concurrently.
+	 */
+	oidsByFile := utils.AssignOidsToHelperJobs(oidList, *jobs)
+	stopStatusWriter := startStatusWriter(len(oidList))
+	fileEntries := make([]map[uint]toc.SegmentDataEntry, len(oidsByFile))
+	fileErrors := make([]error, len(oidsByFile))
+	var fileWaitGroup sync.WaitGroup
+	for fileIndex, fileOids := range oidsByFile {
+		fileWaitGroup.Add(1)
+		go func(fileIndex int, fileOids []int) {
+			defer fileWaitGroup.Done()
+			fileEntries[fileIndex], fileErrors[fileIndex] = backupDataFile(fileIndex, fileOids)
+		}(fileIndex, fileOids)
+	}
+	fileWaitGroup.Wait()
+	stopStatusWriter()
+
+	tocfile := &toc.SegmentTOC{Framed: true}
+	tocfile.DataEntries = make(map[uint]toc.SegmentDataEntry)
+	for fileIndex := range oidsByFile {
+		if fileErrors[fileIndex] != nil {
+			return fileErrors[fileIndex]
+		}
+		for oid, entry := range fileEntries[fileIndex] {
+			tocfile.DataEntries[oid] = entry
+		}
+	}
+	err = tocfile.WriteToFileAndMakeReadOnly(*tocFile)
+	if err != nil {
+		return err
+	}
+	log("Finished writing segment TOC")
+	return nil
+}
+
+func backupDataFile(fileIndex int, oidList []int) (map[uint]toc.SegmentDataEntry, error) {
 	var lastRead uint64
+	var lastWritten uint64
 	var (
 		finalWriter io.Writer
 		gzipWriter  *gzip.Writer
 		bufIoWriter *bufio.Writer
+		fileWriter  *byteCountingWriter
 		writeHandle io.WriteCloser
 		writeCmd    *exec.Cmd
 	)
-	tocfile := &toc.SegmentTOC{}
-	tocfile.DataEntries = make(map[uint]toc.SegmentDataEntry)
-
-	oidList, err := getOidListFromFile()
-	if err != nil {
-		return err
+	entries := make(map[uint]toc.SegmentDataEntry)
+	fileSuffix := ""
+	if *jobs > 1 {
+		fileSuffix = fmt.Sprintf(" to data file %d", fileIndex)
 	}
 
-	currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
+	currentPipe := fmt.Sprintf("%s_%d", *pipeFile, oidList[0])
+	trackPipe(currentPipe)
 	/*
 	 * It is important that we create the reader before creating the writer
 	 * so that we establish a connection to the first pipe (created by gpbackup)
@@ -43,59 +89,68 @@ func doBackupAgent() error {
 	 */
 	for i, oid := range oidList {
 		if wasTerminated {
-			return errors.New("Terminated due to user request")
+			return nil, errors.New("Terminated due to user request")
 		}
+		nextPipe := ""
 		if i < len(oidList)-1 {
 			log(fmt.Sprintf("Creating pipe for oid %d\n", oidList[i+1]))
 			nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
 			err := createPipe(nextPipe)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
 		log(fmt.Sprintf("Opening pipe for oid %d\n", oid))
 		reader, readHandle, err := getBackupPipeReader(currentPipe)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		if i == 0 {
-			finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, err = getBackupPipeWriter(*compressionLevel)
+			finalWriter, gzipWriter, bufIoWriter, fileWriter, writeHandle, writeCmd, err = getBackupPipeWriter(filepath.GetSegmentDataFilePath(*dataFile, fileIndex), *compressionLevel)
 			if err != nil {
-				return err
+				return nil, err
 			}
 		}
 
-		log(fmt.Sprintf("Backing up table with oid %d\n", oid))
-		numBytes, err := io.Copy(finalWriter, reader)
+		log(fmt.Sprintf("Backing up table with oid %d%s\n", oid, fileSuffix))
+		progress.startTable(oid)
+		numBytes, err := io.Copy(&progressWriter{finalWriter}, reader)
 		if err != nil {
-			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
+			return nil, errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 		}
 		log(fmt.Sprintf("Read %d bytes\n", numBytes))
 
+		/*
+		 * Each table's data is written as a separate frame, so that it can be
+		 * restored without reading the data for any other table.
+		 */
+		err = finishDataFrame(gzipWriter, bufIoWriter)
+		if err != nil {
+			return nil, errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
+		}
+
 		lastProcessed := lastRead + uint64(numBytes)
-		tocfile.AddSegmentDataEntry(uint(oid), lastRead, lastProcessed)
+		entries[uint(oid)] = toc.SegmentDataEntry{StartByte: lastRead, EndByte: lastProcessed,
+			FileStartByte: lastWritten, FileEndByte: fileWriter.count, FileIndex: fileIndex}
 		lastRead = lastProcessed
+		lastWritten = fileWriter.count
+		progress.finishTable(oid)
 
-		lastPipe = currentPipe
-		currentPipe = nextPipe
 		_ = readHandle.Close()
-		err = removeFileIfExists(lastPipe)
+		err = removePipe(currentPipe)
 		if err != nil {
-			return err
+			return nil, err
 		}
+		currentPipe = nextPipe
 	}
 
-	/*
-	 * The order for flushing and closing the writers below is very specific
-	 * to ensure all data is written to the file and file handles are not leaked.
-	 */
-	if gzipWriter != nil {
-		_ = gzipWriter.Close()
+	// All data was flushed when the last frame was finished
+	err := writeHandle.Close()
+	if err != nil {
+		return nil, err
 	}
-	_ = bufIoWriter.Flush()
-	_ = writeHandle.Close()
-	if *pluginConfigFile != "" {
+	if writeCmd != nil {
 		/*
 		 * When using a plugin, the agent may take longer to finish than the
 		 * main gpbackup process. We either write the TOC file if the agent finishes
@@ -103,18 +158,13 @@ func doBackupAgent() error {
 		 * finished. We then wait on the gpbackup side until one of those files is
 		 * written to verify the agent completed.
 		 */
-		log("Uploading remaining data to plugin destination")
+		log("Uploading remaining data%s to plugin destination", fileSuffix)
 		err := writeCmd.Wait()
 		if err != nil {
-			return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
+			return nil, errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 		}
 	}
-	err = tocfile.WriteToFileAndMakeReadOnly(*tocFile)
-	if err != nil {
-		return err
-	}
-	log("Finished writing segment TOC")
-	return nil
+	return entries, nil
 }
 
 func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
@@ -129,39 +179,87 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
 	return reader, readHandle, nil
 }
 
-func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Writer, io.WriteCloser, *exec.Cmd, error) {
+/*
+ * Counts the bytes written to the data file, to record the offset of each
+ * table's frame in the segment TOC.
+ */
+type byteCountingWriter struct {
+	writer io.Writer
+	count  uint64
+}
+
+func (counter *byteCountingWriter) Write(p []byte) (int, error) {
+	n, err := counter.writer.Write(p)
+	counter.count += uint64(n)
+	return n, err
+}
+
+func getBackupPipeWriter(dataFileName string, compressLevel int) (io.Writer, *gzip.Writer, *bufio.Writer, *byteCountingWriter, io.WriteCloser, *exec.Cmd, error) {
 	var writeHandle io.WriteCloser
 	var err error
 	var writeCmd *exec.Cmd
 	if *pluginConfigFile != "" {
-		writeCmd, writeHandle, err = startBackupPluginCommand()
+		writeCmd, writeHandle, err = startBackupPluginCommand(dataFileName)
 	} else {
-		writeHandle, err = os.Create(*dataFile)
+		writeHandle, err = os.Create(dataFileName)
 	}
 	if err != nil {
-		return nil, nil, nil, nil, nil, err
+		return nil, nil, nil, nil, nil, nil, err
 	}
 
 	var finalWriter io.Writer
 	var gzipWriter *gzip.Writer
-	bufIoWriter := bufio.NewWriter(writeHandle)
+	fileWriter := &byteCountingWriter{writer: utils.NewThrottledWriter(writeHandle, bandwidthLimiter)}
+	bufIoWriter := bufio.NewWriter(fileWriter)
 	finalWriter = bufIoWriter
 	if compressLevel > 0 {
 		gzipWriter, err = gzip.NewWriterLevel(bufIoWriter, compressLevel)
 		if err != nil {
-			return nil, nil, nil, nil, nil, err
+			return nil, nil, nil, nil, nil, nil, err
 		}
 		finalWriter = gzipWriter
 	}
-	return finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, nil
+	return finalWriter, gzipWriter, bufIoWriter, fileWriter, writeHandle, writeCmd, nil
 }
 
-func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser, error) {
+/*
+ * Ends the current frame by closing the gzip stream, if any, and flushing it
+ * to the data file, then starts a new gzip stream for the next frame.  The
+ * concatenated gzip streams still form a valid gzip file, so framed files can
+ * also be read sequentially.
+ */
+func finishDataFrame(gzipWriter *gzip.Writer, bufIoWriter *bufio.Writer) error {
+	if gzipWriter != nil {
+		err := gzipWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	err := bufIoWriter.Flush()
+	if err != nil {
+		return err
+	}
+	if gzipWriter != nil {
+		gzipWriter.Reset(bufIoWriter)
+	}
+	return nil
+}
+
+func startBackupPluginCommand(dataFileName string) (*exec.Cmd, io.WriteCloser, error) {
 	pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
 	if err != nil {
 		return nil, nil, err
 	}
-	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
+	if pluginConfig.UsesStorageBackend() {
+		// Storage backends upload the data directly, with no plugin process to wait on
+		backend, err := pluginConfig.GetStorageBackend()
+		if err != nil {
+			return nil, nil, err
+		}
+		writeHandle, err := backend.NewWriter(dataFileName)
+		return nil, writeHandle, err
+	}
+	cmdStr := fmt.Sprintf("%s %s", pluginConfig.GetPluginCommand("backup_data"), dataFileName)
 	writeCmd := exec.Command("bash", "-c", cmdStr)
 
 	writeHandle, err := writeCmd.StdinPipe()
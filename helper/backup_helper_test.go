@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"syscall"
+
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/backup_helper tests", func() {
+	var tempDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "backup_helper_test")
+		*pipeFile = path.Join(tempDir, "gpbackup_0_20200101010101_pipe")
+		*dataFile = path.Join(tempDir, "gpbackup_0_20200101010101_pipe_12345.gz")
+		*tocFile = path.Join(tempDir, "gpbackup_0_20200101010101_toc.yaml")
+		*oidFile = path.Join(tempDir, "gpbackup_0_20200101010101_oid")
+		*compressionLevel = 1
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	/*
+	 * Writes each table's data to its pipe in the order in which the helper
+	 * reads the tables for each data file, as the gpbackup connections do.
+	 */
+	copyTablesToPipes := func(oidsByFile [][]int, tableData map[int]string) chan error {
+		errChan := make(chan error, len(oidsByFile))
+		for _, fileOids := range oidsByFile {
+			Expect(syscall.Mkfifo(fmt.Sprintf("%s_%d", *pipeFile, fileOids[0]), 0777)).To(Succeed())
+			go func(fileOids []int) {
+				for _, oid := range fileOids {
+					pipe, err := os.OpenFile(fmt.Sprintf("%s_%d", *pipeFile, oid), os.O_WRONLY, os.ModeNamedPipe)
+					if err != nil {
+						errChan <- err
+						return
+					}
+					_, err = pipe.WriteString(tableData[oid])
+					if closeErr := pipe.Close(); err == nil {
+						err = closeErr
+					}
+					if err != nil {
+						errChan <- err
+						return
+					}
+				}
+				errChan <- nil
+			}(fileOids)
+		}
+		return errChan
+	}
+	readFrame := func(entry toc.SegmentDataEntry) string {
+		contents, err := ioutil.ReadFile(filepath.GetSegmentDataFilePath(*dataFile, entry.FileIndex))
+		Expect(err).ToNot(HaveOccurred())
+		gzipReader, err := gzip.NewReader(bytes.NewReader(contents[entry.FileStartByte:entry.FileEndByte]))
+		Expect(err).ToNot(HaveOccurred())
+		data, err := ioutil.ReadAll(gzipReader)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	Describe("doBackupAgent", func() {
+		It("writes the tables for each job to their own data file, with offsets in that file", func() {
+			*jobs = 2
+			tableData := map[int]string{1: "1,first\n2,first\n", 2: "3,second\n", 3: "4,third\n5,third\n"}
+			Expect(ioutil.WriteFile(*oidFile, []byte("3\n1\n2\n"), 0644)).To(Succeed())
+			errChan := copyTablesToPipes([][]int{{1, 3}, {2}}, tableData)
+
+			Expect(doBackupAgent()).To(Succeed())
+			Expect(<-errChan).ToNot(HaveOccurred())
+			Expect(<-errChan).ToNot(HaveOccurred())
+
+			segmentTOC := toc.NewSegmentTOC(*tocFile)
+			Expect(segmentTOC.Framed).To(BeTrue())
+			Expect(segmentTOC.DataEntries).To(HaveLen(3))
+			first, second, third := segmentTOC.DataEntries[1], segmentTOC.DataEntries[2], segmentTOC.DataEntries[3]
+			Expect([]int{first.FileIndex, second.FileIndex, third.FileIndex}).To(Equal([]int{0, 1, 0}))
+			Expect([]uint64{first.StartByte, first.EndByte, third.StartByte, third.EndByte}).To(Equal([]uint64{0, 16, 16, 32}))
+			Expect([]uint64{second.StartByte, second.EndByte}).To(Equal([]uint64{0, 9}))
+			Expect(first.FileStartByte).To(Equal(uint64(0)))
+			Expect(third.FileStartByte).To(Equal(first.FileEndByte))
+			Expect(second.FileStartByte).To(Equal(uint64(0)))
+			for oid, data := range tableData {
+				Expect(readFrame(segmentTOC.DataEntries[uint(oid)])).To(Equal(data))
+			}
+		})
+	})
+})
@@ -17,6 +17,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
 )
 
 /*
@@ -24,31 +25,55 @@ import (
  */
 
 var (
-	CleanupGroup  *sync.WaitGroup
-	currentPipe   string
-	errBuf        bytes.Buffer
-	lastPipe      string
-	nextPipe      string
-	version       string
-	wasTerminated bool
-	writeHandle   *os.File
-	writer        *bufio.Writer
+	CleanupGroup     *sync.WaitGroup
+	bandwidthLimiter *utils.RateLimiter
+	errBuf           syncBuffer
+	pipes            = make(map[string]bool)
+	pipesMutex       sync.Mutex
+	version          string
+	wasTerminated    bool
 )
 
+/*
+ * Plugin commands for different data files may run at the same time, so their
+ * stderr is collected in a buffer that is safe for concurrent use.
+ */
+type syncBuffer struct {
+	buffer bytes.Buffer
+	mutex  sync.Mutex
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buffer.String()
+}
+
 /*
  * Command-line flags
  */
 var (
 	backupAgent      *bool
+	byteCountFile    *string
 	compressionLevel *int
 	content          *int
 	dataFile         *string
+	jobs             *int
+	maxBandwidth     *int64
 	oidFile          *string
 	onErrorContinue  *bool
 	pipeFile         *string
 	pluginConfigFile *string
 	printVersion     *bool
 	restoreAgent     *bool
+	storageCommand   *string
+	throttle         *bool
 	tocFile          *string
 )
 
@@ -81,11 +106,18 @@ func DoHelper() {
 		err = doBackupAgent()
 	} else if *restoreAgent {
 		err = doRestoreAgent()
+	} else if *storageCommand != "" {
+		err = doStorageCommand()
+	} else if *throttle {
+		err = doThrottle()
 	}
 	if err != nil {
 		gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
-		handle, _ := iohelper.OpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
-		_ = handle.Close()
+		// Storage commands and throttling report errors through their exit code, as they run without a pipe file
+		if *storageCommand == "" && !*throttle {
+			handle, _ := iohelper.OpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
+			_ = handle.Close()
+		}
 	}
 }
 
@@ -95,15 +127,20 @@ func InitializeGlobals() {
 	gplog.InitializeLogging("gpbackup_helper", "")
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
+	byteCountFile = flag.String("byte-count-file", "", "Absolute path to a file to which to append the number of bytes copied when throttling")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
 	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use with gzip. O indicates no compression.")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
+	jobs = flag.Int("jobs", 1, "The number of tables to back up or restore concurrently")
+	maxBandwidth = flag.Int64("max-bandwidth", 0, "The maximum number of bytes per second at which to read or write data files, or 0 for no limit")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
 	onErrorContinue = flag.Bool("on-error-continue", false, "Continue restore even when encountering an error")
 	pipeFile = flag.String("pipe-file", "", "Absolute path to the pipe file")
 	pluginConfigFile = flag.String("plugin-config", "", "The configuration file to use for a plugin")
 	printVersion = flag.Bool("version", false, "Print version number and exit")
 	restoreAgent = flag.Bool("restore-agent", false, "Use gpbackup_helper as an agent for restore")
+	storageCommand = flag.String("storage-command", "", "Run a plugin command (backup_file, restore_file, backup_data, or restore_data) on the data file using the storage backend in the plugin config")
+	throttle = flag.Bool("throttle", false, "Copy standard input to standard output at no more than --max-bandwidth bytes per second")
 	tocFile = flag.String("toc-file", "", "Absolute path to the table of contents file")
 
 	if *onErrorContinue && !*restoreAgent {
@@ -116,6 +153,13 @@ func InitializeGlobals() {
 		fmt.Printf("gpbackup_helper version %s\n", version)
 		os.Exit(0)
 	}
+	if *storageCommand != "" || *throttle {
+		// restore_data and throttling write to stdout, so only errors may be printed
+		gplog.SetVerbosity(gplog.LOGERROR)
+	}
+	if *maxBandwidth > 0 {
+		bandwidthLimiter = utils.NewRateLimiter(*maxBandwidth)
+	}
 	operating.InitializeSystemFunctions()
 }
 
@@ -125,7 +169,30 @@ func InitializeGlobals() {
 
 func createPipe(pipe string) error {
 	err := syscall.Mkfifo(pipe, 0777)
-	return err
+	if err != nil {
+		return err
+	}
+	trackPipe(pipe)
+	return nil
+}
+
+/*
+ * Pipes are tracked from the time they are created until they are removed, so
+ * that any left behind by an error or termination are removed during cleanup.
+ * The first pipe of each chain is created by gpbackup or gprestore, and is
+ * tracked once the helper starts using it.
+ */
+func trackPipe(pipe string) {
+	pipesMutex.Lock()
+	defer pipesMutex.Unlock()
+	pipes[pipe] = true
+}
+
+func removePipe(pipe string) error {
+	pipesMutex.Lock()
+	delete(pipes, pipe)
+	pipesMutex.Unlock()
+	return removeFileIfExists(pipe)
 }
 
 func getOidListFromFile() ([]int, error) {
@@ -143,22 +210,12 @@ func getOidListFromFile() ([]int, error) {
 	return oidList, nil
 }
 
-func flushAndCloseRestoreWriter() error {
-	if writer != nil {
-		err := writer.Flush()
-		if err != nil {
-			return err
-		}
-		writer = nil
-	}
-	if writeHandle != nil {
-		err := writeHandle.Close()
-		if err != nil {
-			return err
-		}
-		writeHandle = nil
+func flushAndCloseRestoreWriter(writer *bufio.Writer, writeHandle *os.File) error {
+	err := writer.Flush()
+	if err != nil {
+		return err
 	}
-	return nil
+	return writeHandle.Close()
 }
 
 func fileExists(filename string) bool {
@@ -191,22 +248,14 @@ func DoCleanup() {
 		handle, _ := iohelper.OpenFileForWriting(fmt.Sprintf("%s_error", *pipeFile))
 		_ = handle.Close()
 	}
-	err := flushAndCloseRestoreWriter()
-	if err != nil {
-		log("Encountered error during cleanup: %v", err)
-	}
-	err = removeFileIfExists(lastPipe)
-	if err != nil {
-		log("Encountered error during cleanup: %v", err)
-	}
-	err = removeFileIfExists(currentPipe)
-	if err != nil {
-		log("Encountered error during cleanup: %v", err)
-	}
-	err = removeFileIfExists(nextPipe)
-	if err != nil {
-		log("Encountered error during cleanup: %v", err)
+	pipesMutex.Lock()
+	for pipe := range pipes {
+		err := removeFileIfExists(pipe)
+		if err != nil {
+			log("Encountered error during cleanup: %v", err)
+		}
 	}
+	pipesMutex.Unlock()
 	log("Cleanup complete")
 }
 
@@ -0,0 +1,33 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestHelper(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "helper tests")
+}
+
+var _ = BeforeSuite(func() {
+	_, _, _ = testhelper.SetupTestLogger()
+})
+
+/*
+ * The flags are normally set by InitializeGlobals, which parses the command
+ * line, so the tests set them directly.
+ */
+var _ = BeforeEach(func() {
+	backupAgent, onErrorContinue, restoreAgent, throttle = new(bool), new(bool), new(bool), new(bool)
+	compressionLevel, content, jobs = new(int), new(int), new(int)
+	*jobs = 1
+	maxBandwidth = new(int64)
+	byteCountFile, dataFile, oidFile, pipeFile, pluginConfigFile, storageCommand, tocFile = new(string), new(string), new(string), new(string), new(string), new(string), new(string)
+	bandwidthLimiter = nil
+	wasTerminated = false
+})
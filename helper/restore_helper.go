@@ -2,13 +2,14 @@ package helper
 
 import (
 	"bufio"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
 
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
@@ -19,31 +20,62 @@ import (
  */
 
 func doRestoreAgent() error {
-	tocEntries := toc.NewSegmentTOC(*tocFile).DataEntries
-	var lastByte uint64
-	var bytesRead int64
-	var start uint64
-	var end uint64
-	var numDiscarded int
-	var errRemove error
-	var lastError error
+	segmentTOC := toc.NewSegmentTOC(*tocFile)
 
 	oidList, err := getOidListFromFile()
 	if err != nil {
 		return err
 	}
 
-	reader, err := getRestoreDataReader()
-	if err != nil {
-		return err
+	/*
+	 * Each job has its own chain of pipes and its own data readers, so that
+	 * the tables for different jobs can be restored concurrently.  gprestore
+	 * only starts multiple jobs when each job can read just its own tables,
+	 * as otherwise every job would read each data file in full.
+	 */
+	if *jobs > 1 && !segmentTOC.Framed {
+		return errors.Errorf("Cannot restore with %d jobs from data files that are not framed", *jobs)
 	}
+	oidsByJob := utils.AssignOidsToHelperJobs(oidList, *jobs)
+	isFiltered := len(oidList) < len(segmentTOC.DataEntries) || len(oidsByJob) > 1
+	stopStatusWriter := startStatusWriter(len(oidList))
+	jobErrors := make([]error, len(oidsByJob))
+	var jobWaitGroup sync.WaitGroup
+	for jobIndex, jobOids := range oidsByJob {
+		jobWaitGroup.Add(1)
+		go func(jobIndex int, jobOids []int) {
+			defer jobWaitGroup.Done()
+			jobErrors[jobIndex] = restoreOids(jobOids, segmentTOC, isFiltered)
+		}(jobIndex, jobOids)
+	}
+	jobWaitGroup.Wait()
+	stopStatusWriter()
+
+	for _, err := range jobErrors {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func restoreOids(oidList []int, segmentTOC *toc.SegmentTOC, isFiltered bool) error {
+	tocEntries := segmentTOC.DataEntries
+	var bytesRead int64
+	var errRemove error
+	var lastError error
+
+	// Backups with multiple data files have a reader for each file, opened as needed
+	readers := make(map[int]*RestoreReader)
 
 	for i, oid := range oidList {
 		if wasTerminated {
 			return errors.New("Terminated due to user request")
 		}
 
-		currentPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i])
+		currentPipe := fmt.Sprintf("%s_%d", *pipeFile, oidList[i])
+		nextPipe := ""
+		trackPipe(currentPipe)
 		if i < len(oidList)-1 {
 			nextPipe = fmt.Sprintf("%s_%d", *pipeFile, oidList[i+1])
 			log(fmt.Sprintf("Creating pipe for oid %d: %s", oidList[i+1], nextPipe))
@@ -56,52 +88,56 @@ func doRestoreAgent() error {
 			}
 		}
 
-		start = tocEntries[uint(oid)].StartByte
-		end = tocEntries[uint(oid)].EndByte
-
 		log(fmt.Sprintf("Opening pipe for oid %d: %s", oid, currentPipe))
-		writer, writeHandle, err = getRestorePipeWriter(currentPipe)
+		writer, writeHandle, err := getRestorePipeWriter(currentPipe)
 		if err != nil {
 			// In the case this error is hit it means we have lost the
 			// ability to open pipes normally, so hard quit even if
 			// --on-error-continue is given
-			_ = removeFileIfExists(currentPipe)
+			_ = removePipe(currentPipe)
 			return err
 		}
 
-		log(fmt.Sprintf("Data Reader - Start Byte: %d; End Byte: %d; Last Byte: %d", start, end, lastByte))
-		numDiscarded, err = reader.Discard(int(start - lastByte))
+		fileIndex := tocEntries[uint(oid)].FileIndex
+		if readers[fileIndex] == nil {
+			readers[fileIndex], err = getRestoreDataReader(filepath.GetSegmentDataFilePath(*dataFile, fileIndex), segmentTOC, isFiltered)
+			if err != nil {
+				_ = removePipe(currentPipe)
+				return err
+			}
+		}
+		reader := readers[fileIndex]
+		err = reader.positionAtTable(tocEntries[uint(oid)])
 		if err != nil {
 			// Always hard quit if data reader has issues
-			_ = removeFileIfExists(currentPipe)
+			_ = removePipe(currentPipe)
 			return err
 		}
-		log(fmt.Sprintf("Data Reader discarded %d bytes", numDiscarded))
 
 		log(fmt.Sprintf("Restoring table with oid %d", oid))
-		bytesRead, err = io.CopyN(writer, reader, int64(end-start))
+		progress.startTable(oid)
+		bytesRead, err = reader.copyTableData(&progressWriter{writer}, tocEntries[uint(oid)])
 		if err != nil {
-			// In case COPY FROM or copyN fails in the middle of a load. We
-			// need to update the lastByte with the amount of bytes that was
-			// copied before it errored out
-			lastByte += uint64(bytesRead)
+			// In case COPY FROM or copyN fails in the middle of a load, the
+			// reader keeps track of the bytes that were copied before it
+			// errored out
 			err = errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
 			goto LoopEnd
 		}
-		lastByte = end
 		log(fmt.Sprintf("Copied %d bytes into the pipe", bytesRead))
 
 		log(fmt.Sprintf("Closing pipe for oid %d: %s", oid, currentPipe))
-		err = flushAndCloseRestoreWriter()
+		err = flushAndCloseRestoreWriter(writer, writeHandle)
 		if err != nil {
 			goto LoopEnd
 		}
 
 	LoopEnd:
+		progress.finishTable(oid)
 		log(fmt.Sprintf("Removing pipe for oid %d: %s", oid, currentPipe))
-		errRemove = removeFileIfExists(currentPipe)
+		errRemove = removePipe(currentPipe)
 		if errRemove != nil {
-			_ = removeFileIfExists(nextPipe)
+			_ = removePipe(nextPipe)
 			return errRemove
 		}
 
@@ -120,36 +156,6 @@ func doRestoreAgent() error {
 	return lastError
 }
 
-func getRestoreDataReader() (*bufio.Reader, error) {
-	var readHandle io.Reader
-	var err error
-	if *pluginConfigFile != "" {
-		readHandle, err = startRestorePluginCommand()
-	} else {
-		readHandle, err = os.Open(*dataFile)
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	var bufIoReader *bufio.Reader
-	if strings.HasSuffix(*dataFile, ".gz") {
-		gzipReader, err := gzip.NewReader(readHandle)
-		if err != nil {
-			return nil, err
-		}
-		bufIoReader = bufio.NewReader(gzipReader)
-	} else {
-		bufIoReader = bufio.NewReader(readHandle)
-	}
-	// Check that no error has occurred in plugin command
-	errMsg := strings.Trim(errBuf.String(), "\x00")
-	if len(errMsg) != 0 {
-		return nil, errors.New(errMsg)
-	}
-	return bufIoReader, nil
-}
-
 func getRestorePipeWriter(currentPipe string) (*bufio.Writer, *os.File, error) {
 	// Opening this pipe will block until a reader connects to the pipe
 	fileHandle, err := os.OpenFile(currentPipe, os.O_WRONLY, os.ModeNamedPipe)
@@ -160,12 +166,19 @@ func getRestorePipeWriter(currentPipe string) (*bufio.Writer, *os.File, error) {
 	return pipeWriter, fileHandle, nil
 }
 
-func startRestorePluginCommand() (io.Reader, error) {
+func startRestorePluginCommand(dataFile string) (io.Reader, error) {
 	pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
 	if err != nil {
 		return nil, err
 	}
-	cmdStr := fmt.Sprintf("%s restore_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
+	if pluginConfig.UsesStorageBackend() {
+		backend, err := pluginConfig.GetStorageBackend()
+		if err != nil {
+			return nil, err
+		}
+		return backend.NewReader(dataFile)
+	}
+	cmdStr := fmt.Sprintf("%s %s", pluginConfig.GetPluginCommand("restore_data"), dataFile)
 	cmd := exec.Command("bash", "-c", cmdStr)
 
 	readHandle, err := cmd.StdoutPipe()
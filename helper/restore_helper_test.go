@@ -0,0 +1,140 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"syscall"
+
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/restore_helper tests", func() {
+	tableData := map[int]string{1: "1,first\n2,first\n", 2: "3,second\n", 3: "4,third\n5,third\n"}
+	var tempDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "restore_helper_test")
+		*pipeFile = path.Join(tempDir, "gpbackup_0_20200101010101_pipe")
+		*dataFile = path.Join(tempDir, "gpbackup_0_20200101010101_pipe_12345.gz")
+		*tocFile = path.Join(tempDir, "gpbackup_0_20200101010101_toc.yaml")
+		*oidFile = path.Join(tempDir, "gpbackup_0_20200101010101_oid")
+		Expect(ioutil.WriteFile(*oidFile, []byte("1\n2\n3\n"), 0644)).To(Succeed())
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	/*
+	 * Writes the tables in oidsByFile to one data file each, with each table
+	 * in its own frame if framed is true, and writes the segment TOC.
+	 */
+	writeBackup := func(oidsByFile [][]int, framed bool) {
+		segmentTOC := &toc.SegmentTOC{DataEntries: make(map[uint]toc.SegmentDataEntry), Framed: framed}
+		for fileIndex, fileOids := range oidsByFile {
+			var contents bytes.Buffer
+			gzipWriter := gzip.NewWriter(&contents)
+			startByte := uint64(0)
+			for _, oid := range fileOids {
+				fileStartByte := uint64(contents.Len())
+				_, _ = gzipWriter.Write([]byte(tableData[oid]))
+				if framed {
+					Expect(gzipWriter.Close()).To(Succeed())
+					gzipWriter.Reset(&contents)
+				}
+				endByte := startByte + uint64(len(tableData[oid]))
+				if framed {
+					segmentTOC.AddSegmentDataEntry(uint(oid), startByte, endByte, fileStartByte, uint64(contents.Len()), fileIndex)
+				} else {
+					segmentTOC.AddSegmentDataEntry(uint(oid), startByte, endByte, 0, 0, fileIndex)
+				}
+				startByte = endByte
+			}
+			if !framed {
+				Expect(gzipWriter.Close()).To(Succeed())
+			}
+			Expect(ioutil.WriteFile(filepath.GetSegmentDataFilePath(*dataFile, fileIndex), contents.Bytes(), 0644)).To(Succeed())
+		}
+		Expect(segmentTOC.WriteToFileAndMakeReadOnly(*tocFile)).To(Succeed())
+	}
+
+	/*
+	 * Reads each table's data from its pipe in the order in which each helper
+	 * job writes them, as the gprestore connections do.
+	 */
+	copyTablesFromPipes := func(oidsByJob [][]int) chan map[int]string {
+		resultChan := make(chan map[int]string, len(oidsByJob))
+		for _, jobOids := range oidsByJob {
+			Expect(syscall.Mkfifo(fmt.Sprintf("%s_%d", *pipeFile, jobOids[0]), 0777)).To(Succeed())
+			go func(jobOids []int) {
+				defer GinkgoRecover()
+				restored := make(map[int]string)
+				for _, oid := range jobOids {
+					pipe, err := os.OpenFile(fmt.Sprintf("%s_%d", *pipeFile, oid), os.O_RDONLY, os.ModeNamedPipe)
+					Expect(err).ToNot(HaveOccurred())
+					data, err := ioutil.ReadAll(pipe)
+					Expect(err).ToNot(HaveOccurred())
+					_ = pipe.Close()
+					restored[oid] = string(data)
+				}
+				resultChan <- restored
+			}(jobOids)
+		}
+		return resultChan
+	}
+
+	Describe("doRestoreAgent", func() {
+		It("restores the tables for each job concurrently from a backup with a data file per job", func() {
+			writeBackup([][]int{{1, 3}, {2}}, true)
+			*jobs = 2
+			resultChan := copyTablesFromPipes([][]int{{1, 3}, {2}})
+
+			Expect(doRestoreAgent()).To(Succeed())
+
+			Expect([]map[int]string{<-resultChan, <-resultChan}).To(ConsistOf(
+				map[int]string{1: tableData[1], 3: tableData[3]},
+				map[int]string{2: tableData[2]},
+			))
+		})
+		It("restores the tables for each job from a framed backup with a single data file", func() {
+			writeBackup([][]int{{1, 2, 3}}, true)
+			*jobs = 2
+			resultChan := copyTablesFromPipes([][]int{{1, 3}, {2}})
+
+			Expect(doRestoreAgent()).To(Succeed())
+
+			Expect([]map[int]string{<-resultChan, <-resultChan}).To(ConsistOf(
+				map[int]string{1: tableData[1], 3: tableData[3]},
+				map[int]string{2: tableData[2]},
+			))
+		})
+		It("refuses to restore an unframed backup with multiple jobs", func() {
+			writeBackup([][]int{{1, 2, 3}}, false)
+			*jobs = 2
+
+			Expect(doRestoreAgent()).To(MatchError("Cannot restore with 2 jobs from data files that are not framed"))
+		})
+		It("restores all tables of an unframed backup with one job", func() {
+			writeBackup([][]int{{1, 2, 3}}, false)
+			resultChan := copyTablesFromPipes([][]int{{1, 2, 3}})
+
+			Expect(doRestoreAgent()).To(Succeed())
+
+			Expect(<-resultChan).To(Equal(tableData))
+		})
+		It("restores all tables with one job", func() {
+			writeBackup([][]int{{1, 2, 3}}, true)
+			resultChan := copyTablesFromPipes([][]int{{1, 2, 3}})
+
+			Expect(doRestoreAgent()).To(Succeed())
+
+			Expect(<-resultChan).To(Equal(tableData))
+		})
+	})
+})
@@ -0,0 +1,217 @@
+package helper
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * A RestoreReader provides the data for each table being restored from a
+ * segment data file.  When the file is framed, each table's frame is read
+ * on its own, so that tables that are not being restored are never read;
+ * otherwise the file is read sequentially, discarding the data for any
+ * tables that are not being restored.
+ */
+type RestoreReader struct {
+	sequentialReader *bufio.Reader
+	lastByte         uint64
+	openRange        func(startByte uint64, endByte uint64) (io.ReadCloser, error)
+	compressed       bool
+	tableReader      io.Reader
+	tableCloser      io.Closer
+}
+
+func (reader *RestoreReader) positionAtTable(entry toc.SegmentDataEntry) error {
+	if reader.openRange == nil {
+		log(fmt.Sprintf("Data Reader - Start Byte: %d; End Byte: %d; Last Byte: %d", entry.StartByte, entry.EndByte, reader.lastByte))
+		numDiscarded, err := reader.sequentialReader.Discard(int(entry.StartByte - reader.lastByte))
+		reader.lastByte += uint64(numDiscarded)
+		if err != nil {
+			return err
+		}
+		log(fmt.Sprintf("Data Reader discarded %d bytes", numDiscarded))
+		reader.tableReader = reader.sequentialReader
+		return nil
+	}
+
+	log(fmt.Sprintf("Data Reader - File Start Byte: %d; File End Byte: %d", entry.FileStartByte, entry.FileEndByte))
+	rangeReader, err := reader.openRange(entry.FileStartByte, entry.FileEndByte)
+	if err != nil {
+		return err
+	}
+	reader.tableReader = bufio.NewReader(utils.NewThrottledReader(rangeReader, bandwidthLimiter))
+	if reader.compressed {
+		gzipReader, err := gzip.NewReader(reader.tableReader)
+		if err != nil {
+			_ = rangeReader.Close()
+			return err
+		}
+		reader.tableReader = gzipReader
+	}
+	reader.tableCloser = rangeReader
+	return nil
+}
+
+func (reader *RestoreReader) copyTableData(writer io.Writer, entry toc.SegmentDataEntry) (int64, error) {
+	bytesRead, err := io.CopyN(writer, reader.tableReader, int64(entry.EndByte-entry.StartByte))
+	if reader.openRange == nil {
+		// If the copy failed partway through, lastByte still reflects
+		// the bytes that were read before the error
+		reader.lastByte += uint64(bytesRead)
+		return bytesRead, err
+	}
+	if err == nil && reader.compressed {
+		// Reading to the end of the frame verifies its checksum, so that a frame truncated after its data is detected
+		_, err = io.Copy(ioutil.Discard, reader.tableReader)
+	}
+	closeErr := reader.tableCloser.Close()
+	reader.tableCloser = nil
+	if err == nil {
+		err = closeErr
+	}
+	return bytesRead, err
+}
+
+/*
+ * Framed local files are always read by range, since seeking in a file is
+ * cheap.  For plugins and storage backends, a single sequential read is
+ * cheaper when every table is being restored, so ranges are only used when a
+ * reader restores a subset of the tables, as in filtered restores or restores
+ * with multiple jobs.
+ */
+func getRestoreDataReader(dataFile string, segmentTOC *toc.SegmentTOC, isFiltered bool) (*RestoreReader, error) {
+	reader := &RestoreReader{compressed: strings.HasSuffix(dataFile, ".gz")}
+	if segmentTOC.Framed {
+		if *pluginConfigFile == "" {
+			log("Reading frames of data file %s", dataFile)
+			reader.openRange = func(startByte uint64, endByte uint64) (io.ReadCloser, error) {
+				return openFileRange(dataFile, startByte, endByte)
+			}
+			return reader, nil
+		} else if isFiltered {
+			pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
+			if err != nil {
+				return nil, err
+			}
+			supportsRange, err := pluginConfig.SupportsRestoreDataRange()
+			if err != nil {
+				return nil, err
+			}
+			if supportsRange {
+				log("Reading frames of data file %s with plugin", dataFile)
+				reader.openRange, err = getPluginRangeOpener(pluginConfig, dataFile)
+				return reader, err
+			}
+			if *jobs > 1 {
+				return nil, errors.Errorf("Cannot restore with %d jobs because plugin %s does not support restore_data_range", *jobs, pluginConfig.ExecutablePath)
+			}
+			log("Plugin %s does not support restore_data_range; reading data file sequentially", pluginConfig.ExecutablePath)
+		}
+	}
+
+	var readHandle io.Reader
+	var err error
+	if *pluginConfigFile != "" {
+		readHandle, err = startRestorePluginCommand(dataFile)
+	} else {
+		readHandle, err = os.Open(dataFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	readHandle = utils.NewThrottledReader(readHandle, bandwidthLimiter)
+
+	if reader.compressed {
+		gzipReader, err := gzip.NewReader(readHandle)
+		if err != nil {
+			return nil, err
+		}
+		reader.sequentialReader = bufio.NewReader(gzipReader)
+	} else {
+		reader.sequentialReader = bufio.NewReader(readHandle)
+	}
+	// Check that no error has occurred in plugin command
+	errMsg := strings.Trim(errBuf.String(), "\x00")
+	if len(errMsg) != 0 {
+		return nil, errors.New(errMsg)
+	}
+	return reader, nil
+}
+
+type fileRangeReader struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (reader *fileRangeReader) Close() error {
+	return reader.file.Close()
+}
+
+func openFileRange(dataFile string, startByte uint64, endByte uint64) (io.ReadCloser, error) {
+	file, err := os.Open(dataFile)
+	if err != nil {
+		return nil, err
+	}
+	return &fileRangeReader{io.NewSectionReader(file, int64(startByte), int64(endByte-startByte)), file}, nil
+}
+
+/*
+ * Reads the output of a restore_data_range plugin command.  The plugin is
+ * waited on when the reader is closed, so that any plugin error is returned.
+ */
+type pluginRangeReader struct {
+	io.ReadCloser
+	cmd *exec.Cmd
+}
+
+func (reader *pluginRangeReader) Close() error {
+	// Drain any remaining output so the plugin is not blocked writing it
+	_, _ = io.Copy(ioutil.Discard, reader.ReadCloser)
+	err := reader.cmd.Wait()
+	if err != nil {
+		return errors.Wrap(err, strings.Trim(errBuf.String(), "\x00"))
+	}
+	return nil
+}
+
+func getPluginRangeOpener(pluginConfig *utils.PluginConfig, dataFile string) (func(uint64, uint64) (io.ReadCloser, error), error) {
+	if pluginConfig.UsesStorageBackend() {
+		backend, err := pluginConfig.GetStorageBackend()
+		if err != nil {
+			return nil, err
+		}
+		return func(startByte uint64, endByte uint64) (io.ReadCloser, error) {
+			return backend.NewRangeReader(dataFile, startByte, endByte)
+		}, nil
+	}
+	return func(startByte uint64, endByte uint64) (io.ReadCloser, error) {
+		return startRestorePluginRangeCommand(pluginConfig, dataFile, startByte, endByte)
+	}, nil
+}
+
+func startRestorePluginRangeCommand(pluginConfig *utils.PluginConfig, dataFile string, startByte uint64, endByte uint64) (io.ReadCloser, error) {
+	cmdStr := fmt.Sprintf("%s %s %d %d", pluginConfig.GetPluginCommand("restore_data_range"), dataFile, startByte, endByte)
+	cmd := exec.Command("bash", "-c", cmdStr)
+
+	readHandle, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = &errBuf
+
+	err = cmd.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &pluginRangeReader{readHandle, cmd}, nil
+}
@@ -0,0 +1,132 @@
+package helper
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/restore_reader tests", func() {
+	tableData := []string{"1,first\n2,first\n", "3,second\n", "4,third\n5,third\n6,third\n"}
+	var tempDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "restore_reader_test")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	/*
+	 * Writes each table's data as its own gzip frame, as the backup agent
+	 * does, and returns the file name and segment TOC for oids 1, 2, and 3.
+	 */
+	writeFramedFile := func() (string, *toc.SegmentTOC) {
+		segmentTOC := &toc.SegmentTOC{DataEntries: make(map[uint]toc.SegmentDataEntry), Framed: true}
+		var contents bytes.Buffer
+		startByte := uint64(0)
+		for i, data := range tableData {
+			fileStartByte := uint64(contents.Len())
+			gzipWriter := gzip.NewWriter(&contents)
+			_, _ = gzipWriter.Write([]byte(data))
+			Expect(gzipWriter.Close()).To(Succeed())
+			segmentTOC.AddSegmentDataEntry(uint(i+1), startByte, startByte+uint64(len(data)), fileStartByte, uint64(contents.Len()), 0)
+			startByte += uint64(len(data))
+		}
+		filename := path.Join(tempDir, "gpbackup_0_20200101010101_pipe_12345.gz")
+		Expect(ioutil.WriteFile(filename, contents.Bytes(), 0644)).To(Succeed())
+		return filename, segmentTOC
+	}
+	readTable := func(reader *RestoreReader, entry toc.SegmentDataEntry) (string, error) {
+		err := reader.positionAtTable(entry)
+		if err != nil {
+			return "", err
+		}
+		var output bytes.Buffer
+		_, err = reader.copyTableData(&output, entry)
+		return output.String(), err
+	}
+
+	It("reads each table of a framed backup from its own frame", func() {
+		filename, segmentTOC := writeFramedFile()
+
+		reader, err := getRestoreDataReader(filename, segmentTOC, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.openRange).ToNot(BeNil())
+
+		for i, data := range tableData {
+			Expect(readTable(reader, segmentTOC.DataEntries[uint(i+1)])).To(Equal(data))
+		}
+	})
+	It("reads an unframed backup sequentially, skipping tables that are not restored", func() {
+		segmentTOC := &toc.SegmentTOC{DataEntries: make(map[uint]toc.SegmentDataEntry)}
+		var contents bytes.Buffer
+		gzipWriter := gzip.NewWriter(&contents)
+		startByte := uint64(0)
+		for i, data := range tableData {
+			_, _ = gzipWriter.Write([]byte(data))
+			segmentTOC.AddSegmentDataEntry(uint(i+1), startByte, startByte+uint64(len(data)), 0, 0, 0)
+			startByte += uint64(len(data))
+		}
+		Expect(gzipWriter.Close()).To(Succeed())
+		filename := path.Join(tempDir, "gpbackup_0_20200101010101_pipe_12345.gz")
+		Expect(ioutil.WriteFile(filename, contents.Bytes(), 0644)).To(Succeed())
+
+		reader, err := getRestoreDataReader(filename, segmentTOC, true)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(reader.openRange).To(BeNil())
+
+		Expect(readTable(reader, segmentTOC.DataEntries[1])).To(Equal(tableData[0]))
+		Expect(readTable(reader, segmentTOC.DataEntries[3])).To(Equal(tableData[2]))
+		Expect(reader.lastByte).To(Equal(segmentTOC.DataEntries[3].EndByte))
+	})
+	It("reads a range starting in the middle of a framed backup without reading earlier frames", func() {
+		filename, segmentTOC := writeFramedFile()
+		entry := segmentTOC.DataEntries[2]
+		Expect(entry.FileStartByte).To(BeNumerically(">", 0))
+		openedRanges := make([][2]uint64, 0)
+
+		reader, err := getRestoreDataReader(filename, segmentTOC, true)
+		Expect(err).ToNot(HaveOccurred())
+		openRange := reader.openRange
+		reader.openRange = func(startByte uint64, endByte uint64) (io.ReadCloser, error) {
+			openedRanges = append(openedRanges, [2]uint64{startByte, endByte})
+			return openRange(startByte, endByte)
+		}
+
+		Expect(readTable(reader, entry)).To(Equal(tableData[1]))
+		Expect(openedRanges).To(Equal([][2]uint64{{entry.FileStartByte, entry.FileEndByte}}))
+	})
+	It("returns an error for a truncated frame", func() {
+		filename, segmentTOC := writeFramedFile()
+		entry := segmentTOC.DataEntries[3]
+		contents, _ := ioutil.ReadFile(filename)
+		Expect(ioutil.WriteFile(filename, contents[:entry.FileEndByte-4], 0644)).To(Succeed())
+
+		reader, err := getRestoreDataReader(filename, segmentTOC, false)
+		Expect(err).ToNot(HaveOccurred())
+
+		Expect(readTable(reader, segmentTOC.DataEntries[1])).To(Equal(tableData[0]))
+		_, err = readTable(reader, entry)
+		Expect(err).To(HaveOccurred())
+	})
+	It("refuses to read a file sequentially for multiple jobs when the plugin cannot read ranges", func() {
+		filename, segmentTOC := writeFramedFile()
+		pluginPath := path.Join(tempDir, "fake_plugin.sh")
+		Expect(ioutil.WriteFile(pluginPath, []byte("#!/bin/bash\necho 0.4.0\n"), 0755)).To(Succeed())
+		*pluginConfigFile = path.Join(tempDir, "plugin_config.yaml")
+		Expect(ioutil.WriteFile(*pluginConfigFile, []byte("executablepath: "+pluginPath+"\n"), 0644)).To(Succeed())
+		*jobs = 2
+
+		_, err := getRestoreDataReader(filename, segmentTOC, true)
+
+		Expect(err).To(MatchError("Cannot restore with 2 jobs because plugin " + pluginPath + " does not support restore_data_range"))
+	})
+})
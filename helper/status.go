@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * The helper periodically writes its progress to a status file, which
+ * gpbackup and gprestore poll to report the progress of each segment.
+ */
+
+var progress = &progressTracker{currentOids: make(map[int]bool)}
+
+type progressTracker struct {
+	currentOids     map[int]bool
+	tablesCompleted int
+	totalTables     int
+	bytesProcessed  uint64
+	mutex           sync.Mutex
+}
+
+func (tracker *progressTracker) startTable(oid int) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.currentOids[oid] = true
+}
+
+func (tracker *progressTracker) finishTable(oid int) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	delete(tracker.currentOids, oid)
+	tracker.tablesCompleted++
+}
+
+func (tracker *progressTracker) addBytes(numBytes int) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	tracker.bytesProcessed += uint64(numBytes)
+}
+
+func (tracker *progressTracker) getStatus() utils.HelperStatus {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+	currentOids := make([]int, 0, len(tracker.currentOids))
+	for oid := range tracker.currentOids {
+		currentOids = append(currentOids, oid)
+	}
+	sort.Ints(currentOids)
+	return utils.HelperStatus{
+		CurrentOids:     currentOids,
+		TablesCompleted: tracker.tablesCompleted,
+		TotalTables:     tracker.totalTables,
+		BytesProcessed:  tracker.bytesProcessed,
+	}
+}
+
+/*
+ * Counts the uncompressed table data copied through the helper as it is
+ * copied, so that progress is reported during the copy of a large table.
+ */
+type progressWriter struct {
+	writer io.Writer
+}
+
+func (counter *progressWriter) Write(p []byte) (int, error) {
+	n, err := counter.writer.Write(p)
+	progress.addBytes(n)
+	return n, err
+}
+
+/*
+ * Writes the status file until the returned function is called, which writes
+ * the final status.  Failing to write the status file only affects progress
+ * reporting, so errors are logged rather than returned.
+ */
+func startStatusWriter(totalTables int) func() {
+	progress.mutex.Lock()
+	progress.totalTables = totalTables
+	progress.mutex.Unlock()
+
+	statusFile := utils.GetHelperStatusFilePath(*pipeFile)
+	lastBytes := uint64(0)
+	lastTime := time.Now()
+	writeStatus := func() {
+		status := progress.getStatus()
+		now := time.Now()
+		if elapsed := now.Sub(lastTime).Seconds(); elapsed > 0 {
+			status.BytesPerSecond = uint64(float64(status.BytesProcessed-lastBytes) / elapsed)
+		}
+		status.UpdateTime = now.Unix()
+		lastBytes = status.BytesProcessed
+		lastTime = now
+		err := utils.WriteHelperStatusFile(statusFile, status)
+		if err != nil {
+			log("Unable to write status file %s: %v", statusFile, err)
+		}
+	}
+
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	go func() {
+		defer close(doneChan)
+		ticker := time.NewTicker(utils.HELPER_STATUS_WRITE_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopChan:
+				writeStatus()
+				return
+			case <-ticker.C:
+				writeStatus()
+			}
+		}
+	}()
+	return func() {
+		close(stopChan)
+		<-doneChan
+	}
+}
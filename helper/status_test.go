@@ -0,0 +1,46 @@
+package helper
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"gopkg.in/yaml.v2"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/status tests", func() {
+	var tempDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "status_test")
+		*pipeFile = path.Join(tempDir, "gpbackup_0_20200101010101_pipe")
+		progress = &progressTracker{currentOids: make(map[int]bool)}
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	Describe("startStatusWriter", func() {
+		It("writes the final progress in the format read by gpbackup and gprestore", func() {
+			stopStatusWriter := startStatusWriter(3)
+			progress.startTable(16384)
+			_, _ = (&progressWriter{ioutil.Discard}).Write([]byte("table data"))
+			progress.finishTable(16384)
+			progress.startTable(16390)
+			stopStatusWriter()
+
+			contents, err := ioutil.ReadFile(utils.GetHelperStatusFilePath(*pipeFile))
+			Expect(err).ToNot(HaveOccurred())
+			var status utils.HelperStatus
+			Expect(yaml.Unmarshal(contents, &status)).To(Succeed())
+			Expect(status.CurrentOids).To(Equal([]int{16390}))
+			Expect(status.TablesCompleted).To(Equal(1))
+			Expect(status.TotalTables).To(Equal(3))
+			Expect(status.BytesProcessed).To(Equal(uint64(10)))
+			Expect(status.UpdateTime).ToNot(BeZero())
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package helper
+
+import (
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/storage"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Storage backend functions
+ *
+ * Storage backends have no executable of their own, so the plugin commands
+ * run on segments for a storage backend are performed by gpbackup_helper.
+ */
+
+func doStorageCommand() error {
+	pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
+	if err != nil {
+		return err
+	}
+	if !pluginConfig.UsesStorageBackend() {
+		return errors.Errorf("Plugin config %s does not specify a storage backend", *pluginConfigFile)
+	}
+	backend, err := pluginConfig.GetStorageBackend()
+	if err != nil {
+		return err
+	}
+
+	log("Running storage command %s for %s", *storageCommand, *dataFile)
+	switch *storageCommand {
+	case "backup_file":
+		return storage.PutFile(backend, *dataFile)
+	case "restore_file":
+		return storage.GetFile(backend, *dataFile)
+	case "backup_data":
+		writeHandle, err := backend.NewWriter(*dataFile)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writeHandle, os.Stdin)
+		if closeErr := writeHandle.Close(); err == nil {
+			err = closeErr
+		}
+		return err
+	case "restore_data":
+		readHandle, err := backend.NewReader(*dataFile)
+		if err != nil {
+			return err
+		}
+		defer readHandle.Close()
+		_, err = io.Copy(os.Stdout, readHandle)
+		return err
+	default:
+		return errors.Errorf("Invalid storage command %s", *storageCommand)
+	}
+}
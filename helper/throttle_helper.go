@@ -0,0 +1,48 @@
+package helper
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Throttling specific functions
+ *
+ * Multiple-data-file backups and restores do not use a helper agent, so their
+ * COPY PROGRAM pipelines pass data through gpbackup_helper to limit its rate.
+ */
+
+func doThrottle() error {
+	if bandwidthLimiter == nil {
+		return errors.New("--throttle must be specified with --max-bandwidth")
+	}
+	numBytes, err := io.Copy(os.Stdout, utils.NewThrottledReader(os.Stdin, bandwidthLimiter))
+	if err != nil {
+		return err
+	}
+	if *byteCountFile != "" {
+		return appendByteCount(*byteCountFile, numBytes)
+	}
+	return nil
+}
+
+/*
+ * Every pipeline on a segment appends to the same file, so each count is
+ * written as a single line in a single append.
+ */
+func appendByteCount(filename string, numBytes int64) error {
+	handle, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(handle, "%d\n", numBytes)
+	if err != nil {
+		_ = handle.Close()
+		return err
+	}
+	return handle.Close()
+}
@@ -0,0 +1,27 @@
+package helper
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("helper/throttle_helper tests", func() {
+	Describe("appendByteCount", func() {
+		It("appends one line for each pipeline", func() {
+			tempDir, _ := ioutil.TempDir("", "throttle_helper_test")
+			defer os.RemoveAll(tempDir)
+			byteCountFile := path.Join(tempDir, "gpbackup_0_20170101010101_bytes_1234")
+
+			Expect(appendByteCount(byteCountFile, 1024)).To(Succeed())
+			Expect(appendByteCount(byteCountFile, 0)).To(Succeed())
+
+			contents, err := ioutil.ReadFile(byteCountFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(contents)).To(Equal("1024\n0\n"))
+		})
+	})
+})
@@ -8,9 +8,21 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/nightlyone/lockfile"
+	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
+/*
+ * The data format version is raised when backups start laying out data in a
+ * way that an older gprestore would misread, so that a gprestore that cannot
+ * read a backup refuses it instead of restoring only part of its data.
+ * Backups in the original layout omit the version.
+ */
+const (
+	DATA_FORMAT_MULTIPLE_DATA_FILES = 1
+	MAX_DATA_FORMAT_VERSION         = DATA_FORMAT_MULTIPLE_DATA_FILES
+)
+
 type RestorePlanEntry struct {
 	Timestamp string
 	TableFQNs []string
@@ -24,6 +36,7 @@ type BackupConfig struct {
 	DatabaseVersion       string
 	DataOnly              bool
 	DateDeleted           string
+	EffectiveFlags        map[string]string `yaml:"effectiveflags,omitempty"`
 	ExcludeRelations      []string
 	ExcludeSchemaFiltered bool
 	ExcludeSchemas        []string
@@ -39,6 +52,9 @@ type BackupConfig struct {
 	PluginVersion         string
 	RestorePlan           []RestorePlanEntry
 	SingleDataFile        bool
+	DataFilesPerSegment   int  `yaml:"datafilespersegment,omitempty"`
+	DataFormatVersion     int  `yaml:"dataformatversion,omitempty"`
+	FramedDataFiles       bool `yaml:"frameddatafiles,omitempty"`
 	Timestamp             string
 	EndTime               string
 	WithStatistics        bool
@@ -130,6 +146,29 @@ func (history *History) RewriteHistoryFile(historyFilePath string) error {
 	return err
 }
 
+/*
+ * Records the deletion of the backup with the given timestamp in the history
+ * file, so that the history stays in sync with the backups that still exist.
+ */
+func MarkBackupDeleted(historyFilePath string, timestamp string) error {
+	lock := lockHistoryFile()
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	history, err := NewHistory(historyFilePath)
+	if err != nil {
+		return err
+	}
+	for i := range history.BackupConfigs {
+		if history.BackupConfigs[i].Timestamp == timestamp {
+			history.BackupConfigs[i].DateDeleted = CurrentTimestamp()
+			return history.WriteToFileAndMakeReadOnly(historyFilePath)
+		}
+	}
+	return errors.Errorf("Backup %s was not found in history file %s", timestamp, historyFilePath)
+}
+
 func lockHistoryFile() lockfile.Lockfile {
 	lock, err := lockfile.New("/tmp/gpbackup_history.yaml.lck")
 	gplog.FatalOnError(err)
@@ -258,4 +258,26 @@ var _ = Describe("backup/history tests", func() {
 			Expect(foundConfig).To(BeNil())
 		})
 	})
+	Describe("MarkBackupDeleted", func() {
+		BeforeEach(func() {
+			operating.System.Now = func() time.Time { return time.Date(2017, 10, 1, 1, 1, 1, 1, time.Local) }
+			Expect(history.WriteBackupHistory(historyFilePath, &testConfig1)).To(Succeed())
+			Expect(history.WriteBackupHistory(historyFilePath, &testConfig2)).To(Succeed())
+		})
+		AfterEach(func() {
+			operating.System.Now = time.Now
+		})
+		It("records the deletion date of the backup", func() {
+			Expect(history.MarkBackupDeleted(historyFilePath, "timestamp1")).To(Succeed())
+
+			resultHistory, err := history.NewHistory(historyFilePath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resultHistory.FindBackupConfig("timestamp1").DateDeleted).To(Equal("20171001010101"))
+			Expect(resultHistory.FindBackupConfig("timestamp2").DateDeleted).To(Equal(""))
+		})
+		It("returns an error when timestamp not found", func() {
+			err := history.MarkBackupDeleted(historyFilePath, "foo")
+			Expect(err).To(MatchError("Backup foo was not found in history file /tmp/history_file.yaml"))
+		})
+	})
 })
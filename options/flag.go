@@ -5,45 +5,77 @@ package options
  */
 
 import (
+	"fmt"
+	"os"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 )
 
 const (
-	BACKUP_DIR            = "backup-dir"
-	COMPRESSION_LEVEL     = "compression-level"
-	DATA_ONLY             = "data-only"
-	DBNAME                = "dbname"
-	DEBUG                 = "debug"
-	EXCLUDE_RELATION      = "exclude-table"
-	EXCLUDE_RELATION_FILE = "exclude-table-file"
-	EXCLUDE_SCHEMA        = "exclude-schema"
-	EXCLUDE_SCHEMA_FILE   = "exclude-schema-file"
-	FROM_TIMESTAMP        = "from-timestamp"
-	INCLUDE_RELATION      = "include-table"
-	INCLUDE_RELATION_FILE = "include-table-file"
-	INCLUDE_SCHEMA        = "include-schema"
-	INCLUDE_SCHEMA_FILE   = "include-schema-file"
-	INCREMENTAL           = "incremental"
-	JOBS                  = "jobs"
-	LEAF_PARTITION_DATA   = "leaf-partition-data"
-	METADATA_ONLY         = "metadata-only"
-	NO_COMPRESSION        = "no-compression"
-	PLUGIN_CONFIG         = "plugin-config"
-	QUIET                 = "quiet"
-	SINGLE_DATA_FILE      = "single-data-file"
-	VERBOSE               = "verbose"
-	WITH_STATS            = "with-stats"
-	CREATE_DB             = "create-db"
-	ON_ERROR_CONTINUE     = "on-error-continue"
-	REDIRECT_DB           = "redirect-db"
-	TIMESTAMP             = "timestamp"
-	WITH_GLOBALS          = "with-globals"
-	REDIRECT_SCHEMA       = "redirect-schema"
+	BACKUP_DIR             = "backup-dir"
+	COMPRESSION_LEVEL      = "compression-level"
+	COPY_TIMEOUT           = "copy-timeout"
+	DATA_ONLY              = "data-only"
+	DATA_TIMEOUT           = "data-timeout"
+	DBNAME                 = "dbname"
+	DEBUG                  = "debug"
+	EXCLUDE_RELATION       = "exclude-table"
+	EXCLUDE_RELATION_FILE  = "exclude-table-file"
+	EXCLUDE_SCHEMA         = "exclude-schema"
+	EXCLUDE_SCHEMA_FILE    = "exclude-schema-file"
+	FROM_TIMESTAMP         = "from-timestamp"
+	INCLUDE_RELATION       = "include-table"
+	INCLUDE_RELATION_FILE  = "include-table-file"
+	INCLUDE_SCHEMA         = "include-schema"
+	INCLUDE_SCHEMA_FILE    = "include-schema-file"
+	INCREMENTAL            = "incremental"
+	INACTIVITY_TIMEOUT     = "inactivity-timeout"
+	IO_NICE_LEVEL          = "io-nice-level"
+	JOBS                   = "jobs"
+	LEAF_PARTITION_DATA    = "leaf-partition-data"
+	MAX_BANDWIDTH          = "max-bandwidth"
+	MAX_BANDWIDTH_PER_HOST = "max-bandwidth-per-host"
+	METADATA_ONLY          = "metadata-only"
+	NO_COMPRESSION         = "no-compression"
+	PLUGIN_CONFIG          = "plugin-config"
+	QUIET                  = "quiet"
+	SINGLE_DATA_FILE       = "single-data-file"
+	VERBOSE                = "verbose"
+	WITH_STATS             = "with-stats"
+	CREATE_DB              = "create-db"
+	ON_ERROR_CONTINUE      = "on-error-continue"
+	REDIRECT_DB            = "redirect-db"
+	TIMESTAMP              = "timestamp"
+	WITH_GLOBALS           = "with-globals"
+	REDIRECT_SCHEMA        = "redirect-schema"
+	RETRY_ERRORS_FROM      = "retry-errors-from"
+	REJECT_LIMIT           = "reject-limit"
+	HOOK_CONFIG            = "hook-config"
+	CONFIG                 = "config"
+	TABLESPACE_MAP         = "tablespace-map"
+	NO_TABLESPACES         = "no-tablespaces"
+	OWNER_MAP              = "owner-map"
+	NO_OWNER               = "no-owner"
+	NO_PRIVILEGES          = "no-privileges"
+	EXTERNAL_LOCATION_MAP  = "external-location-map"
+	NO_EXTERNAL_TABLES     = "no-external-tables"
+	MATERIALIZE_EXTERNAL   = "materialize-external-tables"
+	EXTERNAL_AS_HEAP       = "external-tables-as-heap"
+	TABLE_OVERRIDES        = "table-overrides"
+	TRUNCATE_TABLE         = "truncate-table"
+	POSTDATA_GUC           = "postdata-guc"
+	SECTION                = "section"
+	INCLUDE_DEPENDENCIES   = "include-dependencies"
+	INCLUDE_DEPENDENTS     = "include-dependents"
+	LIST_BACKUPS           = "list-backups"
+	DELETE_BACKUP          = "delete-backup"
 )
 
 /*
@@ -63,6 +95,15 @@ func CheckExclusiveFlags(flags *pflag.FlagSet, flagNames ...string) {
 	}
 }
 
+// Each of the flags passed to this function must be set
+func CheckRequiredFlags(flags *pflag.FlagSet, flagNames ...string) {
+	for _, name := range flagNames {
+		if !flags.Changed(name) {
+			gplog.Fatal(errors.Errorf(`required flag(s) "%s" not set`, name), "")
+		}
+	}
+}
+
 /*
  * Functions for validating flag values
  */
@@ -81,6 +122,64 @@ func HandleSingleDashes(args []string) []string {
 	return newArgs
 }
 
+/*
+ * Sets flags from the YAML file passed to --config, if any.  Each key in the
+ * file is a flag name, and flags given on the command line take precedence
+ * over values in the file.  Environment variables in values are expanded.
+ */
+func ApplyConfigFile(flags *pflag.FlagSet) error {
+	configFile, err := flags.GetString(CONFIG)
+	if err != nil || configFile == "" {
+		return err
+	}
+	contents, err := operating.System.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	configValues := make(map[string]interface{})
+	err = yaml.Unmarshal(contents, &configValues)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse config file %s", configFile)
+	}
+	flagNames := make([]string, 0, len(configValues))
+	for name := range configValues {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	for _, name := range flagNames {
+		if flags.Lookup(name) == nil || name == CONFIG {
+			return errors.Errorf("Invalid flag %s in config file %s", name, configFile)
+		}
+		if flags.Changed(name) {
+			gplog.Verbose("Flag --%s was set on the command line; ignoring its value in config file %s", name, configFile)
+			continue
+		}
+		values, isList := configValues[name].([]interface{})
+		if !isList {
+			values = []interface{}{configValues[name]}
+		}
+		for _, value := range values {
+			err = flags.Set(name, os.ExpandEnv(fmt.Sprintf("%v", value)))
+			if err != nil {
+				return errors.Wrapf(err, "Invalid value for flag %s in config file %s", name, configFile)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Returns the value of every flag set on the command line or in a config file,
+ * for recording the effective configuration of a backup or restore.
+ */
+func GetEffectiveFlags(flags *pflag.FlagSet) map[string]string {
+	effectiveFlags := make(map[string]string)
+	flags.Visit(func(flag *pflag.Flag) {
+		effectiveFlags[flag.Name] = flag.Value.String()
+	})
+	return effectiveFlags
+}
+
 func MustGetFlagString(cmdFlags *pflag.FlagSet, flagName string) string {
 	value, err := cmdFlags.GetString(flagName)
 	gplog.FatalOnError(err)
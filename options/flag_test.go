@@ -2,6 +2,8 @@ package options_test
 
 import (
 	"flag"
+	"io/ioutil"
+	"os"
 
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/options"
@@ -39,6 +41,93 @@ var _ = Describe("utils/flag tests", func() {
 				options.CheckExclusiveFlags(flagSet, "stringFlag", "boolFlag")
 			})
 		})
+		Context("CheckRequiredFlags", func() {
+			It("does not panic if all required flags are set", func() {
+				Expect(flagSet.Parse([]string{"--stringFlag", "foo", "--intFlag", "42"})).To(Succeed())
+				options.CheckRequiredFlags(flagSet, "stringFlag", "intFlag")
+			})
+			It("panics if a required flag is not set", func() {
+				Expect(flagSet.Parse([]string{"--stringFlag", "foo"})).To(Succeed())
+				defer testhelper.ShouldPanicWithMessage(`required flag(s) "intFlag" not set`)
+				options.CheckRequiredFlags(flagSet, "stringFlag", "intFlag")
+			})
+		})
+		Context("ApplyConfigFile", func() {
+			var configFile *os.File
+			BeforeEach(func() {
+				_ = flagSet.String(options.CONFIG, "", "This is the config flag.")
+				_ = flagSet.StringArray("arrayFlag", []string{}, "This is a sample string array flag.")
+				configFile, _ = ioutil.TempFile("", "config.yaml")
+			})
+			AfterEach(func() {
+				_ = os.Remove(configFile.Name())
+			})
+			writeConfig := func(contents string) {
+				_, err := configFile.WriteString(contents)
+				Expect(err).ToNot(HaveOccurred())
+				_ = configFile.Close()
+			}
+			It("does nothing if no config file is given", func() {
+				Expect(flagSet.Parse([]string{"--intFlag", "42"})).To(Succeed())
+				Expect(options.ApplyConfigFile(flagSet)).To(Succeed())
+				Expect(flagSet.Changed("stringFlag")).To(BeFalse())
+			})
+			It("sets flags from the config file", func() {
+				writeConfig("stringFlag: foo\nboolFlag: true\nintFlag: 42\narrayFlag:\n- public.foo\n- public.bar\n")
+				Expect(flagSet.Parse([]string{"--config", configFile.Name()})).To(Succeed())
+
+				Expect(options.ApplyConfigFile(flagSet)).To(Succeed())
+
+				Expect(flagSet.GetString("stringFlag")).To(Equal("foo"))
+				Expect(flagSet.GetBool("boolFlag")).To(BeTrue())
+				Expect(flagSet.GetInt("intFlag")).To(Equal(42))
+				Expect(flagSet.GetStringArray("arrayFlag")).To(Equal([]string{"public.foo", "public.bar"}))
+				Expect(flagSet.Changed("stringFlag")).To(BeTrue())
+			})
+			It("does not override flags given on the command line", func() {
+				writeConfig("stringFlag: foo\nintFlag: 42\n")
+				Expect(flagSet.Parse([]string{"--config", configFile.Name(), "--stringFlag", "bar"})).To(Succeed())
+
+				Expect(options.ApplyConfigFile(flagSet)).To(Succeed())
+
+				Expect(flagSet.GetString("stringFlag")).To(Equal("bar"))
+				Expect(flagSet.GetInt("intFlag")).To(Equal(42))
+			})
+			It("expands environment variables in values", func() {
+				_ = os.Setenv("CONFIG_TEST_DIR", "/data/backups")
+				defer os.Unsetenv("CONFIG_TEST_DIR")
+				writeConfig("stringFlag: ${CONFIG_TEST_DIR}/daily\n")
+				Expect(flagSet.Parse([]string{"--config", configFile.Name()})).To(Succeed())
+
+				Expect(options.ApplyConfigFile(flagSet)).To(Succeed())
+
+				Expect(flagSet.GetString("stringFlag")).To(Equal("/data/backups/daily"))
+			})
+			It("returns an error for an unknown flag", func() {
+				writeConfig("fakeFlag: foo\n")
+				Expect(flagSet.Parse([]string{"--config", configFile.Name()})).To(Succeed())
+
+				err := options.ApplyConfigFile(flagSet)
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(Equal("Invalid flag fakeFlag in config file " + configFile.Name()))
+			})
+			It("returns an error for an invalid flag value", func() {
+				writeConfig("intFlag: foo\n")
+				Expect(flagSet.Parse([]string{"--config", configFile.Name()})).To(Succeed())
+
+				err := options.ApplyConfigFile(flagSet)
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(ContainSubstring("Invalid value for flag intFlag in config file"))
+			})
+		})
+		Context("GetEffectiveFlags", func() {
+			It("returns the values of all set flags", func() {
+				Expect(flagSet.Parse([]string{"--stringFlag", "foo", "--intFlag", "42"})).To(Succeed())
+				Expect(options.GetEffectiveFlags(flagSet)).To(Equal(map[string]string{"stringFlag": "foo", "intFlag": "42"}))
+			})
+		})
 		Context("HandleSingleDashes", func() {
 			It("replaces single dash at beginning of command", func() {
 				result := options.HandleSingleDashes([]string{"-some_flag", "some_argument"})
@@ -0,0 +1,60 @@
+package conformance_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/greenplum-db/gpbackup/plugins/conformance"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+/*
+ * Plugin authors can check a plugin with
+ *   go test ./plugins/conformance -args --plugin <executable> --plugin_config <config> [--report_file <file>]
+ */
+var (
+	pluginPath    string
+	pluginConfig  string
+	largeDataSize int64
+	reportFile    string
+)
+
+func init() {
+	flag.StringVar(&pluginPath, "plugin", "", "The absolute path of a plugin executable to check for conformance with the plugin API")
+	flag.StringVar(&pluginConfig, "plugin_config", "", "The absolute path of the config file to pass to the plugin")
+	flag.Int64Var(&largeDataSize, "large_data_size", conformance.DEFAULT_LARGE_DATA_SIZE, "The number of bytes to stream through the plugin when checking large inputs")
+	flag.StringVar(&reportFile, "report_file", "", "A file to which to write the conformance report, in addition to stdout")
+}
+
+func TestConformance(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "plugin conformance tests")
+}
+
+var _ = Describe("plugin conformance", func() {
+	It("checks the plugin given with --plugin", func() {
+		if pluginPath == "" {
+			Skip("No plugin was given with --plugin")
+		}
+		workDir, err := ioutil.TempDir("", "plugin_conformance")
+		Expect(err).ToNot(HaveOccurred())
+		defer os.RemoveAll(workDir)
+
+		harness := conformance.NewHarness(pluginPath, pluginConfig, workDir)
+		harness.LargeDataSize = largeDataSize
+		report := harness.Run()
+
+		report.Write(os.Stdout)
+		if reportFile != "" {
+			file, err := os.Create(reportFile)
+			Expect(err).ToNot(HaveOccurred())
+			report.Write(file)
+			Expect(file.Close()).To(Succeed())
+		}
+		Expect(report.Passed()).To(BeTrue(), "Plugin does not conform to the gpbackup plugin API")
+	})
+})
@@ -0,0 +1,405 @@
+package conformance
+
+/*
+ * This file contains a harness that checks whether a plugin executable
+ * conforms to the gpbackup plugin API described in plugins/README.md, by
+ * running each plugin command the way gpbackup and gprestore do.
+ */
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+const DEFAULT_LARGE_DATA_SIZE = 64 * 1024 * 1024
+
+type skipError struct {
+	reason string
+}
+
+func (err skipError) Error() string {
+	return err.reason
+}
+
+type Harness struct {
+	PluginPath string
+	ConfigPath string
+	// Stands in for the master and segment data directories
+	WorkDir string
+	// The number of bytes streamed through backup_data and restore_data by the large input checks
+	LargeDataSize int64
+	Timestamp     string
+
+	apiVersion    semver.Version
+	backupDir     string
+	fileContents  []byte
+	dataContents  []byte
+	largeDataHash []byte
+	report        *Report
+}
+
+func NewHarness(pluginPath string, configPath string, workDir string) *Harness {
+	return &Harness{
+		PluginPath:    pluginPath,
+		ConfigPath:    configPath,
+		WorkDir:       workDir,
+		LargeDataSize: DEFAULT_LARGE_DATA_SIZE,
+		Timestamp:     time.Now().Format("20060102150405"),
+	}
+}
+
+/*
+ * Runs every check in the order gpbackup and gprestore call the plugin
+ * commands, so that later checks restore the files written by earlier ones.
+ */
+func (harness *Harness) Run() *Report {
+	harness.report = &Report{PluginPath: harness.PluginPath, Timestamp: harness.Timestamp, Results: make([]Result, 0)}
+	harness.backupDir = path.Join(harness.WorkDir, "backups", harness.Timestamp[0:8], harness.Timestamp)
+
+	harness.check("plugin_api_version", harness.checkAPIVersion)
+	harness.check("--version", harness.checkPluginVersion)
+	harness.check("setup_plugin_for_backup", func() error { return harness.runHook("setup_plugin_for_backup") })
+	harness.check("backup_file", harness.checkBackupFile)
+	harness.check("backup_data", harness.checkBackupData)
+	harness.check("backup_data with large input", harness.checkBackupLargeData)
+	harness.check("cleanup_plugin_for_backup", func() error { return harness.runHook("cleanup_plugin_for_backup") })
+	harness.check("setup_plugin_for_restore", func() error { return harness.runHook("setup_plugin_for_restore") })
+	harness.check("restore_file", harness.checkRestoreFile)
+	harness.check("restore_data", harness.checkRestoreData)
+	harness.check("restore_data_range", harness.checkRestoreDataRange)
+	harness.check("restore_data with large input", harness.checkRestoreLargeData)
+	harness.check("error propagation", harness.checkErrorPropagation)
+	harness.check("cleanup_plugin_for_restore", func() error { return harness.runHook("cleanup_plugin_for_restore") })
+	harness.check("list_backups", harness.checkListBackups)
+	harness.check("delete_backup", harness.checkDeleteBackup)
+	return harness.report
+}
+
+func (harness *Harness) check(name string, checkFunc func() error) {
+	start := time.Now()
+	err := checkFunc()
+	result := Result{Name: name, Status: PASSED, Duration: time.Since(start)}
+	if skip, ok := err.(skipError); ok {
+		result.Status = SKIPPED
+		result.Message = skip.reason
+	} else if err != nil {
+		result.Status = FAILED
+		result.Message = err.Error()
+	}
+	harness.report.AddResult(result)
+}
+
+func (harness *Harness) getFilePath(filename string) string {
+	return path.Join(harness.backupDir, filename)
+}
+
+func (harness *Harness) runCommand(stdin io.Reader, stdout io.Writer, args ...string) error {
+	cmd := exec.Command(harness.PluginPath, args...)
+	var stderr bytes.Buffer
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return errors.Errorf("%s %s failed with %v: %s", path.Base(harness.PluginPath), args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (harness *Harness) getCommandOutput(args ...string) (string, error) {
+	var stdout bytes.Buffer
+	err := harness.runCommand(nil, &stdout, args...)
+	return strings.TrimSpace(stdout.String()), err
+}
+
+/*
+ * Setup and cleanup hooks are called once on the master, once per segment
+ * host, and once per segment, with the content ID quoted as gpbackup does.
+ */
+func (harness *Harness) runHook(command string) error {
+	for _, scope := range []utils.PluginScope{utils.MASTER, utils.SEGMENT_HOST, utils.SEGMENT} {
+		args := []string{command, harness.ConfigPath, harness.backupDir, string(scope)}
+		if scope == utils.MASTER {
+			args = append(args, `"-1"`)
+		} else if scope == utils.SEGMENT {
+			args = append(args, `"0"`)
+		}
+		err := harness.runCommand(nil, ioutil.Discard, args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (harness *Harness) checkAPIVersion() error {
+	output, err := harness.getCommandOutput("plugin_api_version")
+	if err != nil {
+		return err
+	}
+	harness.report.APIVersion = output
+	version, err := semver.Make(output)
+	if err != nil {
+		return errors.Errorf("Plugin API version %s is not a semantic version: %v", output, err)
+	}
+	requiredVersion, _ := semver.Make(utils.RequiredPluginVersion)
+	if !version.GE(requiredVersion) {
+		return errors.Errorf("Plugin API version %s is less than the minimum supported version %s", version, requiredVersion)
+	}
+	harness.apiVersion = version
+	return nil
+}
+
+func (harness *Harness) checkPluginVersion() error {
+	output, err := harness.getCommandOutput("--version")
+	if err != nil {
+		return err
+	}
+	harness.report.PluginVersion = output
+	if parts := strings.Split(output, " "); len(parts) != 3 || parts[1] != "version" {
+		return errors.Errorf(`Plugin version "%s" is not in the expected format "[plugin_name] version [git_version]"`, output)
+	}
+	return nil
+}
+
+func (harness *Harness) supportsCommand(command string, commandVersion string) error {
+	requiredVersion, _ := semver.Make(commandVersion)
+	if !harness.apiVersion.GE(requiredVersion) {
+		return skipError{fmt.Sprintf("Plugin API version %s does not include %s, which was added in version %s", harness.report.APIVersion, command, commandVersion)}
+	}
+	return nil
+}
+
+func (harness *Harness) checkBackupFile() error {
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_%s_report", harness.Timestamp))
+	harness.fileContents = []byte(fmt.Sprintf("Backup file written by the plugin conformance harness at %s\n", harness.Timestamp))
+	err := os.MkdirAll(harness.backupDir, 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filename, harness.fileContents, 0644)
+	if err != nil {
+		return err
+	}
+	err = harness.runCommand(nil, ioutil.Discard, "backup_file", harness.ConfigPath, filename)
+	if err != nil {
+		return err
+	}
+	// gpbackup still reads some files after they are backed up, so they must be left in place
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil || !bytes.Equal(contents, harness.fileContents) {
+		return errors.Errorf("backup_file did not leave the local copy of %s unchanged", filename)
+	}
+	return nil
+}
+
+func (harness *Harness) checkRestoreFile() error {
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_%s_report", harness.Timestamp))
+	err := os.Remove(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	err = harness.runCommand(nil, ioutil.Discard, "restore_file", harness.ConfigPath, filename)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Errorf("restore_file did not write %s: %v", filename, err)
+	}
+	if !bytes.Equal(contents, harness.fileContents) {
+		return errors.Errorf("Contents of %s restored by restore_file do not match the contents backed up", filename)
+	}
+	return nil
+}
+
+func (harness *Harness) checkBackupData() error {
+	harness.dataContents = make([]byte, 64*1024)
+	rand.New(rand.NewSource(1)).Read(harness.dataContents)
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16384", harness.Timestamp))
+	return harness.runCommand(bytes.NewReader(harness.dataContents), ioutil.Discard, "backup_data", harness.ConfigPath, filename)
+}
+
+func (harness *Harness) checkRestoreData() error {
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16384", harness.Timestamp))
+	var stdout bytes.Buffer
+	err := harness.runCommand(nil, &stdout, "restore_data", harness.ConfigPath, filename)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stdout.Bytes(), harness.dataContents) {
+		return errors.Errorf("restore_data returned %d bytes that do not match the %d bytes backed up", stdout.Len(), len(harness.dataContents))
+	}
+	return nil
+}
+
+/*
+ * Reads a range from the middle of the data as well as an empty range, as
+ * gprestore does for tables with no data.
+ */
+func (harness *Harness) checkRestoreDataRange() error {
+	err := harness.supportsCommand("restore_data_range", utils.RestoreDataRangePluginVersion)
+	if err != nil {
+		return err
+	}
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16384", harness.Timestamp))
+	ranges := [][2]int{{1000, 5000}, {len(harness.dataContents), len(harness.dataContents)}}
+	for _, byteRange := range ranges {
+		var stdout bytes.Buffer
+		err := harness.runCommand(nil, &stdout, "restore_data_range", harness.ConfigPath, filename, strconv.Itoa(byteRange[0]), strconv.Itoa(byteRange[1]))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(stdout.Bytes(), harness.dataContents[byteRange[0]:byteRange[1]]) {
+			return errors.Errorf("restore_data_range for bytes %d to %d returned %d bytes that do not match the data backed up", byteRange[0], byteRange[1], stdout.Len())
+		}
+	}
+	return nil
+}
+
+/*
+ * The large input checks stream the data through the plugin without holding
+ * it in memory, comparing checksums instead, so that plugins which buffer
+ * whole files or truncate long streams are caught.
+ */
+func (harness *Harness) checkBackupLargeData() error {
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16385", harness.Timestamp))
+	hash := sha256.New()
+	data := io.TeeReader(io.LimitReader(rand.New(rand.NewSource(2)), harness.LargeDataSize), hash)
+	err := harness.runCommand(data, ioutil.Discard, "backup_data", harness.ConfigPath, filename)
+	if err != nil {
+		return err
+	}
+	harness.largeDataHash = hash.Sum(nil)
+	return nil
+}
+
+func (harness *Harness) checkRestoreLargeData() error {
+	if harness.largeDataHash == nil {
+		return errors.New("No large data was backed up to restore")
+	}
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16385", harness.Timestamp))
+	hash := sha256.New()
+	counter := &byteCounter{writer: hash}
+	err := harness.runCommand(nil, counter, "restore_data", harness.ConfigPath, filename)
+	if err != nil {
+		return err
+	}
+	if counter.count != harness.LargeDataSize {
+		return errors.Errorf("restore_data returned %d bytes, but %d bytes were backed up", counter.count, harness.LargeDataSize)
+	}
+	if !bytes.Equal(hash.Sum(nil), harness.largeDataHash) {
+		return errors.New("Checksum of the data returned by restore_data does not match the data backed up")
+	}
+	return nil
+}
+
+type byteCounter struct {
+	writer io.Writer
+	count  int64
+}
+
+func (counter *byteCounter) Write(p []byte) (int, error) {
+	counter.count += int64(len(p))
+	return counter.writer.Write(p)
+}
+
+/*
+ * gpbackup and gprestore rely on a non-zero exit code to detect plugin
+ * failures, and report the plugin's stderr to the user.
+ */
+func (harness *Harness) checkErrorPropagation() error {
+	failures := make([]string, 0)
+	missingFile := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_99999", harness.Timestamp))
+
+	cmd := exec.Command(harness.PluginPath, "restore_data", harness.ConfigPath, missingFile)
+	var stderr bytes.Buffer
+	cmd.Stdout = ioutil.Discard
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err == nil {
+		failures = append(failures, "restore_data of a nonexistent file exited with status 0")
+	} else if strings.TrimSpace(stderr.String()) == "" {
+		failures = append(failures, "restore_data of a nonexistent file wrote no error message to stderr")
+	}
+	if err := harness.runCommand(nil, ioutil.Discard, "restore_file", harness.ConfigPath, missingFile); err == nil {
+		failures = append(failures, "restore_file of a nonexistent file exited with status 0")
+	}
+	_ = os.Remove(missingFile)
+	if err := harness.runCommand(nil, ioutil.Discard, "unknown_command", harness.ConfigPath); err == nil {
+		failures = append(failures, "An unknown command exited with status 0")
+	}
+
+	if len(failures) > 0 {
+		return errors.New(strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+func (harness *Harness) listBackups() ([]string, error) {
+	output, err := harness.getCommandOutput("list_backups", harness.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	timestamps := strings.Fields(output)
+	for _, timestamp := range timestamps {
+		if !filepath.IsValidTimestamp(timestamp) {
+			return nil, errors.Errorf("list_backups returned invalid timestamp %s", timestamp)
+		}
+	}
+	return timestamps, nil
+}
+
+func (harness *Harness) checkListBackups() error {
+	err := harness.supportsCommand("list_backups", utils.ListBackupsPluginVersion)
+	if err != nil {
+		return err
+	}
+	timestamps, err := harness.listBackups()
+	if err != nil {
+		return err
+	}
+	if !utils.NewSet(timestamps).MatchesFilter(harness.Timestamp) {
+		return errors.Errorf("list_backups did not include the backup with timestamp %s", harness.Timestamp)
+	}
+	return nil
+}
+
+func (harness *Harness) checkDeleteBackup() error {
+	err := harness.supportsCommand("delete_backup", utils.DeleteBackupPluginVersion)
+	if err != nil {
+		return err
+	}
+	err = harness.runCommand(nil, ioutil.Discard, "delete_backup", harness.ConfigPath, harness.Timestamp)
+	if err != nil {
+		return err
+	}
+	filename := harness.getFilePath(fmt.Sprintf("gpbackup_0_%s_16384", harness.Timestamp))
+	if harness.runCommand(nil, ioutil.Discard, "restore_data", harness.ConfigPath, filename) == nil {
+		return errors.Errorf("restore_data succeeded for %s after delete_backup", filename)
+	}
+	if harness.supportsCommand("list_backups", utils.ListBackupsPluginVersion) == nil {
+		timestamps, err := harness.listBackups()
+		if err != nil {
+			return err
+		}
+		if utils.NewSet(timestamps).MatchesFilter(harness.Timestamp) {
+			return errors.Errorf("list_backups still included the backup with timestamp %s after delete_backup", harness.Timestamp)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package conformance_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/plugins/conformance"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("conformance harness tests", func() {
+	var workDir string
+	var configPath string
+	BeforeEach(func() {
+		workDir, _ = ioutil.TempDir("", "harness_test")
+		configPath = path.Join(workDir, "plugin_config.yaml")
+		Expect(ioutil.WriteFile(configPath, []byte("executablepath: plugin\n"), 0644)).To(Succeed())
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(workDir)
+	})
+	getStatuses := func(report *conformance.Report) map[string]conformance.Status {
+		statuses := make(map[string]conformance.Status)
+		for _, result := range report.Results {
+			statuses[result.Name] = result.Status
+		}
+		return statuses
+	}
+
+	Describe("Run", func() {
+		It("passes every check for the example plugin", func() {
+			examplePlugin, _ := path.Abs("../example_plugin.bash")
+			destination := path.Join(workDir, "plugin_dest")
+			Expect(ioutil.WriteFile(configPath, []byte("executablepath: "+examplePlugin+"\noptions:\n  destination: "+destination+"\n"), 0644)).To(Succeed())
+			harness := conformance.NewHarness(examplePlugin, configPath, workDir)
+			harness.LargeDataSize = 1024 * 1024
+
+			report := harness.Run()
+
+			for _, result := range report.Results {
+				Expect(result.Status).To(Equal(conformance.PASSED), "%s: %s", result.Name, result.Message)
+			}
+			Expect(destination).To(BeADirectory())
+			Expect(report.Results).To(HaveLen(16))
+			Expect(report.APIVersion).To(Equal("0.6.0"))
+			Expect(report.PluginVersion).To(Equal("example_plugin version 1.1.0"))
+		})
+		It("reports the checks that a nonconforming plugin fails", func() {
+			brokenPlugin := path.Join(workDir, "broken_plugin.bash")
+			Expect(ioutil.WriteFile(brokenPlugin, []byte(`#!/bin/bash
+case "$1" in
+  plugin_api_version) echo "0.3.0" ;;
+  --version) echo "broken_plugin 1.0.0" ;;
+  backup_data) head -c 100 > /dev/null ;;
+  restore_data) head -c 10 /dev/zero ;;
+  restore_file) touch "$3" ;;
+esac
+exit 0
+`), 0755)).To(Succeed())
+			harness := conformance.NewHarness(brokenPlugin, configPath, workDir)
+			harness.LargeDataSize = 1024 * 1024
+
+			report := harness.Run()
+
+			Expect(report.Passed()).To(BeFalse())
+			Expect(getStatuses(report)).To(Equal(map[string]conformance.Status{
+				"plugin_api_version":            conformance.PASSED,
+				"--version":                     conformance.FAILED,
+				"setup_plugin_for_backup":       conformance.PASSED,
+				"backup_file":                   conformance.PASSED,
+				"backup_data":                   conformance.PASSED,
+				"backup_data with large input":  conformance.PASSED,
+				"cleanup_plugin_for_backup":     conformance.PASSED,
+				"setup_plugin_for_restore":      conformance.PASSED,
+				"restore_file":                  conformance.FAILED,
+				"restore_data":                  conformance.FAILED,
+				"restore_data_range":            conformance.SKIPPED,
+				"restore_data with large input": conformance.FAILED,
+				"error propagation":             conformance.FAILED,
+				"cleanup_plugin_for_restore":    conformance.PASSED,
+				"list_backups":                  conformance.SKIPPED,
+				"delete_backup":                 conformance.SKIPPED,
+			}))
+			Expect(report.GetResult("restore_data with large input").Message).To(Equal("restore_data returned 10 bytes, but 1048576 bytes were backed up"))
+			Expect(report.GetResult("error propagation").Message).To(Equal("restore_data of a nonexistent file exited with status 0; " +
+				"restore_file of a nonexistent file exited with status 0; An unknown command exited with status 0"))
+			Expect(report.GetResult("delete_backup").Message).To(Equal("Plugin API version 0.3.0 does not include delete_backup, which was added in version 0.4.0"))
+		})
+	})
+	Describe("Report", func() {
+		It("writes a summary of the results", func() {
+			report := &conformance.Report{
+				PluginPath:    "/a/b/myPlugin",
+				APIVersion:    "0.3.0",
+				PluginVersion: "myPlugin version 1.2.3",
+				Timestamp:     "20200101010101",
+			}
+			report.AddResult(conformance.Result{Name: "plugin_api_version", Status: conformance.PASSED, Duration: 5 * time.Millisecond})
+			report.AddResult(conformance.Result{Name: "restore_data", Status: conformance.FAILED, Message: "data mismatch", Duration: time.Second})
+			report.AddResult(conformance.Result{Name: "delete_backup", Status: conformance.SKIPPED, Message: "not supported"})
+			buffer := &bytes.Buffer{}
+
+			report.Write(buffer)
+
+			Expect(buffer.String()).To(Equal(`gpbackup plugin API conformance report
+
+Plugin executable: /a/b/myPlugin
+Plugin version: myPlugin version 1.2.3
+Plugin API version: 0.3.0
+Test timestamp: 20200101010101
+
+[PASSED] plugin_api_version (5ms)
+[FAILED] restore_data (1s)
+    data mismatch
+[SKIPPED] delete_backup (0s)
+    not supported
+
+1 passed, 1 failed, 1 skipped
+Plugin does not conform to the gpbackup plugin API
+`))
+		})
+	})
+})
@@ -0,0 +1,83 @@
+package conformance
+
+/*
+ * This file contains the report produced by a conformance run, recording
+ * whether each plugin command behaved as the plugin API requires.
+ */
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+type Status string
+
+const (
+	PASSED  Status = "PASSED"
+	FAILED  Status = "FAILED"
+	SKIPPED Status = "SKIPPED"
+)
+
+type Result struct {
+	Name     string
+	Status   Status
+	Message  string
+	Duration time.Duration
+}
+
+type Report struct {
+	PluginPath    string
+	APIVersion    string
+	PluginVersion string
+	Timestamp     string
+	Results       []Result
+}
+
+func (report *Report) AddResult(result Result) {
+	report.Results = append(report.Results, result)
+}
+
+func (report *Report) GetResult(name string) *Result {
+	for i := range report.Results {
+		if report.Results[i].Name == name {
+			return &report.Results[i]
+		}
+	}
+	return nil
+}
+
+/*
+ * A plugin conforms to the API if no check failed; checks are skipped only
+ * for commands added in API versions newer than the plugin's.
+ */
+func (report *Report) Passed() bool {
+	for _, result := range report.Results {
+		if result.Status == FAILED {
+			return false
+		}
+	}
+	return true
+}
+
+func (report *Report) Write(writer io.Writer) {
+	counts := make(map[Status]int)
+	_, _ = fmt.Fprintf(writer, "gpbackup plugin API conformance report\n\n")
+	_, _ = fmt.Fprintf(writer, "Plugin executable: %s\n", report.PluginPath)
+	_, _ = fmt.Fprintf(writer, "Plugin version: %s\n", report.PluginVersion)
+	_, _ = fmt.Fprintf(writer, "Plugin API version: %s\n", report.APIVersion)
+	_, _ = fmt.Fprintf(writer, "Test timestamp: %s\n\n", report.Timestamp)
+	for _, result := range report.Results {
+		counts[result.Status]++
+		_, _ = fmt.Fprintf(writer, "[%s] %s (%s)\n", result.Status, result.Name, result.Duration.Round(time.Millisecond))
+		if result.Message != "" {
+			_, _ = fmt.Fprintf(writer, "    %s\n", result.Message)
+		}
+	}
+	_, _ = fmt.Fprintf(writer, "\n%d passed, %d failed, %d skipped\n", counts[PASSED], counts[FAILED], counts[SKIPPED])
+	if report.Passed() {
+		_, _ = fmt.Fprintf(writer, "Plugin conforms to the gpbackup plugin API\n")
+	} else {
+		_, _ = fmt.Fprintf(writer, "Plugin does not conform to the gpbackup plugin API\n")
+	}
+}
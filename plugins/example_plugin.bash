@@ -1,8 +1,16 @@
 #!/bin/bash
 set -e
 
+# Files are stored in the directory given by the destination option in the
+# plugin config file, or in /tmp/plugin_dest if none is given.
+get_destination(){
+  destination=`sed -n 's/^ *destination: *//p' "$1" 2>/dev/null`
+  echo "${destination:-/tmp/plugin_dest}"
+}
+
 setup_plugin_for_backup(){
   echo "setup_plugin_for_backup $1 $2 $3 $4" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   if [ "$3" = "master" ]
     then echo "setup_plugin_for_backup was called for scope = master" >> /tmp/plugin_out.txt
   elif [ "$3" = "segment_host" ]
@@ -12,7 +20,7 @@ setup_plugin_for_backup(){
   fi
   timestamp_dir=`basename "$2"`
   timestamp_day_dir=${timestamp_dir%??????}
-  mkdir -p /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir
+  mkdir -p $destination/$timestamp_day_dir/$timestamp_dir
 }
 
 setup_plugin_for_restore(){
@@ -50,49 +58,69 @@ cleanup_plugin_for_restore(){
 
 restore_file() {
   echo "restore_file $1 $2" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   filename=`basename "$2"`
   timestamp_dir=`basename $(dirname "$2")`
   timestamp_day_dir=${timestamp_dir%??????}
-	cat /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename > $2
+	cat $destination/$timestamp_day_dir/$timestamp_dir/$filename > $2
 }
 
 backup_file() {
   echo "backup_file $1 $2" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   filename=`basename "$2"`
   timestamp_dir=`basename $(dirname "$2")`
   timestamp_day_dir=${timestamp_dir%??????}
-	cat $2 > /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename
+	cat $2 > $destination/$timestamp_day_dir/$timestamp_dir/$filename
 }
 
 backup_data() {
   echo "backup_data $1 $2" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   filename=`basename "$2"`
   timestamp_dir=`basename $(dirname "$2")`
   timestamp_day_dir=${timestamp_dir%??????}
-	cat - > /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename
+	cat - > $destination/$timestamp_day_dir/$timestamp_dir/$filename
 }
 
 restore_data() {
   echo "restore_data $1 $2" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   filename=`basename "$2"`
   timestamp_dir=`basename $(dirname "$2")`
   timestamp_day_dir=${timestamp_dir%??????}
-	cat /tmp/plugin_dest/$timestamp_day_dir/$timestamp_dir/$filename
+	cat $destination/$timestamp_day_dir/$timestamp_dir/$filename
+}
+
+restore_data_range() {
+  echo "restore_data_range $1 $2 $3 $4" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
+  filename=`basename "$2"`
+  timestamp_dir=`basename $(dirname "$2")`
+  timestamp_day_dir=${timestamp_dir%??????}
+	tail -c +$(($3 + 1)) $destination/$timestamp_day_dir/$timestamp_dir/$filename | head -c $(($4 - $3))
 }
 
 delete_backup() {
   echo "delete_backup $1 $2" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
   timestamp_day_dir=${2%??????}
-  rm -rf /tmp/plugin_dest/$timestamp_day_dir/$2
-  if [ -z "$(ls -A /tmp/plugin_dest/$timestamp_day_dir/)" ] ; then
-    rm -rf /tmp/plugin_dest/$timestamp_day_dir
+  rm -rf $destination/$timestamp_day_dir/$2
+  if [ -z "$(ls -A $destination/$timestamp_day_dir/)" ] ; then
+    rm -rf $destination/$timestamp_day_dir
   fi
 
 }
 
+list_backups() {
+  echo "list_backups $1" >> /tmp/plugin_out.txt
+  destination=`get_destination "$1"`
+  ls -d $destination/*/* 2>/dev/null | xargs -r -n 1 basename
+}
+
 plugin_api_version(){
-  echo "0.4.0"
-  echo "0.4.0" >> /tmp/plugin_out.txt
+  echo "0.6.0"
+  echo "0.6.0" >> /tmp/plugin_out.txt
 }
 
 --version(){
@@ -174,6 +174,18 @@ if [ -n "$secondary_plugin_config" ]; then
     exit 1
   fi
 fi
+
+if (( 1 == $(echo "0.6.0 $api_version" | awk '{print ($1 > $2)}') )) ; then
+  echo "[SKIPPING] restore_data_range (only compatible with version >= 0.6.0)"
+else
+  echo "[RUNNING] restore_data_range"
+  output=`$plugin restore_data_range $plugin_config $testdata 100 200`
+  if [ "$output" != "${data:100:100}" ]; then
+    echo "Failed to restore a range of data using plugin"
+    exit 1
+  fi
+  echo "[PASSED] restore_data_range"
+fi
 echo "[PASSED] backup_data"
 echo "[PASSED] restore_data"
 cleanup_test_dir $testdir
@@ -290,6 +302,22 @@ fi
 
 set -e
 echo "[PASSED] delete_backup"
+
+if (( 1 == $(echo "0.5.0 $api_version" | awk '{print ($1 > $2)}') )) ; then
+  echo "[SKIPPING] list_backups (only compatible with version >= 0.5.0)"
+else
+  echo "[RUNNING] list_backups"
+  backup_list=$($plugin list_backups $plugin_config)
+  if ! echo "$backup_list" | grep -qx "$time_second_for_del2" ; then
+    echo "Failed to list backup $time_second_for_del2 using plugin"
+    exit 1
+  fi
+  if echo "$backup_list" | grep -qx "$time_second_for_del" ; then
+    echo "Listed deleted backup $time_second_for_del using plugin"
+    exit 1
+  fi
+  echo "[PASSED] list_backups"
+fi
 cleanup_test_dir $testdir_for_del
 
 
@@ -0,0 +1,215 @@
+package report
+
+/*
+ * This file contains structs and functions related to sending notifications
+ * about completed backups and restores to webhook, syslog, and file targets.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/syslog"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	NOTIFY_WEBHOOK = "webhook"
+	NOTIFY_SYSLOG  = "syslog"
+	NOTIFY_FILE    = "file"
+)
+
+var webhookTimeout = 30 * time.Second
+
+type NotificationFile struct {
+	Notifications map[string][]NotificationTarget
+}
+
+/*
+ * Status is keyed on the same exit status names as the email contacts file.
+ * Only the fields relevant to a target's Type are used: URL and Headers for
+ * webhooks, Network, Address, and Tag for syslog, and Directory for files.
+ */
+type NotificationTarget struct {
+	Type      string
+	Status    map[string]bool
+	URL       string
+	Headers   map[string]string
+	Network   string
+	Address   string
+	Tag       string
+	Directory string
+}
+
+type NotificationPayload struct {
+	Utility    string `json:"utility"`
+	Timestamp  string `json:"timestamp"`
+	Hostname   string `json:"hostname"`
+	ExitStatus string `json:"exit_status"`
+	ReportFile string `json:"report_file"`
+	Report     string `json:"report"`
+}
+
+func GetNotificationTargets(filename string, utility string) ([]NotificationTarget, error) {
+	notificationFile := &NotificationFile{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, notificationFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse notifications file %s", filename)
+	}
+
+	exitStatus := utils.GetExitStatus()
+
+	targets := make([]NotificationTarget, 0)
+	for _, target := range notificationFile.Notifications[utility] {
+		switch target.Type {
+		case NOTIFY_WEBHOOK, NOTIFY_SYSLOG, NOTIFY_FILE:
+		default:
+			return nil, errors.Errorf("Invalid notification type %s in %s; valid types are %s, %s, and %s", target.Type, filename, NOTIFY_WEBHOOK, NOTIFY_SYSLOG, NOTIFY_FILE)
+		}
+		if target.Status[exitStatus] {
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
+
+func ConstructNotificationPayload(timestamp string, reportFilePath string, utility string) NotificationPayload {
+	hostname, _ := operating.System.Hostname()
+	return NotificationPayload{
+		Utility:    utility,
+		Timestamp:  timestamp,
+		Hostname:   hostname,
+		ExitStatus: utils.GetExitStatus(),
+		ReportFile: reportFilePath,
+		Report:     strings.Join(iohelper.MustReadLinesFromFile(reportFilePath), "\n"),
+	}
+}
+
+func (target NotificationTarget) Send(payload NotificationPayload) error {
+	switch target.Type {
+	case NOTIFY_WEBHOOK:
+		return target.sendWebhook(payload)
+	case NOTIFY_SYSLOG:
+		return target.sendSyslog(payload)
+	case NOTIFY_FILE:
+		return target.writeFile(payload)
+	}
+	return errors.Errorf("Invalid notification type %s", target.Type)
+}
+
+func (target NotificationTarget) sendWebhook(payload NotificationPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range target.Headers {
+		request.Header.Set(key, value)
+	}
+	client := &http.Client{Timeout: webhookTimeout}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	_, _ = ioutil.ReadAll(response.Body)
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return errors.Errorf("Webhook %s returned status %s", target.URL, response.Status)
+	}
+	return nil
+}
+
+func (target NotificationTarget) sendSyslog(payload NotificationPayload) error {
+	priority := syslog.LOG_INFO
+	switch payload.ExitStatus {
+	case "success_with_errors":
+		priority = syslog.LOG_WARNING
+	case "failure":
+		priority = syslog.LOG_ERR
+	}
+	tag := target.Tag
+	if tag == "" {
+		tag = payload.Utility
+	}
+	// An empty network and address log to the local syslog daemon
+	writer, err := syslog.Dial(target.Network, target.Address, priority|syslog.LOG_USER, tag)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+	_, err = fmt.Fprintf(writer, "%s %s on %s completed with status %s; see report file %s",
+		payload.Utility, payload.Timestamp, payload.Hostname, payload.ExitStatus, payload.ReportFile)
+	return err
+}
+
+func (target NotificationTarget) writeFile(payload NotificationPayload) error {
+	contents, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	filename := filepath.Join(target.Directory, fmt.Sprintf("%s_%s_%s.json", payload.Utility, payload.Timestamp, payload.ExitStatus))
+	notificationFile, err := iohelper.OpenFileForWriting(filename)
+	if err != nil {
+		return err
+	}
+	_, err = notificationFile.Write(append(contents, '\n'))
+	if err != nil {
+		_ = notificationFile.Close()
+		return err
+	}
+	return notificationFile.Close()
+}
+
+/*
+ * Sends notifications to the targets configured for the utility and exit
+ * status in gp_notifications.yaml, which is looked up in the same locations
+ * as gp_email_contacts.yaml.  Notification failures are never fatal.
+ */
+func SendNotifications(timestamp string, reportFilePath string, utility string) {
+	notificationsFilename := "gp_notifications.yaml"
+	gphomeFile := fmt.Sprintf("%s/bin/%s", operating.System.Getenv("GPHOME"), notificationsFilename)
+	homeFile := fmt.Sprintf("%s/%s", operating.System.Getenv("HOME"), notificationsFilename)
+	if _, err := operating.System.Stat(homeFile); err == nil {
+		notificationsFilename = homeFile
+	} else if _, err := operating.System.Stat(gphomeFile); err == nil {
+		notificationsFilename = gphomeFile
+	} else {
+		gplog.Verbose("Found neither %s nor %s; no notifications will be sent", gphomeFile, homeFile)
+		return
+	}
+	targets, err := GetNotificationTargets(notificationsFilename, utility)
+	if err != nil {
+		gplog.Warn("Unable to send notifications: %v", err)
+		return
+	}
+	if len(targets) == 0 {
+		return
+	}
+	payload := ConstructNotificationPayload(timestamp, reportFilePath, utility)
+	for _, target := range targets {
+		gplog.Verbose("Sending %s notification for %s report %s", target.Type, utility, reportFilePath)
+		err = target.Send(payload)
+		if err != nil {
+			gplog.Warn("Unable to send %s notification: %v", target.Type, err)
+		}
+	}
+}
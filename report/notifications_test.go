@@ -0,0 +1,181 @@
+package report_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+
+	. "github.com/greenplum-db/gpbackup/report"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("report/notifications tests", func() {
+	var (
+		tempDir    string
+		reportFile string
+		payload    NotificationPayload
+	)
+	BeforeEach(func() {
+		operating.System = operating.InitializeSystemFunctions()
+		tempDir, _ = ioutil.TempDir("", "notifications")
+		reportFile = filepath.Join(tempDir, "gpbackup_20170101010101_report")
+		_ = ioutil.WriteFile(reportFile, []byte("Greenplum Database Backup Report\n\nTimestamp Key: 20170101010101\n"), 0644)
+		operating.System.Hostname = func() (string, error) { return "localhost", nil }
+		payload = ConstructNotificationPayload("20170101010101", reportFile, "gpbackup")
+	})
+	AfterEach(func() {
+		operating.System = operating.InitializeSystemFunctions()
+		_ = os.RemoveAll(tempDir)
+		gplog.SetErrorCode(0)
+	})
+	writeNotificationsFile := func(contents string) string {
+		filename := filepath.Join(tempDir, "gp_notifications.yaml")
+		_ = ioutil.WriteFile(filename, []byte(contents), 0644)
+		return filename
+	}
+	Describe("GetNotificationTargets", func() {
+		notificationsFileContents := `notifications:
+  gpbackup:
+  - type: webhook
+    url: http://localhost/notify
+    status:
+      success: true
+      failure: true
+  - type: file
+    directory: /tmp/notifications
+    status:
+      success_with_errors: true
+      failure: true
+  gprestore:
+  - type: syslog
+    status:
+      success: true
+`
+		It("gets the gpbackup targets for a success", func() {
+			filename := writeNotificationsFile(notificationsFileContents)
+			targets, err := GetNotificationTargets(filename, "gpbackup")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(HaveLen(1))
+			Expect(targets[0].Type).To(Equal(NOTIFY_WEBHOOK))
+			Expect(targets[0].URL).To(Equal("http://localhost/notify"))
+		})
+		It("gets the gpbackup targets for a failure", func() {
+			gplog.SetErrorCode(2)
+			filename := writeNotificationsFile(notificationsFileContents)
+			targets, err := GetNotificationTargets(filename, "gpbackup")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(HaveLen(2))
+			Expect(targets[1].Type).To(Equal(NOTIFY_FILE))
+			Expect(targets[1].Directory).To(Equal("/tmp/notifications"))
+		})
+		It("gets no gprestore targets for a status that is not specified", func() {
+			gplog.SetErrorCode(1)
+			filename := writeNotificationsFile(notificationsFileContents)
+			targets, err := GetNotificationTargets(filename, "gprestore")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(targets).To(BeEmpty())
+		})
+		It("returns an error for an invalid notification type", func() {
+			filename := writeNotificationsFile("notifications:\n  gpbackup:\n  - type: pager\n    status:\n      failure: true\n")
+			_, err := GetNotificationTargets(filename, "gpbackup")
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid notification type pager"))
+		})
+	})
+	Describe("NotificationTarget.Send", func() {
+		It("posts a JSON payload with the configured headers to a webhook", func() {
+			var received NotificationPayload
+			var authHeader string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				authHeader = r.Header.Get("Authorization")
+				_ = json.NewDecoder(r.Body).Decode(&received)
+			}))
+			defer server.Close()
+			target := NotificationTarget{Type: NOTIFY_WEBHOOK, URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+
+			err := target.Send(payload)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(authHeader).To(Equal("Bearer token"))
+			Expect(received).To(Equal(payload))
+			Expect(received.Report).To(Equal("Greenplum Database Backup Report\n\nTimestamp Key: 20170101010101"))
+		})
+		It("returns an error if a webhook does not return a success status", func() {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			}))
+			defer server.Close()
+			target := NotificationTarget{Type: NOTIFY_WEBHOOK, URL: server.URL}
+
+			err := target.Send(payload)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Webhook " + server.URL + " returned status 500 Internal Server Error"))
+		})
+		It("sends a message to a remote syslog server", func() {
+			listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+			Expect(err).ToNot(HaveOccurred())
+			defer listener.Close()
+			target := NotificationTarget{Type: NOTIFY_SYSLOG, Network: "udp", Address: listener.LocalAddr().String()}
+
+			err = target.Send(payload)
+
+			Expect(err).ToNot(HaveOccurred())
+			message := make([]byte, 1024)
+			n, _, err := listener.ReadFrom(message)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(message[:n])).To(ContainSubstring("gpbackup 20170101010101 on localhost completed with status success; see report file " + reportFile))
+		})
+		It("writes the payload to a file in the configured directory", func() {
+			target := NotificationTarget{Type: NOTIFY_FILE, Directory: tempDir}
+
+			err := target.Send(payload)
+
+			Expect(err).ToNot(HaveOccurred())
+			contents, err := ioutil.ReadFile(filepath.Join(tempDir, "gpbackup_20170101010101_success.json"))
+			Expect(err).ToNot(HaveOccurred())
+			var written NotificationPayload
+			Expect(json.Unmarshal(contents, &written)).To(Succeed())
+			Expect(written).To(Equal(payload))
+		})
+	})
+	Describe("SendNotifications", func() {
+		It("sends notifications to targets in $HOME/gp_notifications.yaml", func() {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+			}))
+			defer server.Close()
+			writeNotificationsFile("notifications:\n  gpbackup:\n  - type: webhook\n    url: " + server.URL + "\n    status:\n      success: true\n")
+			operating.System.Getenv = func(key string) string { return tempDir }
+
+			SendNotifications("20170101010101", reportFile, "gpbackup")
+
+			Expect(requests).To(Equal(1))
+		})
+		It("sends no notifications if no gp_notifications.yaml file is found", func() {
+			operating.System.Getenv = func(key string) string { return tempDir }
+
+			SendNotifications("20170101010101", reportFile, "gpbackup")
+
+			Expect(logfile).To(Say("no notifications will be sent"))
+		})
+		It("logs a warning if a notification cannot be sent", func() {
+			writeNotificationsFile("notifications:\n  gpbackup:\n  - type: webhook\n    url: http://127.0.0.1:1/notify\n    status:\n      success: true\n")
+			operating.System.Getenv = func(key string) string { return tempDir }
+
+			SendNotifications("20170101010101", reportFile, "gpbackup")
+
+			Expect(stdout).To(Say("Unable to send webhook notification"))
+		})
+	})
+})
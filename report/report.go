@@ -90,15 +90,22 @@ func (report *Report) ConstructBackupParamsString() {
 	if report.WithStatistics {
 		statsStr = "Yes"
 	}
+	throttleStr := ""
+	if throttle := utils.GetDataThrottle(); throttle.BytesPerSecond > 0 && !report.MetadataOnly {
+		throttleStr = fmt.Sprintf("bandwidth limit: %s\n", throttle.String())
+		if rate := utils.GetDataTransfer().String(); rate != "" {
+			throttleStr += fmt.Sprintf("effective rate: %s\n", rate)
+		}
+	}
 	backupParamsTemplate := `compression: %s
 plugin executable: %s
 backup section: %s
 object filtering: %s
 includes statistics: %s
 data file format: %s
-%s`
+%s%s`
 	report.BackupParamsString = fmt.Sprintf(backupParamsTemplate, compressStr, pluginStr, sectionStr, filterStr,
-		statsStr, filesStr, report.constructIncrementalSection())
+		statsStr, filesStr, throttleStr, report.constructIncrementalSection())
 }
 
 func (report *Report) constructIncrementalSection() string {
@@ -132,6 +139,9 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 		LineInfo{Key: "database name:", Value: report.DatabaseName},
 		LineInfo{Key: "command line:", Value: gpbackupCommandLine},
 	)
+	if len(report.EffectiveFlags) > 0 {
+		reportInfo = append(reportInfo, LineInfo{Key: "effective flags:", Value: FormatEffectiveFlags(report.EffectiveFlags)})
+	}
 
 	AppendBackupParams(&reportInfo, report.BackupParamsString)
 
@@ -172,7 +182,7 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
-func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string) {
+func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string, rejectedRows map[string]int64, tableOverrides map[string]string, effectiveFlags map[string]string) {
 	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
 	if err != nil {
 		gplog.Error("Unable to open restore report file %s", reportFilename)
@@ -184,17 +194,33 @@ func WriteRestoreReportFile(reportFilename string, backupTimestamp string, start
 
 	utils.MustPrintf(reportFile, "Greenplum Database Restore Report\n\n")
 
+	// The blank line that ends this section follows the effective flags, if there are any
+	commandLineValue := fmt.Sprintf("%s\n", gprestoreCommandLine)
+	if len(effectiveFlags) > 0 {
+		commandLineValue = gprestoreCommandLine
+	}
 	reportInfo := make([]LineInfo, 0)
 	reportInfo = append(reportInfo,
 		LineInfo{Key: "timestamp key:", Value: backupTimestamp},
 		LineInfo{Key: "gpdb version:", Value: connectionPool.Version.VersionString},
 		LineInfo{Key: "gprestore version:", Value: fmt.Sprintf("%s\n", restoreVersion)},
 		LineInfo{Key: "database name:", Value: connectionPool.DBName},
-		LineInfo{Key: "command line:", Value: fmt.Sprintf("%s\n", gprestoreCommandLine)},
+		LineInfo{Key: "command line:", Value: commandLineValue},
+	)
+	if len(effectiveFlags) > 0 {
+		reportInfo = append(reportInfo, LineInfo{Key: "effective flags:", Value: fmt.Sprintf("%s\n", FormatEffectiveFlags(effectiveFlags))})
+	}
+	reportInfo = append(reportInfo,
 		LineInfo{Key: "start time:", Value: start},
 		LineInfo{Key: "end time:", Value: end},
 		LineInfo{Key: "duration:", Value: duration},
 	)
+	if throttle := utils.GetDataThrottle(); throttle.BytesPerSecond > 0 {
+		reportInfo = append(reportInfo, LineInfo{Key: "bandwidth limit:", Value: throttle.String()})
+		if rate := utils.GetDataTransfer().String(); rate != "" {
+			reportInfo = append(reportInfo, LineInfo{Key: "effective rate:", Value: rate})
+		}
+	}
 
 	var restoreStatus string
 	errorCode := gplog.GetErrorCode()
@@ -216,11 +242,31 @@ func WriteRestoreReportFile(reportFilename string, backupTimestamp string, start
 
 	logOutputReport(reportFile, reportInfo)
 
+	if len(rejectedRows) > 0 {
+		PrintRejectedRowCounts(reportFile, rejectedRows)
+	}
+	if len(tableOverrides) > 0 {
+		PrintTableOverrides(reportFile, tableOverrides)
+	}
+
 	err = reportFile.Close()
 	gplog.FatalOnError(err)
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
+func FormatEffectiveFlags(effectiveFlags map[string]string) string {
+	flagNames := make([]string, 0, len(effectiveFlags))
+	for name := range effectiveFlags {
+		flagNames = append(flagNames, name)
+	}
+	sort.Strings(flagNames)
+	flagStrs := make([]string, 0, len(flagNames))
+	for _, name := range flagNames {
+		flagStrs = append(flagStrs, fmt.Sprintf("--%s=%s", name, effectiveFlags[name]))
+	}
+	return strings.Join(flagStrs, " ")
+}
+
 func logOutputReport(reportFile io.WriteCloser, reportInfo []LineInfo) {
 	maxSize := 0
 	for _, lineInfo := range reportInfo {
@@ -278,6 +324,40 @@ func PrintObjectCounts(reportFile io.WriteCloser, objectCounts map[string]int) {
 	utils.MustPrintf(reportFile, objectStr)
 }
 
+func PrintRejectedRowCounts(reportFile io.WriteCloser, rejectedRows map[string]int64) {
+	rejectedStr := "\ncount of rows rejected during data restore:\n"
+	tableSlice := make([]string, 0)
+	maxSize := 0
+	for k := range rejectedRows {
+		tableSlice = append(tableSlice, k)
+		if len(k) > maxSize {
+			maxSize = len(k)
+		}
+	}
+	sort.Strings(tableSlice)
+	for _, table := range tableSlice {
+		rejectedStr += fmt.Sprintf("%-*s%d\n", maxSize+3, table, rejectedRows[table])
+	}
+	utils.MustPrintf(reportFile, rejectedStr)
+}
+
+func PrintTableOverrides(reportFile io.WriteCloser, tableOverrides map[string]string) {
+	overridesStr := "\ntables restored with storage or distribution overrides:\n"
+	tableSlice := make([]string, 0)
+	maxSize := 0
+	for k := range tableOverrides {
+		tableSlice = append(tableSlice, k)
+		if len(k) > maxSize {
+			maxSize = len(k)
+		}
+	}
+	sort.Strings(tableSlice)
+	for _, table := range tableSlice {
+		overridesStr += fmt.Sprintf("%-*s%s\n", maxSize+3, table, tableOverrides[table])
+	}
+	utils.MustPrintf(reportFile, "%s", overridesStr)
+}
+
 /*
  * This function will not error out if the user has gprestore X.Y.Z
  * and gpbackup X.Y.Z+dev, when technically the uncommitted code changes
@@ -299,6 +379,13 @@ func EnsureBackupVersionCompatibility(backupVersion string, restoreVersion strin
 	}
 }
 
+func EnsureDataFormatCompatibility(dataFormatVersion int, restoreVersion string) {
+	if dataFormatVersion > history.MAX_DATA_FORMAT_VERSION {
+		gplog.Fatal(errors.Errorf("gprestore %s cannot read data format version %d of this backup; please use a newer gprestore.",
+			restoreVersion, dataFormatVersion), "")
+	}
+}
+
 func EnsureDatabaseVersionCompatibility(backupGPDBVersion string, restoreGPDBVersion dbconn.GPDBVersion) {
 	pattern := regexp.MustCompile(`\d+\.\d+\.\d+`)
 	threeDigitVersion := pattern.FindStringSubmatch(backupGPDBVersion)[0]
@@ -329,13 +416,7 @@ func GetContacts(filename string, utility string) string {
 		return ""
 	}
 
-	errorCode := gplog.GetErrorCode()
-	exitStatus := "success"
-	if errorCode == 1 {
-		exitStatus = "success_with_errors"
-	} else if errorCode == 2 {
-		exitStatus = "failure"
-	}
+	exitStatus := utils.GetExitStatus()
 
 	contactList := make([]string, 0)
 	for _, contact := range contactFile.Contacts[utility] {
@@ -149,6 +149,33 @@ count of database objects in backup:
 sequences   1
 tables      42
 types       1000`))
+		})
+		It("writes a report with the effective flags of the backup", func() {
+			backupReport.EffectiveFlags = map[string]string{"dbname": "testdb", "config": "/home/gpadmin/backup.yaml"}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`command line:          .*
+effective flags:       --config=/home/gpadmin/backup.yaml --dbname=testdb
+compression:           gzip`))
+		})
+		It("writes a report with the bandwidth limit of the backup", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			defer utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			backupReport.ConstructBackupParamsString()
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`data file format:      Multiple Data Files Per Segment
+bandwidth limit:       1\.00 MiB/s per segment
+incremental:           False`))
+		})
+		It("writes a report with the effective rate of the backup", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			utils.SetDataTransfer(utils.DataTransfer{NumBytes: 3 * 1048576, NumSegments: 2, Elapsed: 2 * time.Second})
+			defer utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			defer utils.SetDataTransfer(utils.DataTransfer{})
+			backupReport.ConstructBackupParamsString()
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`bandwidth limit:       1\.00 MiB/s per segment
+effective rate:        768\.00 KiB/s per segment
+incremental:           False`))
 		})
 		It("writes a report without database size information", func() {
 			backupReport.DatabaseSize = ""
@@ -239,7 +266,7 @@ incremental backup set:
 
 		It("writes a report for a failed restore", func() {
 			gplog.SetErrorCode(2)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied", nil, nil, nil)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -258,7 +285,7 @@ restore error:       Cannot access /tmp/backups: Permission denied`))
 		})
 		It("writes a report for a successful restore", func() {
 			gplog.SetErrorCode(0)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, nil, nil)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -276,7 +303,7 @@ restore status:      Success`))
 		})
 		It("writes a report for a successful restore with errors", func() {
 			gplog.SetErrorCode(1)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, nil, nil)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -292,6 +319,57 @@ duration:            4:03:01
 
 restore status:      Success but non-fatal errors occurred. See log file .+ for details.`))
 		})
+		It("writes a report with the count of rows rejected for each table", func() {
+			gplog.SetErrorCode(0)
+			rejectedRows := map[string]int64{"public.foo": 3, "public.a_long_table_name": 12}
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", rejectedRows, nil, nil)
+			Expect(buffer).To(Say(`restore status:      Success
+
+count of rows rejected during data restore:
+public.a_long_table_name   12
+public.foo                 3`))
+		})
+		It("writes a report with the overrides applied to each table", func() {
+			gplog.SetErrorCode(0)
+			tableOverrides := map[string]string{"public.foo": "DISTRIBUTED RANDOMLY", "public.a_long_table_name": "storage appendoptimized=true, DISTRIBUTED BY (id)"}
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, tableOverrides, nil)
+			Expect(buffer).To(Say(`restore status:      Success
+
+tables restored with storage or distribution overrides:
+public.a_long_table_name   storage appendoptimized=true, DISTRIBUTED BY \(id\)
+public.foo                 DISTRIBUTED RANDOMLY`))
+		})
+		It("writes a report with the bandwidth limit of the restore", func() {
+			gplog.SetErrorCode(0)
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			defer utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, nil, nil)
+			Expect(buffer).To(Say(`duration:            4:03:01
+bandwidth limit:     1\.00 MiB/s per segment
+
+restore status:      Success`))
+		})
+		It("writes a report with the effective rate of the restore", func() {
+			gplog.SetErrorCode(0)
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			utils.SetDataTransfer(utils.DataTransfer{NumBytes: 1048576, NumSegments: 2, Elapsed: time.Second})
+			defer utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			defer utils.SetDataTransfer(utils.DataTransfer{})
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, nil, nil)
+			Expect(buffer).To(Say(`bandwidth limit:     1\.00 MiB/s per segment
+effective rate:      512\.00 KiB/s per segment
+
+restore status:      Success`))
+		})
+		It("writes a report with the effective flags of the restore", func() {
+			gplog.SetErrorCode(0)
+			effectiveFlags := map[string]string{"timestamp": timestamp, "config": "/home/gpadmin/restore.yaml"}
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", nil, nil, effectiveFlags)
+			Expect(buffer).To(Say(`command line:        .*
+effective flags:     --config=/home/gpadmin/restore.yaml --timestamp=20170101010101
+
+start time:`))
+		})
 	})
 	Describe("SetBackupParamFromFlags", func() {
 		AfterEach(func() {
@@ -325,6 +403,7 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 				Plugin:               "/tmp/plugin.sh",
 				Timestamp:            "timestamp1",
 				IncludeTableFiltered: true,
+				EffectiveFlags:       map[string]string{options.INCLUDE_RELATION: "[public.foobar,public.baz]"},
 			}, backupConfig)
 		})
 	})
@@ -392,6 +471,18 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 			EnsureBackupVersionCompatibility("0.1.0", "0.1.0")
 		})
 	})
+	Describe("EnsureDataFormatCompatibility", func() {
+		It("Panics if the data format version is newer than gprestore can read", func() {
+			defer testhelper.ShouldPanicWithMessage(fmt.Sprintf("gprestore 0.1.0 cannot read data format version %d of this backup; please use a newer gprestore.", history.MAX_DATA_FORMAT_VERSION+1))
+			EnsureDataFormatCompatibility(history.MAX_DATA_FORMAT_VERSION+1, "0.1.0")
+		})
+		It("Does not panic for backups without a data format version", func() {
+			EnsureDataFormatCompatibility(0, "0.1.0")
+		})
+		It("Does not panic for backups with multiple data files per segment", func() {
+			EnsureDataFormatCompatibility(history.DATA_FORMAT_MULTIPLE_DATA_FILES, "0.1.0")
+		})
+	})
 	Describe("EnsureDatabaseVersionCompatibility", func() {
 		var restoreVersion dbconn.GPDBVersion
 		BeforeEach(func() {
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -27,26 +28,38 @@ var (
 func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
 	whichConn = connectionPool.ValidateConnNum(whichConn)
 	copyCommand := ""
+	ioNiceCommand := ""
 	readFromDestinationCommand := "cat"
+	throttleCommand := ""
 	customPipeThroughCommand := utils.GetPipeThroughProgram().InputCommand
 
 	if singleDataFile {
 		//helper.go handles compression, so we don't want to set it here
 		customPipeThroughCommand = "cat -"
-	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+	} else {
+		ioNiceCommand, throttleCommand = utils.GetPipelineThrottleCommands(connectionPool.NumConns, globalFPInfo)
+		if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+			readFromDestinationCommand = pluginConfig.GetPluginCommand("restore_data")
+		}
 	}
 
-	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
+	copyCommand = fmt.Sprintf("PROGRAM '%s%s %s%s | %s'", ioNiceCommand, readFromDestinationCommand, destinationToRead, throttleCommand, customPipeThroughCommand)
+
+	errorHandlingClause := ""
+	if rejectLimit := MustGetFlagInt(options.REJECT_LIMIT); rejectLimit > 0 {
+		errorHandlingClause = fmt.Sprintf(" LOG ERRORS SEGMENT REJECT LIMIT %d ROWS", rejectLimit)
+	}
 
-	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
-	result, err := connectionPool.Exec(query, whichConn)
+	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT%s;", tableName, tableAttributes, copyCommand, tableDelim, errorHandlingClause)
+	copyContext, finishCopy := copyWatchdog.StartCopy(whichConn, tableName)
+	result, err := connectionPool.ExecContext(copyContext, query, whichConn)
+	err = finishCopy(err)
 	if err != nil {
 		errStr := fmt.Sprintf("Error loading data into table %s", tableName)
 
 		// The COPY ON SEGMENT error might contain useful CONTEXT output
-		if err.(pgx.PgError).Where != "" {
-			errStr = fmt.Sprintf("%s: %s", errStr, err.(pgx.PgError).Where)
+		if pgErr, ok := err.(pgx.PgError); ok && pgErr.Where != "" {
+			errStr = fmt.Sprintf("%s: %s", errStr, pgErr.Where)
 		}
 
 		return 0, errors.Wrap(err, errStr)
@@ -62,21 +75,65 @@ func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataE
 	} else {
 		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
 	}
+	isRejectLimitSet := MustGetFlagInt(options.REJECT_LIMIT) > 0
+	var numErrorLogRowsBefore int64
+	var err error
+	if isRejectLimitSet {
+		/*
+		 * The error log for a table may already contain rows from an earlier
+		 * load, so we only count the rows this COPY adds to it.
+		 */
+		numErrorLogRowsBefore, err = GetErrorLogRowCount(connectionPool, tableName, whichConn)
+		if err != nil {
+			return err
+		}
+	}
 	numRowsRestored, err := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, whichConn)
 	if err != nil {
 		return err
 	}
+	var numRowsRejected int64
+	if isRejectLimitSet {
+		numErrorLogRowsAfter, err := GetErrorLogRowCount(connectionPool, tableName, whichConn)
+		if err != nil {
+			return err
+		}
+		numRowsRejected = numErrorLogRowsAfter - numErrorLogRowsBefore
+		if numRowsRejected > 0 {
+			gplog.Warn("Rejected %d row(s) while restoring data to table %s; query gp_read_error_log('%s') for details", numRowsRejected, tableName, utils.EscapeSingleQuotes(tableName))
+			mutex.Lock()
+			rejectedRowsData[tableName] = numRowsRejected
+			mutex.Unlock()
+		}
+	}
 	numRowsBackedUp := entry.RowsCopied
-	err = CheckRowsRestored(numRowsRestored, numRowsBackedUp, tableName)
+	err = CheckRowsRestored(numRowsRestored, numRowsRejected, numRowsBackedUp, tableName)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func CheckRowsRestored(rowsRestored int64, rowsBackedUp int64, tableName string) error {
-	if rowsRestored != rowsBackedUp {
+func GetErrorLogRowCount(connectionPool *dbconn.DBConn, tableName string, whichConn int) (int64, error) {
+	query := fmt.Sprintf("SELECT count(*) FROM gp_read_error_log('%s');", utils.EscapeSingleQuotes(tableName))
+	var count int64
+	err := connectionPool.Get(&count, query, whichConn)
+	if err != nil {
+		return 0, errors.Wrap(err, fmt.Sprintf("Unable to read error log for table %s", tableName))
+	}
+	return count, nil
+}
+
+/*
+ * Rows rejected by single row error handling are counted as accounted for,
+ * since they have been logged to the table's error log instead of loaded.
+ */
+func CheckRowsRestored(rowsRestored int64, rowsRejected int64, rowsBackedUp int64, tableName string) error {
+	if rowsRestored+rowsRejected != rowsBackedUp {
 		rowsErrMsg := fmt.Sprintf("Expected to restore %d rows to table %s, but restored %d instead", rowsBackedUp, tableName, rowsRestored)
+		if rowsRejected > 0 {
+			rowsErrMsg = fmt.Sprintf("Expected to restore %d rows to table %s, but restored %d and rejected %d instead", rowsBackedUp, tableName, rowsRestored, rowsRejected)
+		}
 		return errors.New(rowsErrMsg)
 	}
 	return nil
@@ -90,6 +147,7 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 		return
 	}
 
+	var oidsByJob [][]int
 	if backupConfig.SingleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file restore")
 		utils.VerifyHelperVersionOnSegments(version, globalCluster)
@@ -98,12 +156,22 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 			filteredOids[i] = fmt.Sprintf("%d", entry.Oid)
 		}
 		utils.WriteOidListToSegments(filteredOids, globalCluster, fpInfo)
-		firstOid := fmt.Sprintf("%d", dataEntries[0].Oid)
-		utils.CreateFirstSegmentPipeOnAllHosts(firstOid, globalCluster, fpInfo)
+		// Each connection restores the tables read by one gpbackup_helper job on each segment
+		oidsByJob = utils.AssignOidsToHelperJobs(getDataEntryOids(dataEntries), getNumHelperJobs())
+		firstOids := make([]string, len(oidsByJob))
+		for jobIndex, jobOids := range oidsByJob {
+			firstOids[jobIndex] = fmt.Sprintf("%d", jobOids[0])
+		}
+		utils.CreateFirstSegmentPipesOnAllHosts(firstOids, globalCluster, fpInfo)
 		if wasTerminated {
 			return
 		}
-		utils.StartGpbackupHelpers(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), "", MustGetFlagBool(options.ON_ERROR_CONTINUE))
+		utils.StartGpbackupHelpers(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), "", MustGetFlagBool(options.ON_ERROR_CONTINUE), len(oidsByJob))
+		copyWatchdog.StopHelpersOnTimeout(globalCluster, fpInfo, "restore")
+		defer copyWatchdog.SetTimeoutHandler(nil)
+		statusMonitor := utils.NewHelperStatusMonitor(globalCluster, fpInfo, dataProgressBar, copyWatchdog.RecordActivity)
+		statusMonitor.Start()
+		defer statusMonitor.Stop()
 	}
 	/*
 	 * We break when an interrupt is received and rely on
@@ -111,17 +179,22 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 	 * statements in progress if they don't finish on their own.
 	 */
 	var tableNum int64 = 0
+	startTime := time.Now()
 	tasks := make(chan toc.MasterDataEntry, totalTables)
+	connTasks := make([]chan toc.MasterDataEntry, connectionPool.NumConns)
 	var workerPool sync.WaitGroup
 	var numErrors int32
-	var mutex = &sync.Mutex{}
 
 	for i := 0; i < connectionPool.NumConns; i++ {
+		connTasks[i] = tasks
+		if backupConfig.SingleDataFile {
+			connTasks[i] = make(chan toc.MasterDataEntry, totalTables)
+		}
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
 			setGUCsForConnection(gucStatements, whichConn)
-			for entry := range tasks {
+			for entry := range connTasks[whichConn] {
 				if wasTerminated {
 					dataProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
@@ -164,14 +237,80 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 			}
 		}(i)
 	}
-	for _, entry := range dataEntries {
-		tasks <- entry
+	if backupConfig.SingleDataFile {
+		queueDataEntriesForHelperJobs(dataEntries, oidsByJob, connTasks)
+	} else {
+		for _, entry := range dataEntries {
+			tasks <- entry
+		}
+	}
+	for _, connTask := range connTasks {
+		if connTask != tasks {
+			close(connTask)
+		}
 	}
 	close(tasks)
 	workerPool.Wait()
+	// The throttled pipelines count their bytes in files named for this restore, not for the backup being read
+	transferFPInfo := globalFPInfo
+	if backupConfig.SingleDataFile {
+		transferFPInfo = fpInfo
+	}
+	utils.RecordThrottledDataTransfer(globalCluster, transferFPInfo, backupConfig.SingleDataFile, time.Since(startTime))
 
 	if numErrors > 0 {
 		fmt.Println("")
 		gplog.Error("Encountered %d error(s) during table data restore; see log file %s for a list of table errors.", numErrors, gplog.GetLogFilePath())
 	}
 }
+
+func getDataEntryOids(dataEntries []toc.MasterDataEntry) []int {
+	oids := make([]int, len(dataEntries))
+	for i, entry := range dataEntries {
+		oids[i] = int(entry.Oid)
+	}
+	return oids
+}
+
+/*
+ * Each gpbackup_helper job reads only the tables assigned to it when the data
+ * files are framed and can be read by range.  Otherwise every job would read
+ * each data file in full, so a single job is used, and the tables are
+ * restored on a single connection.
+ */
+func getNumHelperJobs() int {
+	if connectionPool.NumConns == 1 {
+		return 1
+	}
+	if !backupConfig.FramedDataFiles {
+		gplog.Info("Backup data files cannot be read by range; restoring data with a single gpbackup_helper job on each segment")
+		return 1
+	}
+	if pluginConfig != nil {
+		supportsRange, err := pluginConfig.SupportsRestoreDataRange()
+		gplog.FatalOnError(err)
+		if !supportsRange {
+			gplog.Info("Plugin %s does not support restore_data_range; restoring data with a single gpbackup_helper job on each segment", pluginConfig.ExecutablePath)
+			return 1
+		}
+	}
+	return connectionPool.NumConns
+}
+
+/*
+ * In a single-data-file restore, each connection restores the tables read by
+ * one of the gpbackup_helper jobs on each segment, in the order that the job
+ * reads them, as a COPY cannot start until the helper has created its pipe.
+ * Connections without a job are left idle.
+ */
+func queueDataEntriesForHelperJobs(dataEntries []toc.MasterDataEntry, oidsByJob [][]int, connTasks []chan toc.MasterDataEntry) {
+	entriesByOid := make(map[int]toc.MasterDataEntry, len(dataEntries))
+	for _, entry := range dataEntries {
+		entriesByOid[int(entry.Oid)] = entry
+	}
+	for jobIndex, jobOids := range oidsByJob {
+		for _, oid := range jobOids {
+			connTasks[jobIndex] <- entriesByOid[oid]
+		}
+	}
+}
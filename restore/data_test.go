@@ -4,7 +4,9 @@ import (
 	"regexp"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/restore"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -38,6 +40,23 @@ var _ = Describe("restore/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will restore a table from its own file with compression at a limited rate and I/O priority", func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/gpdb" }
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: 7})
+			restore.SetFPInfo(filepath.FilePathInfo{Timestamp: "20170101010101", PID: 1234})
+			defer func() {
+				operating.System = operating.InitializeSystemFunctions()
+				utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+				restore.SetFPInfo(filepath.FilePathInfo{})
+			}()
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "gzip", OutputCommand: "gzip -c -1", InputCommand: "gzip -d -c", Extension: ".gz"})
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'ionice -c 2 -n 7 -p $$ > /dev/null 2>&1; cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz | /usr/local/gpdb/bin/gpbackup_helper --throttle --max-bandwidth 1048576 --byte-count-file <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_bytes_1234 | gzip -d -c' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 		It("will restore a table from a single data file", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_pipe_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
@@ -71,6 +90,15 @@ var _ = Describe("restore/data tests", func() {
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
+		It("will restore a table with single row error handling when a reject limit is set", func() {
+			_ = cmdFlags.Set(options.REJECT_LIMIT, "100")
+			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT LOG ERRORS SEGMENT REJECT LIMIT 100 ROWS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+			_, err := restore.CopyTableIn(connectionPool, "public.foo", "(i,j)", filename, false, 0)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
 		It("will output expected error string from COPY ON SEGMENT failure", func() {
 			execStr := regexp.QuoteMeta("COPY public.foo(i,j) FROM PROGRAM 'cat <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456 | cat -' WITH CSV DELIMITER ',' ON SEGMENT;")
 			pgErr := pgx.PgError{
@@ -89,19 +117,38 @@ var _ = Describe("restore/data tests", func() {
 				"ERROR: value of distribution key doesn't belong to segment with ID 0, it belongs to segment with ID 1 (SQLSTATE 22P04)"))
 		})
 	})
+	Describe("GetErrorLogRowCount", func() {
+		It("returns the number of rows in the error log for a table", func() {
+			mock.ExpectQuery(regexp.QuoteMeta("SELECT count(*) FROM gp_read_error_log('public.\"foo''s\"');")).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(3))
+			count, err := restore.GetErrorLogRowCount(connectionPool, `public."foo's"`, 0)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(int64(3)))
+		})
+	})
 	Describe("CheckRowsRestored", func() {
 		var (
 			expectedRows int64 = 10
 			name               = "public.foo"
 		)
 		It("does nothing if the number of rows match ", func() {
-			err := restore.CheckRowsRestored(10, expectedRows, name)
+			err := restore.CheckRowsRestored(10, 0, expectedRows, name)
 			Expect(err).ToNot(HaveOccurred())
 		})
 		It("returns an error if the numbers of rows do not match", func() {
-			err := restore.CheckRowsRestored(5, expectedRows, name)
+			err := restore.CheckRowsRestored(5, 0, expectedRows, name)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("Expected to restore 10 rows to table public.foo, but restored 5 instead"))
 		})
+		It("does nothing if the restored and rejected rows add up to the number of rows backed up", func() {
+			err := restore.CheckRowsRestored(7, 3, expectedRows, name)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns an error if the restored and rejected rows do not add up to the number of rows backed up", func() {
+			err := restore.CheckRowsRestored(5, 3, expectedRows, name)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Expected to restore 10 rows to table public.foo, but restored 5 and rejected 3 instead"))
+		})
 	})
 })
@@ -0,0 +1,239 @@
+package restore
+
+/*
+ * This file contains structs and functions related to rewriting or skipping
+ * external tables on restore, via --external-location-map,
+ * --no-external-tables, and --external-tables-as-heap.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * Protocol names match the protocols determined for external tables by
+ * DetermineExternalTableCharacteristics during backup, along with "execute"
+ * for the commands of EXECUTE web tables.
+ */
+const EXTERNAL_PROTOCOL_EXECUTE = "execute"
+
+var (
+	externalProtocols = map[string]string{
+		"file":     "file",
+		"gpfdist":  "gpfdist",
+		"gpfdists": "gpfdist",
+		"gphdfs":   "gphdfs",
+		"http":     "http",
+		"https":    "http",
+		"s3":       "s3",
+	}
+	createExternalTableRegex = regexp.MustCompile(`^\s*CREATE (?:READABLE|WRITABLE) EXTERNAL (?:WEB )?TABLE `)
+	externalLocationRegex    = regexp.MustCompile(`(?m)^\t'((?:[^']|'')*)'(,?)$`)
+	externalExecuteRegex     = regexp.MustCompile(`EXECUTE '((?:[^']|'')*)'`)
+)
+
+type ExternalLocationMap struct {
+	Rules []ExternalLocationRule `yaml:"rules"`
+}
+
+/*
+ * Each rule replaces either a Prefix or every match of a Regex in the
+ * locations of external tables using Protocol, or of any protocol if Protocol
+ * is empty.  Replacement may refer to Regex submatches as $1, $2, and so on.
+ */
+type ExternalLocationRule struct {
+	Protocol    string `yaml:"protocol"`
+	Prefix      string `yaml:"prefix"`
+	Regex       string `yaml:"regex"`
+	Replacement string `yaml:"replacement"`
+	regex       *regexp.Regexp
+}
+
+func ReadExternalLocationMap(filename string) (*ExternalLocationMap, error) {
+	locationMap := &ExternalLocationMap{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(contents, locationMap)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse external location map file %s", filename)
+	}
+	for i, rule := range locationMap.Rules {
+		if _, ok := externalProtocols[rule.Protocol]; !ok && rule.Protocol != "" && rule.Protocol != EXTERNAL_PROTOCOL_EXECUTE {
+			return nil, errors.Errorf("Invalid protocol %s in external location map file %s", rule.Protocol, filename)
+		}
+		if (rule.Prefix == "") == (rule.Regex == "") {
+			return nil, errors.Errorf("Each rule in external location map file %s must specify exactly one of prefix or regex", filename)
+		}
+		if rule.Regex != "" {
+			locationMap.Rules[i].regex, err = regexp.Compile(rule.Regex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid regex %s in external location map file %s", rule.Regex, filename)
+			}
+		}
+	}
+	return locationMap, nil
+}
+
+func getExternalProtocol(location string) string {
+	index := strings.Index(location, "://")
+	if index == -1 {
+		return ""
+	}
+	return externalProtocols[location[:index]]
+}
+
+/*
+ * Applies the first rule matching the location, if any.
+ */
+func (locationMap *ExternalLocationMap) rewriteLocation(location string, protocol string) string {
+	for _, rule := range locationMap.Rules {
+		if rule.Protocol != "" && rule.Protocol != protocol {
+			continue
+		}
+		if rule.Prefix != "" && strings.HasPrefix(location, rule.Prefix) {
+			return rule.Replacement + strings.TrimPrefix(location, rule.Prefix)
+		}
+		if rule.regex != nil && rule.regex.MatchString(location) {
+			return rule.regex.ReplaceAllString(location, rule.Replacement)
+		}
+	}
+	return location
+}
+
+func editStatementsExternalLocationMap(statements []toc.StatementWithType, locationMap *ExternalLocationMap) {
+	if locationMap == nil {
+		return
+	}
+	rewrite := func(regex *regexp.Regexp, statement string, getProtocol func(string) string) string {
+		return regex.ReplaceAllStringFunc(statement, func(match string) string {
+			submatches := regex.FindStringSubmatch(match)
+			oldValue := strings.Replace(submatches[1], "''", "'", -1)
+			newValue := locationMap.rewriteLocation(oldValue, getProtocol(oldValue))
+			if newValue == oldValue {
+				return match
+			}
+			return strings.Replace(match, submatches[1], utils.EscapeSingleQuotes(newValue), 1)
+		})
+	}
+	for i, statement := range statements {
+		if statement.ObjectType != "TABLE" || !createExternalTableRegex.MatchString(statement.Statement) {
+			continue
+		}
+		newStatement := rewrite(externalLocationRegex, statement.Statement, getExternalProtocol)
+		newStatement = rewrite(externalExecuteRegex, newStatement, func(string) string { return EXTERNAL_PROTOCOL_EXECUTE })
+		if newStatement != statement.Statement {
+			gplog.Verbose("Rewriting external table locations for %s", utils.MakeFQN(statement.Schema, statement.Name))
+			statements[i].Statement = newStatement
+		}
+	}
+}
+
+/*
+ * Removes external tables along with their metadata and any statements that
+ * exchange them into partitioned tables, in which case the partition is left
+ * as an empty table.
+ */
+func removeExternalTableStatements(statements []toc.StatementWithType) []toc.StatementWithType {
+	externalTables := make(map[string]bool)
+	for _, statement := range statements {
+		if statement.ObjectType == "TABLE" && createExternalTableRegex.MatchString(statement.Statement) {
+			externalTables[utils.MakeFQN(statement.Schema, statement.Name)] = true
+		}
+	}
+	if len(externalTables) == 0 {
+		return statements
+	}
+	newStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		fqn := utils.MakeFQN(statement.Schema, statement.Name)
+		if statement.ObjectType == "TABLE" && externalTables[fqn] {
+			continue
+		}
+		if statement.ObjectType == "EXCHANGE PARTITION" && isExchangeOfExternalTable(statement.Statement, externalTables) {
+			continue
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+func isExchangeOfExternalTable(statement string, externalTables map[string]bool) bool {
+	for fqn := range externalTables {
+		if strings.Contains(statement, fmt.Sprintf(" WITH TABLE %s WITHOUT VALIDATION;", fqn)) {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ * Replaces the definitions of the given external tables with those of heap
+ * tables with the same columns, so that their materialized data can be restored.
+ */
+func convertExternalTablesToHeap(statements []toc.StatementWithType, tableFQNs map[string]bool) {
+	for i, statement := range statements {
+		header := createExternalTableRegex.FindString(statement.Statement)
+		if statement.ObjectType != "TABLE" || header == "" || !tableFQNs[utils.MakeFQN(statement.Schema, statement.Name)] {
+			continue
+		}
+		definition := statement.Statement[len(header):]
+		columnsEnd := strings.Index(definition, "\n) ")
+		if columnsEnd == -1 {
+			continue
+		}
+		leadingSpace := header[:len(header)-len(strings.TrimLeft(header, " \t\n"))]
+		statements[i].Statement = fmt.Sprintf("%sCREATE TABLE %s\n) DISTRIBUTED RANDOMLY;", leadingSpace, definition[:columnsEnd])
+	}
+}
+
+func getMaterializedExternalTables(dataEntries []toc.MasterDataEntry) map[string]bool {
+	tableFQNs := make(map[string]bool)
+	for _, entry := range dataEntries {
+		if entry.IsExternal {
+			tableFQNs[utils.MakeFQN(entry.Schema, entry.Name)] = true
+		}
+	}
+	return tableFQNs
+}
+
+/*
+ * Data for external tables is only present if it was materialized during the
+ * backup, and can only be restored into external tables restored as heap tables.
+ */
+func filterMaterializedExternalDataEntries(dataEntries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	if MustGetFlagBool(options.EXTERNAL_AS_HEAP) {
+		return dataEntries
+	}
+	filteredEntries := make([]toc.MasterDataEntry, 0, len(dataEntries))
+	for _, entry := range dataEntries {
+		if entry.IsExternal {
+			gplog.Verbose("Skipping restore of materialized data for external table %s", utils.MakeFQN(entry.Schema, entry.Name))
+			continue
+		}
+		filteredEntries = append(filteredEntries, entry)
+	}
+	return filteredEntries
+}
+
+func editStatementsExternalTables(statements []toc.StatementWithType) []toc.StatementWithType {
+	if MustGetFlagBool(options.NO_EXTERNAL_TABLES) {
+		return removeExternalTableStatements(statements)
+	}
+	if MustGetFlagBool(options.EXTERNAL_AS_HEAP) {
+		convertExternalTablesToHeap(statements, getMaterializedExternalTables(globalTOC.DataEntries))
+	}
+	editStatementsExternalLocationMap(statements, externalLocationMap)
+	return statements
+}
@@ -1,6 +1,7 @@
 package restore
 
 import (
+	"strings"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -13,6 +14,13 @@ import (
 	"github.com/spf13/pflag"
 )
 
+const (
+	SECTION_PREDATA    = "predata"
+	SECTION_DATA       = "data"
+	SECTION_POSTDATA   = "postdata"
+	SECTION_STATISTICS = "statistics"
+)
+
 /*
  * Empty struct type used for value with 0 bytes
  */
@@ -28,18 +36,28 @@ type Empty struct{}
  */
 
 var (
-	backupConfig        *history.BackupConfig
-	connectionPool      *dbconn.DBConn
-	globalCluster       *cluster.Cluster
-	globalFPInfo        filepath.FilePathInfo
-	globalTOC           *toc.TOC
-	pluginConfig        *utils.PluginConfig
-	restoreStartTime    string
-	version             string
-	wasTerminated       bool
-	errorTablesMetadata map[string]Empty
-	errorTablesData     map[string]Empty
-	opts                *options.Options
+	backupConfig          *history.BackupConfig
+	connectionPool        *dbconn.DBConn
+	copyWatchdog          *utils.CopyWatchdog
+	globalCluster         *cluster.Cluster
+	globalFPInfo          filepath.FilePathInfo
+	globalTOC             *toc.TOC
+	pluginConfig          *utils.PluginConfig
+	hookConfig            *utils.HookConfig
+	tablespaceMap         *TablespaceMap
+	ownerMap              *OwnerMap
+	externalLocationMap   *ExternalLocationMap
+	tableOverrides        *TableOverrides
+	restoreStartTime      string
+	version               string
+	wasTerminated         bool
+	errorTablesMetadata   map[string]Empty
+	errorTablesData       map[string]Empty
+	rejectedRowsData      map[string]int64
+	tableOverridesApplied map[string]string
+	opts                  *options.Options
+	retryMetadataObjects  []string
+	retryDataTables       []string
 	/*
 	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
 	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
@@ -52,6 +70,8 @@ func init() {
 	// Initialize global variables
 	errorTablesMetadata = make(map[string]Empty)
 	errorTablesData = make(map[string]Empty)
+	rejectedRowsData = make(map[string]int64)
+	copyWatchdog = utils.NewCopyWatchdog(0, 0, 0)
 }
 
 /*
@@ -113,6 +133,43 @@ func MustGetFlagStringArray(flagName string) []string {
 	return options.MustGetFlagStringArray(cmdFlags, flagName)
 }
 
+func isRetry() bool {
+	return MustGetFlagString(options.RETRY_ERRORS_FROM) != ""
+}
+
+/*
+ * Sections may be given as separate --section flags or as a comma-separated list.
+ */
+func getSections() []string {
+	sections := make([]string, 0)
+	for _, value := range MustGetFlagStringArray(options.SECTION) {
+		for _, section := range strings.Split(value, ",") {
+			sections = append(sections, strings.TrimSpace(section))
+		}
+	}
+	return sections
+}
+
+/*
+ * Without --section, the sections to restore are determined by --data-only,
+ * --metadata-only, and --with-stats.
+ */
+func sectionRequested(section string) bool {
+	sections := getSections()
+	if len(sections) > 0 {
+		return utils.Exists(sections, section)
+	}
+	switch section {
+	case SECTION_PREDATA, SECTION_POSTDATA:
+		return !MustGetFlagBool(options.DATA_ONLY)
+	case SECTION_DATA:
+		return !MustGetFlagBool(options.METADATA_ONLY)
+	case SECTION_STATISTICS:
+		return MustGetFlagBool(options.WITH_STATS)
+	}
+	return false
+}
+
 func GetVersion() string {
 	return version
 }
@@ -0,0 +1,158 @@
+package restore
+
+/*
+ * This file contains structs and functions related to overriding the storage
+ * options and distribution policies of restored tables via --table-overrides.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const HEAP_STORAGE = "heap"
+
+var (
+	createTableRegex    = regexp.MustCompile(`^\s*CREATE (?:UNLOGGED )?TABLE `)
+	distributionRegex   = regexp.MustCompile(`^DISTRIBUTED (?:BY \(.+\)|RANDOMLY|REPLICATED)$`)
+	tableClausesRegex   = regexp.MustCompile(`^((?:INHERITS \([^)]*\) )?)(?:WITH \([^)]*\) )?((?:TABLESPACE ` + identifierPattern + ` )?)DISTRIBUTED (?:BY \([^)]*\)|RANDOMLY|REPLICATED)`)
+	columnEncodingRegex = regexp.MustCompile(`(?m) ENCODING \([^)]*\)(,?)$`)
+)
+
+type TableOverrides struct {
+	Rules []TableOverrideRule `yaml:"rules"`
+}
+
+/*
+ * Each rule applies to the table with the FQN Table, or to every table whose
+ * FQN matches the regex Pattern.  Storage replaces the options in the table's
+ * WITH clause, with "heap" removing the clause entirely, and Distribution
+ * replaces its DISTRIBUTED clause.  Only the first matching rule is applied to
+ * each table.  For partition tables, only the storage of partitions that do not
+ * specify their own storage options is affected.
+ */
+type TableOverrideRule struct {
+	Table        string `yaml:"table"`
+	Pattern      string `yaml:"pattern"`
+	Storage      string `yaml:"storage"`
+	Distribution string `yaml:"distribution"`
+	pattern      *regexp.Regexp
+}
+
+func ReadTableOverrides(filename string) (*TableOverrides, error) {
+	overrides := &TableOverrides{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(contents, overrides)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse table overrides file %s", filename)
+	}
+	for i, rule := range overrides.Rules {
+		if (rule.Table == "") == (rule.Pattern == "") {
+			return nil, errors.Errorf("Each rule in table overrides file %s must specify exactly one of table or pattern", filename)
+		}
+		if rule.Storage == "" && rule.Distribution == "" {
+			return nil, errors.Errorf("Each rule in table overrides file %s must specify at least one of storage or distribution", filename)
+		}
+		if rule.Distribution != "" && !distributionRegex.MatchString(rule.Distribution) {
+			return nil, errors.Errorf("Invalid distribution %s in table overrides file %s; distribution must be DISTRIBUTED BY (columns), DISTRIBUTED RANDOMLY, or DISTRIBUTED REPLICATED", rule.Distribution, filename)
+		}
+		if rule.Pattern != "" {
+			overrides.Rules[i].pattern, err = regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Invalid pattern %s in table overrides file %s", rule.Pattern, filename)
+			}
+		}
+	}
+	return overrides, nil
+}
+
+func (overrides *TableOverrides) getRule(tableFQN string) *TableOverrideRule {
+	for i, rule := range overrides.Rules {
+		if rule.Table == tableFQN || (rule.pattern != nil && rule.pattern.MatchString(tableFQN)) {
+			return &overrides.Rules[i]
+		}
+	}
+	return nil
+}
+
+func (rule TableOverrideRule) withClause(oldClause string) string {
+	switch rule.Storage {
+	case "":
+		return oldClause
+	case HEAP_STORAGE:
+		return ""
+	default:
+		return fmt.Sprintf("WITH (%s) ", rule.Storage)
+	}
+}
+
+/*
+ * Rewrites the CREATE TABLE statements of tables matching an override rule,
+ * and returns a description of the overrides applied to each table.
+ */
+func editStatementsTableOverrides(statements []toc.StatementWithType, overrides *TableOverrides) map[string]string {
+	appliedOverrides := make(map[string]string)
+	if overrides == nil {
+		return appliedOverrides
+	}
+	for i, statement := range statements {
+		if statement.ObjectType != "TABLE" || !createTableRegex.MatchString(statement.Statement) {
+			continue
+		}
+		tableFQN := utils.MakeFQN(statement.Schema, statement.Name)
+		rule := overrides.getRule(tableFQN)
+		if rule == nil {
+			continue
+		}
+		columnsEnd := strings.Index(statement.Statement, "\n) ")
+		if columnsEnd == -1 {
+			continue
+		}
+		clausesStart := columnsEnd + len("\n) ")
+		clauses := statement.Statement[clausesStart:]
+		match := tableClausesRegex.FindStringSubmatchIndex(clauses)
+		if match == nil {
+			gplog.Warn("Unable to apply table overrides to table %s", tableFQN)
+			continue
+		}
+		oldClauses := clauses[:match[1]]
+		withStart := match[3]
+		withEnd := match[4]
+		distributionStart := match[5]
+		distribution := oldClauses[distributionStart:]
+		if rule.Distribution != "" {
+			distribution = rule.Distribution
+		}
+		newClauses := oldClauses[:withStart] + rule.withClause(oldClauses[withStart:withEnd]) + oldClauses[withEnd:distributionStart] + distribution
+		columns := statement.Statement[:columnsEnd]
+		if rule.Storage == HEAP_STORAGE {
+			// Column compression is only supported for column-oriented tables
+			columns = replaceOutsideLiterals(columns, columnEncodingRegex, func(match []string) string {
+				return match[1]
+			})
+		}
+		statements[i].Statement = columns + statement.Statement[columnsEnd:clausesStart] + newClauses + clauses[match[1]:]
+
+		description := make([]string, 0)
+		if rule.Storage != "" {
+			description = append(description, fmt.Sprintf("storage %s", rule.Storage))
+		}
+		if rule.Distribution != "" {
+			description = append(description, rule.Distribution)
+		}
+		appliedOverrides[tableFQN] = strings.Join(description, ", ")
+		gplog.Verbose("Overriding %s for table %s", appliedOverrides[tableFQN], tableFQN)
+	}
+	return appliedOverrides
+}
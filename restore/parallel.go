@@ -6,9 +6,11 @@ package restore
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/options"
@@ -20,32 +22,57 @@ var (
 	mutex = &sync.Mutex{}
 )
 
+/*
+ * Dependencies holds the indices of the tasks that must complete before this
+ * task can be executed.
+ */
+type MetadataTask struct {
+	Statement    toc.StatementWithType
+	TableSize    int64
+	Dependencies []int
+	Duration     time.Duration
+}
+
+func executeStatement(statement toc.StatementWithType, fatalErr *error, numErrors *int32, whichConn int, executeInParallel bool) {
+	_, err := connectionPool.Exec(statement.Statement, whichConn)
+	if err != nil {
+		gplog.Verbose("Error encountered when executing statement: %s Error was: %s", strings.TrimSpace(statement.Statement), err.Error())
+		if MustGetFlagBool(options.ON_ERROR_CONTINUE) {
+			if executeInParallel {
+				atomic.AddInt32(numErrors, 1)
+				mutex.Lock()
+				errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
+				mutex.Unlock()
+			} else {
+				*numErrors = *numErrors + 1
+				errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
+			}
+		} else {
+			*fatalErr = err
+		}
+	}
+}
+
 func executeStatementsForConn(statements chan toc.StatementWithType, fatalErr *error, numErrors *int32, progressBar utils.ProgressBar, whichConn int, executeInParallel bool) {
 	for statement := range statements {
 		if wasTerminated || *fatalErr != nil {
 			return
 		}
-		_, err := connectionPool.Exec(statement.Statement, whichConn)
-		if err != nil {
-			gplog.Verbose("Error encountered when executing statement: %s Error was: %s", strings.TrimSpace(statement.Statement), err.Error())
-			if MustGetFlagBool(options.ON_ERROR_CONTINUE) {
-				if executeInParallel {
-					atomic.AddInt32(numErrors, 1)
-					mutex.Lock()
-					errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
-					mutex.Unlock()
-				} else {
-					*numErrors = *numErrors + 1
-					errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
-				}
-			} else {
-				*fatalErr = err
-			}
-		}
+		executeStatement(statement, fatalErr, numErrors, whichConn, executeInParallel)
 		progressBar.Increment()
 	}
 }
 
+func handleStatementErrors(fatalErr error, numErrors int32) {
+	if fatalErr != nil {
+		fmt.Println("")
+		gplog.Fatal(fatalErr, "")
+	} else if numErrors > 0 {
+		fmt.Println("")
+		gplog.Error("Encountered %d errors during metadata restore; see log file %s for a list of failed statements.", numErrors, gplog.GetLogFilePath())
+	}
+}
+
 /*
  * This function creates a worker pool of N goroutines to be able to execute up
  * to N statements in parallel.
@@ -74,13 +101,7 @@ func ExecuteStatements(statements []toc.StatementWithType, progressBar utils.Pro
 		}
 		workerPool.Wait()
 	}
-	if fatalErr != nil {
-		fmt.Println("")
-		gplog.Fatal(fatalErr, "")
-	} else if numErrors > 0 {
-		fmt.Println("")
-		gplog.Error("Encountered %d errors during metadata restore; see log file %s for a list of failed statements.", numErrors, gplog.GetLogFilePath())
-	}
+	handleStatementErrors(fatalErr, numErrors)
 }
 
 func ExecuteStatementsAndCreateProgressBar(statements []toc.StatementWithType, objectsTitle string, showProgressBar int, executeInParallel bool, whichConn ...int) {
@@ -91,28 +112,95 @@ func ExecuteStatementsAndCreateProgressBar(statements []toc.StatementWithType, o
 }
 
 /*
- *   There is an existing bug in Greenplum where creating indexes in parallel
- *   on an AO table that didn't have any indexes previously can cause
- *   deadlock.
- *
- *   We work around this issue by restoring post data objects in
- *   two batches. The first batch takes one index from each table and
- *   restores them in parallel (which has no possibility of deadlock) and
- *   then the second restores all other postdata objects in parallel. After
- *   each table has at least one index, there is no more risk of deadlock.
+ * Workers report a fatal statement error along with the task index, so that
+ * only the dispatch loop reads or writes the first fatal error.
  */
-func BatchPostdataStatements(statements []toc.StatementWithType) ([]toc.StatementWithType, []toc.StatementWithType) {
-	indexMap := make(map[string]bool)
-	firstBatch := make([]toc.StatementWithType, 0)
-	secondBatch := make([]toc.StatementWithType, 0)
-	for _, statement := range statements {
-		_, tableIndexPresent := indexMap[statement.ReferenceObject]
-		if statement.ObjectType == "INDEX" && !tableIndexPresent {
-			indexMap[statement.ReferenceObject] = true
-			firstBatch = append(firstBatch, statement)
-		} else {
-			secondBatch = append(secondBatch, statement)
+type metadataTaskResult struct {
+	index int
+	err   error
+}
+
+/*
+ * Executes each task once all of its dependencies have completed, using up to
+ * one worker per connection.  Ready tasks are started in the order of the task
+ * list, which is backup order for pre-data tasks from BuildPredataTasks and
+ * descending table size for post-data tasks from BuildPostdataTasks.
+ */
+func ExecuteMetadataTasks(tasks []MetadataTask, progressBar utils.ProgressBar) {
+	var fatalErr error
+	var numErrors int32
+	numWorkers := connectionPool.NumConns
+
+	dependents := make([][]int, len(tasks))
+	remainingDependencies := make([]int, len(tasks))
+	for i, task := range tasks {
+		remainingDependencies[i] = len(task.Dependencies)
+		for _, dependency := range task.Dependencies {
+			dependents[dependency] = append(dependents[dependency], i)
+		}
+	}
+	ready := make([]int, 0)
+	for i := range tasks {
+		if remainingDependencies[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	taskChan := make(chan int)
+	doneChan := make(chan metadataTaskResult)
+	var workerPool sync.WaitGroup
+	for i := 0; i < numWorkers; i++ {
+		workerPool.Add(1)
+		go func(whichConn int) {
+			defer workerPool.Done()
+			whichConn = connectionPool.ValidateConnNum(whichConn)
+			for index := range taskChan {
+				var err error
+				start := time.Now()
+				executeStatement(tasks[index].Statement, &err, &numErrors, whichConn, numWorkers > 1)
+				tasks[index].Duration = time.Since(start)
+				gplog.Debug("Restored %s %s.%s in %s", tasks[index].Statement.ObjectType, tasks[index].Statement.Schema, tasks[index].Statement.Name, tasks[index].Duration)
+				progressBar.Increment()
+				doneChan <- metadataTaskResult{index: index, err: err}
+			}
+		}(i)
+	}
+
+	running := 0
+	for {
+		for running < numWorkers && len(ready) > 0 && !wasTerminated && fatalErr == nil {
+			taskChan <- ready[0]
+			ready = ready[1:]
+			running++
+		}
+		if running == 0 {
+			break
+		}
+		result := <-doneChan
+		running--
+		if result.err != nil && fatalErr == nil {
+			fatalErr = result.err
+		}
+		for _, dependent := range dependents[result.index] {
+			remainingDependencies[dependent]--
+			if remainingDependencies[dependent] == 0 {
+				ready = insertReadyTask(ready, dependent)
+			}
 		}
 	}
-	return firstBatch, secondBatch
+	close(taskChan)
+	workerPool.Wait()
+	handleStatementErrors(fatalErr, numErrors)
+}
+
+/*
+ * Keeping the ready list sorted by index keeps it in the order of the task
+ * list, so that ready tasks start in the order chosen when the tasks were built.
+ */
+func insertReadyTask(ready []int, index int) []int {
+	position := sort.SearchInts(ready, index)
+	ready = append(ready, 0)
+	copy(ready[position+1:], ready[position:])
+	ready[position] = index
+	return ready
 }
@@ -1,37 +1,47 @@
 package restore_test
 
 import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/restore"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("restore/parallel tests", func() {
-	Describe("BatchPostdataStatements", func() {
-		index1 := toc.StatementWithType{ObjectType: "INDEX", ReferenceObject: "public.table1", Statement: `CREATE INDEX testindex ON public.testtable USING btree(i);`}
-		index2 := toc.StatementWithType{ObjectType: "INDEX", ReferenceObject: "public.table2", Statement: `CREATE INDEX testindex ON public.testtable USING btree(i);`}
-		index3 := toc.StatementWithType{ObjectType: "INDEX", ReferenceObject: "public.table3", Statement: `CREATE INDEX testindex ON public.testtable USING btree(i);`}
-		trigger := toc.StatementWithType{ObjectType: "TRIGGER", ReferenceObject: "public.table3", Statement: `CREATE INDEX testindex ON public.testtable USING btree(i);`}
-		It("places all indexes in first batch when all are on different tables", func() {
-			statements := []toc.StatementWithType{index1, index2, index3}
-			firstBatch, secondBatch := restore.BatchPostdataStatements(statements)
-			Expect(firstBatch).To(Equal([]toc.StatementWithType{index1, index2, index3}))
-			Expect(secondBatch).To(Equal([]toc.StatementWithType{}))
-		})
-		It("places first index for a table in first batch, and other indexes for that table in second", func() {
-			statements := []toc.StatementWithType{index1, index2, index2, index2, index3, index3}
-			firstBatch, secondBatch := restore.BatchPostdataStatements(statements)
-			Expect(firstBatch).To(Equal([]toc.StatementWithType{index1, index2, index3}))
-			Expect(secondBatch).To(Equal([]toc.StatementWithType{index2, index2, index3}))
-		})
-		It("places non-index objects in second batch", func() {
-			statements := []toc.StatementWithType{index1, index1, trigger}
-			firstBatch, secondBatch := restore.BatchPostdataStatements(statements)
-			Expect(firstBatch).To(Equal([]toc.StatementWithType{index1}))
-			Expect(secondBatch).To(Equal([]toc.StatementWithType{index1, trigger}))
+	Describe("ExecuteMetadataTasks", func() {
+		index1 := toc.StatementWithType{ObjectType: "INDEX", Name: "index1", ReferenceObject: "public.table1", Statement: "\n\nCREATE INDEX index1 ON public.table1 USING btree (i);\n"}
+		index2 := toc.StatementWithType{ObjectType: "INDEX", Name: "index2", ReferenceObject: "public.table2", Statement: "\n\nCREATE INDEX index2 ON public.table2 USING btree (i);\n"}
+		primaryKey1 := toc.StatementWithType{ObjectType: "CONSTRAINT", Name: "table1_pkey", ReferenceObject: "public.table1", Statement: "\n\nALTER TABLE ONLY public.table1 ADD CONSTRAINT table1_pkey PRIMARY KEY (i);\n"}
+		foreignKey2 := toc.StatementWithType{ObjectType: "CONSTRAINT", Name: "table2_fkey", ReferenceObject: "public.table2", Statement: "\n\nALTER TABLE ONLY public.table2 ADD CONSTRAINT table2_fkey FOREIGN KEY (i) REFERENCES public.table1(i);\n"}
+
+		It("executes each task after its dependencies, in size order", func() {
+			tableSizes := map[string]int64{"public.table1": 10, "public.table2": 1000}
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{primaryKey1, index1, foreignKey2, index2}, tableSizes)
+			mock.ExpectExec(regexp.QuoteMeta(index2.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(primaryKey1.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(foreignKey2.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(index1.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			restore.ExecuteMetadataTasks(tasks, utils.NewProgressBar(len(tasks), "", utils.PB_NONE))
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
 		})
+		It("stops starting tasks after a statement fails", func() {
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{primaryKey1, index1}, map[string]int64{})
+			mock.ExpectExec(regexp.QuoteMeta(primaryKey1.Statement)).WillReturnError(errors.New("relation public.table1 does not exist"))
 
+			defer func() {
+				Expect(mock.ExpectationsWereMet()).To(Succeed())
+			}()
+			defer testhelper.ShouldPanicWithMessage("relation public.table1 does not exist")
+			restore.ExecuteMetadataTasks(tasks, utils.NewProgressBar(len(tasks), "", utils.PB_NONE))
+		})
 	})
 })
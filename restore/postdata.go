@@ -0,0 +1,167 @@
+package restore
+
+/*
+ * This file contains structs and functions related to scheduling post-data
+ * statements, such as index and constraint builds, across multiple connections.
+ */
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+var (
+	constraintTypeRegex = regexp.MustCompile(` ADD CONSTRAINT ` + identifierPattern + ` (PRIMARY KEY|UNIQUE|FOREIGN KEY|CHECK|EXCLUDE)\b`)
+	referencesRegex     = regexp.MustCompile(` REFERENCES ((?:` + identifierPattern + `\.)?` + identifierPattern + `)\(`)
+	gucNameRegex        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+)
+
+func getConstraintType(statement toc.StatementWithType) string {
+	if statement.ObjectType != "CONSTRAINT" {
+		return ""
+	}
+	match := constraintTypeRegex.FindStringSubmatch(statement.Statement)
+	if match == nil {
+		return ""
+	}
+	return match[1]
+}
+
+func isIndexBuild(statement toc.StatementWithType) bool {
+	switch getConstraintType(statement) {
+	case "PRIMARY KEY", "UNIQUE", "EXCLUDE":
+		return true
+	}
+	return statement.ObjectType == "INDEX"
+}
+
+func isUniqueKey(statement toc.StatementWithType) bool {
+	switch getConstraintType(statement) {
+	case "PRIMARY KEY", "UNIQUE":
+		return true
+	}
+	return statement.ObjectType == "INDEX" && strings.Contains(statement.Statement, "CREATE UNIQUE INDEX ")
+}
+
+/*
+ * There is an existing bug in Greenplum where creating indexes in parallel on
+ * an AO table that didn't have any indexes previously can cause deadlock, so
+ * every other statement on a table depends on the first index built on it.
+ * FOREIGN KEY constraints also depend on the primary keys and unique indexes
+ * of the tables they reference.  Tasks are sorted in descending order of the
+ * size of their tables, so that the longest builds are started first.
+ */
+func BuildPostdataTasks(statements []toc.StatementWithType, tableSizes map[string]int64) []MetadataTask {
+	sortedStatements := make([]toc.StatementWithType, len(statements))
+	copy(sortedStatements, statements)
+	sort.SliceStable(sortedStatements, func(i int, j int) bool {
+		return tableSizes[sortedStatements[i].ReferenceObject] > tableSizes[sortedStatements[j].ReferenceObject]
+	})
+
+	firstIndexBuilds := make(map[string]int)
+	uniqueKeys := make(map[string][]int)
+	for i, statement := range sortedStatements {
+		if statement.ReferenceObject == "" {
+			continue
+		}
+		if _, ok := firstIndexBuilds[statement.ReferenceObject]; !ok && isIndexBuild(statement) {
+			firstIndexBuilds[statement.ReferenceObject] = i
+		}
+		if isUniqueKey(statement) {
+			uniqueKeys[statement.ReferenceObject] = append(uniqueKeys[statement.ReferenceObject], i)
+		}
+	}
+
+	tasks := make([]MetadataTask, len(sortedStatements))
+	for i, statement := range sortedStatements {
+		tasks[i] = MetadataTask{Statement: statement, TableSize: tableSizes[statement.ReferenceObject], Dependencies: []int{}}
+		if statement.ReferenceObject == "" {
+			continue
+		}
+		dependencies := make(map[int]bool)
+		if first, ok := firstIndexBuilds[statement.ReferenceObject]; ok {
+			dependencies[first] = true
+		}
+		if getConstraintType(statement) == "FOREIGN KEY" {
+			if match := referencesRegex.FindStringSubmatch(statement.Statement); match != nil {
+				for _, key := range uniqueKeys[match[1]] {
+					dependencies[key] = true
+				}
+			}
+		}
+		delete(dependencies, i)
+		for dependency := range dependencies {
+			tasks[i].Dependencies = append(tasks[i].Dependencies, dependency)
+		}
+		sort.Ints(tasks[i].Dependencies)
+	}
+	return tasks
+}
+
+func WritePostdataTimings(filename string, tasks []MetadataTask) {
+	timingsFile, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		gplog.Warn("Unable to write post-data timings to %s: %v", filename, err)
+		return
+	}
+	timingsWriter := csv.NewWriter(timingsFile)
+	_ = timingsWriter.Write([]string{"object_type", "schema", "name", "table", "table_size", "seconds"})
+	for _, task := range tasks {
+		statement := task.Statement
+		_ = timingsWriter.Write([]string{statement.ObjectType, statement.Schema, statement.Name, statement.ReferenceObject,
+			strconv.FormatInt(task.TableSize, 10), fmt.Sprintf("%.3f", task.Duration.Seconds())})
+	}
+	timingsWriter.Flush()
+	err = timingsWriter.Error()
+	if closeErr := timingsFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		gplog.Warn("Unable to write post-data timings to %s: %v", filename, err)
+		return
+	}
+	_ = operating.System.Chmod(filename, 0444)
+}
+
+/*
+ * Parses --postdata-guc values of the form name=value.
+ */
+func ParsePostdataGUCs(gucs []string) ([][2]string, error) {
+	parsedGUCs := make([][2]string, 0, len(gucs))
+	for _, guc := range gucs {
+		parts := strings.SplitN(guc, "=", 2)
+		if len(parts) != 2 || !gucNameRegex.MatchString(parts[0]) {
+			return nil, errors.Errorf("Invalid value %s for --%s; values must be of the form name=value", guc, options.POSTDATA_GUC)
+		}
+		parsedGUCs = append(parsedGUCs, [2]string{parts[0], parts[1]})
+	}
+	return parsedGUCs, nil
+}
+
+/*
+ * Sets the given GUCs on every connection when reset is false, and resets them
+ * to their session defaults when reset is true.
+ */
+func setPostdataGUCs(gucs [][2]string, reset bool) {
+	for _, guc := range gucs {
+		query := fmt.Sprintf("SET %s TO '%s'", guc[0], utils.EscapeSingleQuotes(guc[1]))
+		if reset {
+			query = fmt.Sprintf("RESET %s", guc[0])
+		}
+		for whichConn := 0; whichConn < connectionPool.NumConns; whichConn++ {
+			connectionPool.MustExec(query, whichConn)
+		}
+	}
+}
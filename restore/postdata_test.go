@@ -0,0 +1,70 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/postdata tests", func() {
+	index1 := toc.StatementWithType{ObjectType: "INDEX", Name: "index1", ReferenceObject: "public.table1", Statement: "\n\nCREATE INDEX index1 ON public.table1 USING btree (i);\n"}
+	index2 := toc.StatementWithType{ObjectType: "INDEX", Name: "index2", ReferenceObject: "public.table2", Statement: "\n\nCREATE INDEX index2 ON public.table2 USING btree (i);\n"}
+	otherIndex2 := toc.StatementWithType{ObjectType: "INDEX", Name: "other_index2", ReferenceObject: "public.table2", Statement: "\n\nCREATE INDEX other_index2 ON public.table2 USING btree (j);\n"}
+	primaryKey1 := toc.StatementWithType{ObjectType: "CONSTRAINT", Name: "table1_pkey", ReferenceObject: "public.table1", Statement: "\n\nALTER TABLE ONLY public.table1 ADD CONSTRAINT table1_pkey PRIMARY KEY (i);\n"}
+	foreignKey2 := toc.StatementWithType{ObjectType: "CONSTRAINT", Name: "table2_fkey", ReferenceObject: "public.table2", Statement: "\n\nALTER TABLE ONLY public.table2 ADD CONSTRAINT table2_fkey FOREIGN KEY (i) REFERENCES public.table1(i);\n"}
+	check3 := toc.StatementWithType{ObjectType: "CONSTRAINT", Name: "table3_check", ReferenceObject: "public.table3", Statement: "\n\nALTER TABLE public.table3 ADD CONSTRAINT table3_check CHECK ((i > 0));\n"}
+	trigger2 := toc.StatementWithType{ObjectType: "TRIGGER", Name: "trigger2", ReferenceObject: "public.table2", Statement: "\n\nCREATE TRIGGER trigger2 AFTER INSERT ON public.table2 FOR EACH ROW EXECUTE PROCEDURE public.f();\n"}
+	eventTrigger := toc.StatementWithType{ObjectType: "EVENT TRIGGER", Name: "event_trigger", Statement: "\n\nCREATE EVENT TRIGGER event_trigger ON ddl_command_start\nEXECUTE PROCEDURE public.f();\n"}
+
+	getStatements := func(tasks []restore.MetadataTask) []toc.StatementWithType {
+		statements := make([]toc.StatementWithType, len(tasks))
+		for i, task := range tasks {
+			statements[i] = task.Statement
+		}
+		return statements
+	}
+	Describe("BuildPostdataTasks", func() {
+		It("orders tasks by descending table size", func() {
+			tableSizes := map[string]int64{"public.table1": 10, "public.table2": 1000, "public.table3": 100}
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{eventTrigger, index1, check3, index2}, tableSizes)
+			Expect(getStatements(tasks)).To(Equal([]toc.StatementWithType{index2, check3, index1, eventTrigger}))
+			Expect(tasks[0].TableSize).To(Equal(int64(1000)))
+		})
+		It("makes other statements on a table depend on the first index built on it", func() {
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{index1, index2, otherIndex2, trigger2, check3}, map[string]int64{})
+			Expect(tasks[0].Dependencies).To(BeEmpty())
+			Expect(tasks[1].Dependencies).To(BeEmpty())
+			Expect(tasks[2].Dependencies).To(Equal([]int{1}))
+			Expect(tasks[3].Dependencies).To(Equal([]int{1}))
+			Expect(tasks[4].Dependencies).To(BeEmpty())
+		})
+		It("treats primary key constraints as index builds", func() {
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{primaryKey1, index1}, map[string]int64{})
+			Expect(tasks[0].Dependencies).To(BeEmpty())
+			Expect(tasks[1].Dependencies).To(Equal([]int{0}))
+		})
+		It("makes foreign keys depend on the primary keys of the tables they reference", func() {
+			tableSizes := map[string]int64{"public.table1": 10, "public.table2": 1000}
+			tasks := restore.BuildPostdataTasks([]toc.StatementWithType{primaryKey1, index1, foreignKey2, index2}, tableSizes)
+			Expect(getStatements(tasks)).To(Equal([]toc.StatementWithType{foreignKey2, index2, primaryKey1, index1}))
+			Expect(tasks[0].Dependencies).To(Equal([]int{1, 2}))
+			Expect(tasks[1].Dependencies).To(BeEmpty())
+			Expect(tasks[2].Dependencies).To(BeEmpty())
+			Expect(tasks[3].Dependencies).To(Equal([]int{2}))
+		})
+	})
+	Describe("ParsePostdataGUCs", func() {
+		It("parses GUCs of the form name=value", func() {
+			gucs, err := restore.ParsePostdataGUCs([]string{"maintenance_work_mem=2GB", "gp_autostats_mode=none"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(gucs).To(Equal([][2]string{{"maintenance_work_mem", "2GB"}, {"gp_autostats_mode", "none"}}))
+		})
+		It("returns an error for a GUC without a value", func() {
+			_, err := restore.ParsePostdataGUCs([]string{"maintenance_work_mem"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid value maintenance_work_mem for --postdata-guc"))
+		})
+	})
+})
@@ -0,0 +1,121 @@
+package restore
+
+/*
+ * This file contains structs and functions related to scheduling pre-data
+ * statements across multiple connections according to the dependencies
+ * between the objects they create.
+ */
+
+import (
+	"regexp"
+	"sort"
+
+	"github.com/greenplum-db/gpbackup/toc"
+)
+
+var (
+	// These are the object types sorted by dependency during backup
+	parallelPredataObjectTypes = map[string]bool{
+		"AGGREGATE":                 true,
+		"CAST":                      true,
+		"DOMAIN":                    true,
+		"FOREIGN DATA WRAPPER":      true,
+		"FOREIGN SERVER":            true,
+		"FUNCTION":                  true,
+		"MATERIALIZED VIEW":         true,
+		"OPERATOR":                  true,
+		"OPERATOR CLASS":            true,
+		"PROTOCOL":                  true,
+		"TABLE":                     true,
+		"TEXT SEARCH CONFIGURATION": true,
+		"TEXT SEARCH DICTIONARY":    true,
+		"TEXT SEARCH PARSER":        true,
+		"TEXT SEARCH TEMPLATE":      true,
+		"TYPE":                      true,
+		"USER MAPPING":              true,
+		"VIEW":                      true,
+	}
+	shellTypeRegex = regexp.MustCompile(`^\s*CREATE TYPE [^\s;]+;\s*$`)
+	enumTypeRegex  = regexp.MustCompile(`^\s*CREATE TYPE [^\s;]+ AS ENUM \(`)
+)
+
+/*
+ * Statements are grouped into runs of consecutive statements that can be
+ * executed in parallel with each other.  Objects of the types above are
+ * ordered by the dependencies recorded in the TOC, while sequences do not
+ * depend on any objects other than their schemas.  If the backup did not
+ * record dependencies, only sequences are executed in parallel.  Shell types
+ * are excluded because the dependencies of functions on the types they create
+ * are removed to break dependency cycles during backup, and enum types are
+ * excluded because they are backed up before the sorted objects, so no
+ * dependencies on them are recorded.  Statements in no group are executed on
+ * their own.
+ */
+func getPredataGroup(statement toc.StatementWithType, hasDependencies bool) string {
+	if statement.ObjectType == "SEQUENCE" {
+		return "SEQUENCE"
+	}
+	if hasDependencies && parallelPredataObjectTypes[statement.ObjectType] && !shellTypeRegex.MatchString(statement.Statement) && !enumTypeRegex.MatchString(statement.Statement) {
+		return "DEPENDENT OBJECTS"
+	}
+	return ""
+}
+
+/*
+ * Statements in no group, and the first statement of a group that follows
+ * another group, act as boundaries and depend on every statement since the
+ * previous boundary.  Every other statement depends on the previous boundary,
+ * on the previous statement for the same object, and on the most recent
+ * statement for each object on which its object depends.  The statements must
+ * be given in the order in which they were backed up, which is already sorted
+ * by dependency.
+ */
+func BuildPredataTasks(statements []toc.StatementWithType, dependencyGraph map[toc.ObjectKey][]toc.ObjectKey, hasDependencies bool) []MetadataTask {
+	tasks := make([]MetadataTask, len(statements))
+	lastStatements := make(map[toc.ObjectKey]int)
+	lastBoundary := -1
+	currentGroup := ""
+	groupStatements := make([]int, 0)
+	for i, statement := range statements {
+		key := toc.ObjectKey{Schema: statement.Schema, Name: statement.Name, ObjectType: statement.ObjectType}
+		group := getPredataGroup(statement, hasDependencies)
+		dependencies := make(map[int]bool)
+		if group == "" || group != currentGroup {
+			if len(groupStatements) > 0 {
+				for _, dependency := range groupStatements {
+					dependencies[dependency] = true
+				}
+				lastBoundary = i
+			} else if lastBoundary >= 0 {
+				dependencies[lastBoundary] = true
+			}
+			if group == "" {
+				lastBoundary = i
+			}
+			currentGroup = group
+			groupStatements = make([]int, 0)
+		} else if lastBoundary >= 0 {
+			dependencies[lastBoundary] = true
+		}
+
+		if group != "" {
+			if previous, ok := lastStatements[key]; ok {
+				dependencies[previous] = true
+			}
+			for _, dependency := range dependencyGraph[key] {
+				if previous, ok := lastStatements[dependency]; ok {
+					dependencies[previous] = true
+				}
+			}
+			groupStatements = append(groupStatements, i)
+		}
+		lastStatements[key] = i
+
+		tasks[i] = MetadataTask{Statement: statement, Dependencies: []int{}}
+		for dependency := range dependencies {
+			tasks[i].Dependencies = append(tasks[i].Dependencies, dependency)
+		}
+		sort.Ints(tasks[i].Dependencies)
+	}
+	return tasks
+}
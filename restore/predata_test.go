@@ -0,0 +1,72 @@
+package restore_test
+
+import (
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/predata tests", func() {
+	extension := toc.StatementWithType{ObjectType: "EXTENSION", Name: "plperl", Statement: "\n\nCREATE EXTENSION IF NOT EXISTS plperl WITH SCHEMA pg_catalog;\n"}
+	sequence1 := toc.StatementWithType{ObjectType: "SEQUENCE", Schema: "public", Name: "seq1", Statement: "\n\nCREATE SEQUENCE public.seq1;\n"}
+	sequence2 := toc.StatementWithType{ObjectType: "SEQUENCE", Schema: "public", Name: "seq2", Statement: "\n\nCREATE SEQUENCE public.seq2;\n"}
+	shellType := toc.StatementWithType{ObjectType: "TYPE", Schema: "public", Name: "base_type", Statement: "CREATE TYPE public.base_type;\n"}
+	enumType := toc.StatementWithType{ObjectType: "TYPE", Schema: "public", Name: "enum_type", Statement: "\n\nCREATE TYPE public.enum_type AS ENUM (\n\t'a',\n\t'b'\n);\n"}
+	enumTypeOwner := toc.StatementWithType{ObjectType: "TYPE", Schema: "public", Name: "enum_type", Statement: "\n\nALTER TYPE public.enum_type OWNER TO testrole;\n"}
+	function1 := toc.StatementWithType{ObjectType: "FUNCTION", Schema: "public", Name: "func1(integer)", Statement: "\n\nCREATE FUNCTION public.func1(integer) RETURNS integer AS $$SELECT 1$$ LANGUAGE sql;\n"}
+	function1Owner := toc.StatementWithType{ObjectType: "FUNCTION", Schema: "public", Name: "func1(integer)", Statement: "\n\nALTER FUNCTION public.func1(integer) OWNER TO testrole;\n"}
+	function2 := toc.StatementWithType{ObjectType: "FUNCTION", Schema: "public", Name: "func2(integer)", Statement: "\n\nCREATE FUNCTION public.func2(integer) RETURNS integer AS $$SELECT 2$$ LANGUAGE sql;\n"}
+	table1 := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "table1", Statement: "\n\nCREATE TABLE public.table1 (\n\ti integer DEFAULT public.func1(1)\n) DISTRIBUTED BY (i);\n"}
+	table2 := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "table2", Statement: "\n\nCREATE TABLE public.table2 (\n\te public.enum_type\n) DISTRIBUTED RANDOMLY;\n"}
+	view1 := toc.StatementWithType{ObjectType: "VIEW", Schema: "public", Name: "view1", Statement: "\n\nCREATE VIEW public.view1 AS  SELECT table1.i FROM public.table1;\n"}
+	sequenceOwner := toc.StatementWithType{ObjectType: "SEQUENCE OWNER", Schema: "public", Name: "seq1", ReferenceObject: "public.table1", Statement: "\n\nALTER SEQUENCE public.seq1 OWNED BY public.table1.i;\n"}
+
+	dependencyGraph := map[toc.ObjectKey][]toc.ObjectKey{
+		{Schema: "public", Name: "table1", ObjectType: "TABLE"}: {{Schema: "public", Name: "func1(integer)", ObjectType: "FUNCTION"}},
+		{Schema: "public", Name: "view1", ObjectType: "VIEW"}:   {{Schema: "public", Name: "table1", ObjectType: "TABLE"}},
+	}
+	getDependencies := func(tasks []restore.MetadataTask) [][]int {
+		dependencies := make([][]int, len(tasks))
+		for i, task := range tasks {
+			dependencies[i] = task.Dependencies
+		}
+		return dependencies
+	}
+	Describe("BuildPredataTasks", func() {
+		It("schedules dependent objects according to the dependency graph", func() {
+			statements := []toc.StatementWithType{extension, function1, function2, function1Owner, table1, view1, sequenceOwner}
+			tasks := restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {0}, {0, 1}, {0, 3}, {0, 4}, {1, 2, 3, 4, 5}}))
+		})
+		It("executes sequences in parallel with each other but not with other objects", func() {
+			statements := []toc.StatementWithType{extension, sequence1, sequence2, function1, function2, sequenceOwner}
+			tasks := restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {0}, {1, 2}, {3}, {3, 4}}))
+		})
+		It("executes shell types on their own", func() {
+			statements := []toc.StatementWithType{shellType, function1, function2}
+			tasks := restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {0}}))
+
+			statements = []toc.StatementWithType{function1, shellType, function2}
+			tasks = restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {1}}))
+		})
+		It("executes enum types on their own, before the tables that use them", func() {
+			statements := []toc.StatementWithType{enumType, enumTypeOwner, table2}
+			tasks := restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {0}}))
+
+			statements = []toc.StatementWithType{function1, enumType, table2}
+			tasks = restore.BuildPredataTasks(statements, dependencyGraph, true)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {0}, {1}}))
+		})
+		It("executes everything but sequences serially without dependency information", func() {
+			statements := []toc.StatementWithType{sequence1, sequence2, function1, function2, table1}
+			tasks := restore.BuildPredataTasks(statements, map[toc.ObjectKey][]toc.ObjectKey{}, false)
+			Expect(getDependencies(tasks)).To(Equal([][]int{{}, {}, {0, 1}, {2}, {3}}))
+		})
+	})
+})
@@ -30,33 +30,55 @@ import (
 func initializeFlags(cmd *cobra.Command) {
 	SetFlagDefaults(cmd.Flags())
 
-	_ = cmd.MarkFlagRequired(options.TIMESTAMP)
-
 	cmdFlags = cmd.Flags()
 }
 func SetFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(options.BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be restored are located")
+	flagSet.String(options.CONFIG, "", "A YAML file containing values for any of the flags listed here, which are overridden by flags given on the command line")
+	flagSet.Int(options.COPY_TIMEOUT, 0, "Cancel the COPY of any table's data that runs for longer than the specified number of minutes, and record the table as failed")
 	flagSet.Bool(options.CREATE_DB, false, "Create the database before metadata restore")
 	flagSet.Bool(options.DATA_ONLY, false, "Only restore data, do not restore metadata")
+	flagSet.Int(options.DATA_TIMEOUT, 0, "Cancel the COPY commands in progress once restoring table data has taken the specified number of minutes, and record their tables as failed")
 	flagSet.Bool(options.DEBUG, false, "Print verbose and debug log messages")
 	flagSet.StringArray(options.EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(options.EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will not be restored")
 	flagSet.StringArray(options.EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
 	flagSet.String(options.EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will not be restored")
 	flagSet.Bool("help", false, "Help for gprestore")
+	flagSet.String(options.HOOK_CONFIG, "", "The configuration file listing hooks to run before and after phases of the restore")
+	flagSet.Int(options.INACTIVITY_TIMEOUT, 0, "Cancel the COPY commands in progress if no table data is restored for the specified number of minutes, and record their tables as failed")
 	flagSet.StringArray(options.INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.String(options.INCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will be restored")
 	flagSet.StringArray(options.INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
 	flagSet.String(options.INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will be restored")
+	flagSet.Bool(options.INCLUDE_DEPENDENCIES, false, "Also restore the objects on which the relations specified with --include-table or --include-table-file depend")
+	flagSet.Bool(options.INCLUDE_DEPENDENTS, false, "With --include-dependencies, also restore the objects that depend on the included relations, such as views")
 	flagSet.Bool(options.INCREMENTAL, false, "BETA FEATURE: Only restore data for all heap tables and only AO tables that have been modified since the last backup")
+	flagSet.Int(options.IO_NICE_LEVEL, -1, "The best-effort I/O scheduling priority, from 0 (highest) to 7 (lowest), with which to read data files on the segments")
+	flagSet.String(options.MAX_BANDWIDTH, "", "The maximum rate, such as 500MB, at which all segments together may read data files, per second")
+	flagSet.String(options.MAX_BANDWIDTH_PER_HOST, "", "The maximum rate, such as 100MB, at which the segments on each host may read data files, per second")
 	flagSet.Bool(options.METADATA_ONLY, false, "Only restore metadata, do not restore data")
-	flagSet.Int(options.JOBS, 1, "Number of parallel connections to use when restoring table data and post-data")
+	flagSet.Int(options.JOBS, 1, "Number of parallel connections to use when restoring table data and metadata")
 	flagSet.Bool(options.ON_ERROR_CONTINUE, false, "Log errors and continue restore, instead of exiting on first error")
 	flagSet.String(options.PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.StringArray(options.POSTDATA_GUC, []string{}, "Set the specified configuration parameter, in the form name=value, on each connection while restoring post-data objects such as indexes and constraints. --postdata-guc can be specified multiple times.")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(options.QUIET, false, "Suppress non-warning, non-error log messages")
 	flagSet.String(options.REDIRECT_DB, "", "Restore to the specified database instead of the database that was backed up")
+	flagSet.Bool(options.EXTERNAL_AS_HEAP, false, "Restore external tables whose data was backed up with --materialize-external-tables as heap tables containing that data")
+	flagSet.Bool(options.NO_EXTERNAL_TABLES, false, "Do not restore external and web tables")
+	flagSet.Bool(options.NO_OWNER, false, "Do not restore the ownership of objects, so that they are owned by the user running the restore")
+	flagSet.Bool(options.NO_PRIVILEGES, false, "Do not restore GRANT and REVOKE statements for objects, or default privileges")
+	flagSet.Bool(options.NO_TABLESPACES, false, "Restore all objects into the default tablespace, and do not restore tablespaces when used with --with-globals")
+	flagSet.Int(options.REJECT_LIMIT, 0, "Skip rows that fail to load during data restore, up to the specified number of rows (at least 2) per table per segment, and log them to each table's error log")
 	flagSet.String(options.REDIRECT_SCHEMA, "", "Restore to the specified schema instead of the schema that was backed up")
+	flagSet.String(options.EXTERNAL_LOCATION_MAP, "", "A YAML file containing rules for rewriting the locations of restored external tables")
+	flagSet.String(options.OWNER_MAP, "", "A YAML file mapping roles in the backup to the roles that should own and be granted privileges on the restored objects")
+	flagSet.String(options.TABLESPACE_MAP, "", "A YAML file mapping tablespaces in the backup to the names, and with --with-globals the locations, to use in the restore database")
+	flagSet.String(options.TABLE_OVERRIDES, "", "A YAML file containing rules for overriding the storage options and distribution policies of restored tables")
+	flagSet.Bool(options.TRUNCATE_TABLE, false, "Remove the existing data in the tables specified with --include-table or --include-table-file before restoring their data as of the backup with the specified timestamp")
+	flagSet.StringArray(options.SECTION, []string{}, "Restore only the specified section(s) of the backup: predata, data, postdata, or statistics. --section can be specified multiple times.")
+	flagSet.String(options.RETRY_ERRORS_FROM, "", "Restore only the objects recorded in the error files of the previous restore of this backup with the specified timestamp, in the format YYYYMMDDHHMMSS")
 	flagSet.Bool(options.WITH_GLOBALS, false, "Restore global metadata")
 	flagSet.String(options.TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
 	flagSet.Bool(options.VERBOSE, false, "Print verbose log messages")
@@ -79,14 +101,49 @@ func DoInit(cmd *cobra.Command) {
 * It should only validate; initialization with any sort of side effects should go in DoInit or DoSetup.
  */
 func DoValidation(cmd *cobra.Command) {
+	err := options.ApplyConfigFile(cmd.Flags())
+	gplog.FatalOnError(err)
+	options.CheckRequiredFlags(cmd.Flags(), options.TIMESTAMP)
 	ValidateFlagCombinations(cmd.Flags())
-	err := utils.ValidateFullPath(MustGetFlagString(options.BACKUP_DIR))
+	err = utils.ValidateFullPath(MustGetFlagString(options.BACKUP_DIR))
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.HOOK_CONFIG))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.TABLESPACE_MAP))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.OWNER_MAP))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.EXTERNAL_LOCATION_MAP))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.TABLE_OVERRIDES))
+	gplog.FatalOnError(err)
+	_, err = ParsePostdataGUCs(MustGetFlagStringArray(options.POSTDATA_GUC))
+	gplog.FatalOnError(err)
+	err = ValidateSections(getSections())
+	gplog.FatalOnError(err)
 	if !filepath.IsValidTimestamp(MustGetFlagString(options.TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", MustGetFlagString(options.TIMESTAMP)), "")
 	}
+	// GPDB rejects a SEGMENT REJECT LIMIT of fewer than 2 rows
+	if cmd.Flags().Changed(options.REJECT_LIMIT) && MustGetFlagInt(options.REJECT_LIMIT) < 2 {
+		gplog.Fatal(errors.Errorf("--reject-limit must be an integer of at least 2"), "")
+	}
+	for _, timeoutFlag := range []string{options.COPY_TIMEOUT, options.DATA_TIMEOUT, options.INACTIVITY_TIMEOUT} {
+		err = utils.ValidateTimeout(timeoutFlag, MustGetFlagInt(timeoutFlag))
+		gplog.FatalOnError(err)
+	}
+	for _, bandwidthFlag := range []string{options.MAX_BANDWIDTH, options.MAX_BANDWIDTH_PER_HOST} {
+		_, err = utils.ParseBandwidth(MustGetFlagString(bandwidthFlag))
+		gplog.FatalOnError(err)
+	}
+	err = utils.ValidateIONiceLevel(MustGetFlagInt(options.IO_NICE_LEVEL))
+	gplog.FatalOnError(err)
+	retryTimestamp := MustGetFlagString(options.RETRY_ERRORS_FROM)
+	if retryTimestamp != "" && !filepath.IsValidTimestamp(retryTimestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", retryTimestamp), "")
+	}
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -97,6 +154,32 @@ func DoSetup() {
 	utils.CheckGpexpandRunning(utils.RestorePreventedByGpexpandMessage)
 	restoreStartTime = history.CurrentTimestamp()
 	gplog.Info("Restore Key = %s", MustGetFlagString(options.TIMESTAMP))
+	if MustGetFlagString(options.HOOK_CONFIG) != "" {
+		var err error
+		hookConfig, err = utils.ReadHookConfig(MustGetFlagString(options.HOOK_CONFIG))
+		gplog.FatalOnError(err)
+	}
+	runHooks(utils.HOOK_BEFORE_SETUP)
+	if MustGetFlagString(options.TABLESPACE_MAP) != "" {
+		var err error
+		tablespaceMap, err = ReadTablespaceMap(MustGetFlagString(options.TABLESPACE_MAP))
+		gplog.FatalOnError(err)
+	}
+	if MustGetFlagString(options.OWNER_MAP) != "" {
+		var err error
+		ownerMap, err = ReadOwnerMap(MustGetFlagString(options.OWNER_MAP))
+		gplog.FatalOnError(err)
+	}
+	if MustGetFlagString(options.EXTERNAL_LOCATION_MAP) != "" {
+		var err error
+		externalLocationMap, err = ReadExternalLocationMap(MustGetFlagString(options.EXTERNAL_LOCATION_MAP))
+		gplog.FatalOnError(err)
+	}
+	if MustGetFlagString(options.TABLE_OVERRIDES) != "" {
+		var err error
+		tableOverrides, err = ReadTableOverrides(MustGetFlagString(options.TABLE_OVERRIDES))
+		gplog.FatalOnError(err)
+	}
 
 	CreateConnectionPool("postgres")
 
@@ -111,6 +194,8 @@ func DoSetup() {
 	globalCluster = cluster.NewCluster(segConfig)
 	segPrefix := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), MustGetFlagString(options.TIMESTAMP))
 	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), MustGetFlagString(options.TIMESTAMP), segPrefix)
+	err = utils.InitializeDataThrottle(globalCluster, MustGetFlagString(options.MAX_BANDWIDTH), MustGetFlagString(options.MAX_BANDWIDTH_PER_HOST), MustGetFlagInt(options.IO_NICE_LEVEL))
+	gplog.FatalOnError(err)
 
 	// Get restore metadata from plugin
 	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
@@ -120,6 +205,12 @@ func DoSetup() {
 	}
 
 	BackupConfigurationValidation()
+	if MustGetFlagBool(options.INCLUDE_DEPENDENCIES) {
+		includeDependencies(MustGetFlagBool(options.INCLUDE_DEPENDENTS))
+	}
+	if isRetry() {
+		retryMetadataObjects, retryDataTables = ReadErrorTablesForRetry(globalFPInfo, MustGetFlagString(options.RETRY_ERRORS_FROM))
+	}
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
 	if !backupConfig.DataOnly {
 		gplog.Verbose("Metadata will be restored from %s", metadataFilename)
@@ -138,14 +229,18 @@ func DoSetup() {
 		connectionPool.Close()
 	}
 	InitializeConnectionPool(unquotedRestoreDatabase)
+	if MustGetFlagInt(options.REJECT_LIMIT) > 0 && connectionPool.Version.Before("5") {
+		gplog.Fatal(errors.Errorf("--reject-limit requires GPDB 5 or later"), "")
+	}
 
 	/*
 	 * We don't need to validate anything if we're creating the database; we
 	 * should not error out for validation reasons once the restore database exists.
 	 * For on-error-continue, we will see the same errors later when we try to run SQL,
 	 * but since they will not stop the restore, it is not necessary to log them twice.
+	 * When retrying a previous restore, some of the relations are expected to exist.
 	 */
-	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) {
+	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) && !isRetry() {
 		relationsToRestore := GenerateRestoreRelationList(*opts)
 		if opts.RedirectSchema != "" {
 			fqns, err := options.SeparateSchemaAndTable(relationsToRestore)
@@ -162,33 +257,50 @@ func DoSetup() {
 	if opts.RedirectSchema != "" {
 		ValidateRedirectSchema(connectionPool, opts.RedirectSchema)
 	}
+	runHooks(utils.HOOK_AFTER_SETUP)
 }
 
 func DoRestore() {
 	metadataFilename := globalFPInfo.GetMetadataFilePath()
-	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
-	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(options.METADATA_ONLY)
-
-	if !isDataOnly {
+	shouldRestorePredata := !backupConfig.DataOnly && sectionRequested(SECTION_PREDATA)
+	shouldRestoreData := !backupConfig.MetadataOnly && sectionRequested(SECTION_DATA)
+	shouldRestorePostdata := !backupConfig.DataOnly && sectionRequested(SECTION_POSTDATA)
+	if isRetry() {
+		// Skip any section in which the previous restore had no errors
+		shouldRestorePredata = shouldRestorePredata && len(retryMetadataObjects) > 0
+		shouldRestoreData = shouldRestoreData && len(retryDataTables) > 0
+		shouldRestorePostdata = shouldRestorePostdata && len(retryMetadataObjects) > 0
+	}
+
+	if shouldRestorePredata {
+		runHooks(utils.HOOK_BEFORE_PREDATA)
 		restorePredata(metadataFilename)
+		runHooks(utils.HOOK_AFTER_PREDATA)
 	}
 
-	if !isMetadataOnly {
+	if shouldRestoreData {
 		if MustGetFlagString(options.PLUGIN_CONFIG) == "" {
 			backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
+			if backupConfig.DataFilesPerSegment > 1 {
+				backupFileCount = backupConfig.DataFilesPerSegment + 1
+			}
 			if !backupConfig.SingleDataFile {
 				backupFileCount = len(globalTOC.DataEntries)
 			}
 			VerifyBackupFileCountOnSegments(backupFileCount)
 		}
+		runHooks(utils.HOOK_BEFORE_DATA)
 		restoreData()
+		runHooks(utils.HOOK_AFTER_DATA)
 	}
 
-	if !isDataOnly {
+	if shouldRestorePostdata {
+		runHooks(utils.HOOK_BEFORE_POSTDATA)
 		restorePostdata(metadataFilename)
+		runHooks(utils.HOOK_AFTER_POSTDATA)
 	}
 
-	if MustGetFlagBool(options.WITH_STATS) && backupConfig.WithStatistics {
+	if sectionRequested(SECTION_STATISTICS) && backupConfig.WithStatistics {
 		restoreStatistics()
 	}
 }
@@ -203,6 +315,8 @@ func createDatabase(metadataFilename string) {
 		dbName = quotedDBName
 		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
 	}
+	statements = editStatementsTablespaces(statements)
+	statements = editStatementsRoles(statements)
 	ExecuteRestoreMetadataStatements(statements, "", nil, utils.PB_NONE, false)
 	gplog.Info("Database creation complete for: %s", dbName)
 }
@@ -219,6 +333,8 @@ func restoreGlobal(metadataFilename string) {
 		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
 	}
 	statements = toc.RemoveActiveRole(connectionPool.User, statements)
+	statements = editStatementsTablespaces(statements)
+	statements = editStatementsRoles(statements)
 	ExecuteRestoreMetadataStatements(statements, "Global objects", nil, utils.PB_VERBOSE, false)
 	gplog.Info("Global database metadata restore complete")
 }
@@ -299,13 +415,25 @@ func restorePredata(metadataFilename string) {
 		schemaStatements = GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SCHEMA"}, []string{}, filters)
 	}
 	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{"SCHEMA"}, filters)
+	if isRetry() {
+		schemaStatements = toc.FilterStatementsByObjectFQN(schemaStatements, retryMetadataObjects)
+		statements = toc.FilterStatementsByObjectFQN(statements, retryMetadataObjects)
+	}
 
 	editStatementsRedirectSchema(statements, opts.RedirectSchema)
-	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
+	tableOverridesApplied = editStatementsTableOverrides(statements, tableOverrides)
+	statements = editStatementsTablespaces(statements)
+	statements = editStatementsRoles(statements)
+	statements = editStatementsExternalTables(statements)
+	schemaStatements = editStatementsRoles(schemaStatements)
+	// Redirected statements no longer match the objects in the dependency graph
+	hasDependencies := globalTOC.HasDependencies && opts.RedirectSchema == ""
+	tasks := BuildPredataTasks(statements, globalTOC.GetDependencyGraph(), hasDependencies)
+	progressBar := utils.NewProgressBar(len(schemaStatements)+len(tasks), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
 	RestoreSchemas(schemaStatements, progressBar)
-	ExecuteRestoreMetadataStatements(statements, "Pre-data objects", progressBar, utils.PB_VERBOSE, false)
+	ExecuteMetadataTasks(tasks, progressBar)
 
 	progressBar.Finish()
 	if wasTerminated {
@@ -347,6 +475,16 @@ func restoreData() {
 		}
 	}
 
+	includeRelations := opts.IncludedRelations
+	if isRetry() {
+		includeRelations = retryDataTables
+	}
+
+	/*
+	 * Each table's data as of the backup being restored is in exactly one
+	 * backup of its incremental backup set, listed in the restore plan, so
+	 * each table is restored only from that backup and no others.
+	 */
 	totalTables := 0
 	filteredDataEntries := make(map[string][]toc.MasterDataEntry)
 	for _, entry := range restorePlanEntries {
@@ -354,21 +492,34 @@ func restoreData() {
 		tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
 		restorePlanTableFQNs := entry.TableFQNs
 		filteredDataEntriesForTimestamp := tocfile.GetDataEntriesMatching(opts.IncludedSchemas,
-			opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations, restorePlanTableFQNs)
+			opts.ExcludedSchemas, includeRelations, opts.ExcludedRelations, restorePlanTableFQNs)
+		filteredDataEntriesForTimestamp = filterMaterializedExternalDataEntries(filteredDataEntriesForTimestamp)
 		filteredDataEntries[entry.Timestamp] = filteredDataEntriesForTimestamp
 		totalTables += len(filteredDataEntriesForTimestamp)
+		if len(includeRelations) > 0 {
+			for _, dataEntry := range filteredDataEntriesForTimestamp {
+				gplog.Verbose("Data for table %s as of backup %s will be restored from backup %s",
+					utils.MakeFQN(dataEntry.Schema, dataEntry.Name), globalFPInfo.Timestamp, entry.Timestamp)
+			}
+		}
+	}
+	if MustGetFlagBool(options.TRUNCATE_TABLE) {
+		truncateTablesBeforeDataRestore(filteredDataEntries)
 	}
 	dataProgressBar := utils.NewProgressBar(totalTables, "Tables restored: ", utils.PB_INFO)
 	dataProgressBar.Start()
 
+	copyWatchdog = utils.NewCopyWatchdogFromMinutes(MustGetFlagInt(options.COPY_TIMEOUT), MustGetFlagInt(options.DATA_TIMEOUT), MustGetFlagInt(options.INACTIVITY_TIMEOUT))
+	copyWatchdog.Start()
 	gucStatements := setGUCsForConnection(nil, 0)
 	for timestamp, entries := range filteredDataEntries {
 		gplog.Verbose("Restoring data from backup with timestamp: %s", timestamp)
-		if MustGetFlagBool(options.INCREMENTAL) {
+		if MustGetFlagBool(options.INCREMENTAL) && len(entries) > 0 {
 			_ = TruncateTablesBeforeRestore(entries)
 		}
 		restoreDataFromTimestamp(GetBackupFPInfoForTimestamp(timestamp), entries, gucStatements, dataProgressBar)
 	}
+	copyWatchdog.Stop()
 
 	dataProgressBar.Finish()
 	if wasTerminated {
@@ -378,6 +529,23 @@ func restoreData() {
 	}
 }
 
+/*
+ * All of the tables are truncated before any data is restored, so that a
+ * failure to truncate one of them does not leave others partially restored.
+ */
+func truncateTablesBeforeDataRestore(filteredDataEntries map[string][]toc.MasterDataEntry) {
+	entriesToTruncate := make([]toc.MasterDataEntry, 0)
+	for _, entries := range filteredDataEntries {
+		entriesToTruncate = append(entriesToTruncate, entries...)
+	}
+	if len(entriesToTruncate) == 0 {
+		return
+	}
+	gplog.Info("Truncating %d table(s) before restoring their data", len(entriesToTruncate))
+	err := TruncateTablesBeforeRestore(entriesToTruncate)
+	gplog.FatalOnError(err, "Unable to truncate tables before restoring their data")
+}
+
 func restorePostdata(metadataFilename string) {
 	if wasTerminated {
 		return
@@ -387,13 +555,25 @@ func restorePostdata(metadataFilename string) {
 	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
 
 	statements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{}, filters)
+	if isRetry() {
+		statements = toc.FilterStatementsByObjectFQN(statements, retryMetadataObjects)
+	}
 	editStatementsRedirectSchema(statements, opts.RedirectSchema)
-	firstBatch, secondBatch := BatchPostdataStatements(statements)
-	progressBar := utils.NewProgressBar(len(statements), "Post-data objects restored: ", utils.PB_VERBOSE)
+	statements = editStatementsTablespaces(statements)
+	statements = editStatementsRoles(statements)
+	tableSizes, err := GetTableSizes(statements)
+	if err != nil {
+		gplog.Warn("Unable to retrieve table sizes for scheduling post-data objects: %v", err)
+	}
+	tasks := BuildPostdataTasks(statements, tableSizes)
+	postdataGUCs, _ := ParsePostdataGUCs(MustGetFlagStringArray(options.POSTDATA_GUC))
+	setPostdataGUCs(postdataGUCs, false)
+	progressBar := utils.NewProgressBar(len(tasks), "Post-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
-	ExecuteRestoreMetadataStatements(firstBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
-	ExecuteRestoreMetadataStatements(secondBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
+	ExecuteMetadataTasks(tasks, progressBar)
 	progressBar.Finish()
+	setPostdataGUCs(postdataGUCs, true)
+	WritePostdataTimings(globalFPInfo.GetPostdataTimingsFilePath(restoreStartTime), tasks)
 	if wasTerminated {
 		gplog.Info("Post-data metadata restore incomplete")
 	} else {
@@ -419,6 +599,9 @@ func restoreStatistics() {
 func DoTeardown() {
 	restoreFailed := false
 	defer func() {
+		if restoreFailed {
+			runHooks(utils.HOOK_ON_FAILURE)
+		}
 		DoCleanup(restoreFailed)
 
 		errorCode := gplog.GetErrorCode()
@@ -462,8 +645,9 @@ func DoTeardown() {
 			return
 		}
 		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
-		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
+		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg, rejectedRowsData, tableOverridesApplied, options.GetEffectiveFlags(cmdFlags))
 		report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore")
+		report.SendNotifications(globalFPInfo.Timestamp, reportFilename, "gprestore")
 		if pluginConfig != nil {
 			pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
 			pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
@@ -1,7 +1,18 @@
 package restore
 
 import (
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -55,4 +66,544 @@ var _ = Describe("restore internal tests", func() {
 			Expect(statements).To(Equal(expectedStatements))
 		})
 	})
+	Describe("ReadTablespaceMap", func() {
+		var mapFile *os.File
+		BeforeEach(func() {
+			mapFile, _ = ioutil.TempFile("", "tablespace_map.yaml")
+		})
+		AfterEach(func() {
+			_ = os.Remove(mapFile.Name())
+		})
+		It("reads tablespace names and locations", func() {
+			_, _ = mapFile.WriteString("tablespaces:\n  fast_ssd:\n    name: dr_disk\n    location: /dr/disk\n    segment_locations:\n      0: /dr/disk0\n")
+			_ = mapFile.Close()
+
+			tablespaceMap, err := ReadTablespaceMap(mapFile.Name())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tablespaceMap.Tablespaces).To(Equal(map[string]TablespaceMapping{
+				"fast_ssd": {Name: "dr_disk", Location: "/dr/disk", SegmentLocations: map[int]string{0: "/dr/disk0"}},
+			}))
+		})
+		It("returns an error for a relative location", func() {
+			_, _ = mapFile.WriteString("tablespaces:\n  fast_ssd:\n    location: dr/disk\n")
+			_ = mapFile.Close()
+
+			_, err := ReadTablespaceMap(mapFile.Name())
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("dr/disk is not an absolute path."))
+		})
+	})
+	Describe("editStatementsTablespaceMap", func() {
+		tableStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo", ObjectType: "TABLE",
+			Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE fast_ssd DISTRIBUTED BY (i);\n",
+		}
+		indexStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo",
+			Statement: "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\nALTER INDEX public.foo_idx SET TABLESPACE fast_ssd_2;\n",
+		}
+		createStatement := toc.StatementWithType{
+			Name: "fast_ssd", ObjectType: "TABLESPACE",
+			Statement: "\n\nCREATE TABLESPACE fast_ssd LOCATION '/data/ssd'\n\tWITH (content0='/data/ssd0', content1='/data/ssd1');",
+		}
+		ownerStatement := toc.StatementWithType{
+			Name: "fast_ssd", ObjectType: "TABLESPACE",
+			Statement: "\n\nALTER TABLESPACE fast_ssd OWNER TO testrole;\n",
+		}
+		functionStatement := toc.StatementWithType{
+			Schema: "public", Name: "func", ObjectType: "FUNCTION",
+			Statement: "\n\nCREATE FUNCTION public.func() RETURNS text AS $$SELECT 'TABLESPACE fast_ssd'$$ LANGUAGE sql;\n",
+		}
+		It("does not alter statements if no tablespace map was specified", func() {
+			statements := []toc.StatementWithType{tableStatement, indexStatement}
+			editStatementsTablespaceMap(statements, nil)
+			Expect(statements).To(Equal([]toc.StatementWithType{tableStatement, indexStatement}))
+		})
+		It("replaces mapped tablespace names in TABLESPACE clauses", func() {
+			statements := []toc.StatementWithType{tableStatement, indexStatement, ownerStatement, functionStatement}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Name: "dr_disk"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE dr_disk DISTRIBUTED BY (i);\n"))
+			Expect(statements[1]).To(Equal(indexStatement))
+			Expect(statements[2].Name).To(Equal("dr_disk"))
+			Expect(statements[2].Statement).To(Equal("\n\nALTER TABLESPACE dr_disk OWNER TO testrole;\n"))
+			Expect(statements[3]).To(Equal(functionStatement))
+		})
+		It("renames each tablespace only once when mappings are swapped", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE fast_ssd DISTRIBUTED BY (i);\n"},
+				{Schema: "public", Name: "bar", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.bar (\n\ti integer\n) TABLESPACE slow_hdd DISTRIBUTED BY (i);\n"},
+				{Name: "fast_ssd", ObjectType: "TABLESPACE", Statement: "\n\nALTER TABLESPACE fast_ssd OWNER TO testrole;\n"},
+			}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Name: "slow_hdd"}, "slow_hdd": {Name: "fast_ssd"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE slow_hdd DISTRIBUTED BY (i);\n"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE TABLE public.bar (\n\ti integer\n) TABLESPACE fast_ssd DISTRIBUTED BY (i);\n"))
+			Expect(statements[2].Name).To(Equal("slow_hdd"))
+			Expect(statements[2].Statement).To(Equal("\n\nALTER TABLESPACE slow_hdd OWNER TO testrole;\n"))
+		})
+		It("renames each tablespace only once when mappings are chained", func() {
+			statements := []toc.StatementWithType{tableStatement, indexStatement}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Name: "fast_ssd_2"}, "fast_ssd_2": {Name: "dr_disk"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE fast_ssd_2 DISTRIBUTED BY (i);\n"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\nALTER INDEX public.foo_idx SET TABLESPACE dr_disk;\n"))
+		})
+		It("does not replace tablespace names in string literals, quoted identifiers, or comments", func() {
+			mviewStatement := toc.StatementWithType{
+				Schema: "public", Name: "mview", ObjectType: "MATERIALIZED VIEW",
+				Statement: "\n\nCREATE MATERIALIZED VIEW public.mview TABLESPACE fast_ssd AS SELECT 'TABLESPACE fast_ssd' AS \"TABLESPACE fast_ssd\", $x$TABLESPACE fast_ssd$x$ -- TABLESPACE fast_ssd\n FROM public.foo /* TABLESPACE fast_ssd */\nWITH NO DATA;\n",
+			}
+			statements := []toc.StatementWithType{mviewStatement}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Name: "dr_disk"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE MATERIALIZED VIEW public.mview TABLESPACE dr_disk AS SELECT 'TABLESPACE fast_ssd' AS \"TABLESPACE fast_ssd\", $x$TABLESPACE fast_ssd$x$ -- TABLESPACE fast_ssd\n FROM public.foo /* TABLESPACE fast_ssd */\nWITH NO DATA;\n"))
+		})
+		It("replaces the location of a mapped tablespace and drops its segment locations", func() {
+			statements := []toc.StatementWithType{createStatement}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Name: "dr_disk", Location: "/dr/disk"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLESPACE dr_disk LOCATION '/dr/disk';"))
+		})
+		It("replaces the segment locations of a mapped tablespace", func() {
+			statements := []toc.StatementWithType{createStatement}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {SegmentLocations: map[int]string{1: "/dr/disk1", 0: "/dr/disk0"}}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLESPACE fast_ssd LOCATION '/data/ssd'\n\tWITH (content0='/dr/disk0', content1='/dr/disk1');"))
+		})
+		It("replaces the filespace of a mapped tablespace", func() {
+			statements := []toc.StatementWithType{{Name: "fast_ssd", ObjectType: "TABLESPACE", Statement: "\n\nCREATE TABLESPACE fast_ssd FILESPACE ssd_filespace;"}}
+			tablespaceMap := &TablespaceMap{Tablespaces: map[string]TablespaceMapping{"fast_ssd": {Filespace: "dr_filespace"}}}
+
+			editStatementsTablespaceMap(statements, tablespaceMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLESPACE fast_ssd FILESPACE dr_filespace;"))
+		})
+	})
+	Describe("removeTablespacesFromStatements", func() {
+		It("removes TABLESPACE clauses and tablespace objects", func() {
+			statements := []toc.StatementWithType{
+				{
+					Schema: "public", Name: "foo", ObjectType: "TABLE",
+					Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) TABLESPACE fast_ssd DISTRIBUTED BY (i);\n",
+				},
+				{
+					Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo",
+					Statement: "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\nALTER INDEX public.foo_idx SET TABLESPACE \"Fast SSD\";\n",
+				},
+				{
+					Schema: "public", Name: "mview", ObjectType: "MATERIALIZED VIEW",
+					Statement: "\n\nCREATE MATERIALIZED VIEW public.mview TABLESPACE fast_ssd AS SELECT 1\nWITH NO DATA;\n",
+				},
+				{
+					Name: "fast_ssd", ObjectType: "TABLESPACE",
+					Statement: "\n\nCREATE TABLESPACE fast_ssd LOCATION '/data/ssd';",
+				},
+			}
+
+			statements = removeTablespacesFromStatements(statements)
+
+			Expect(statements).To(HaveLen(3))
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\n"))
+			Expect(statements[2].Statement).To(Equal("\n\nCREATE MATERIALIZED VIEW public.mview AS SELECT 1\nWITH NO DATA;\n"))
+		})
+		It("does not remove TABLESPACE text from string literals or comments", func() {
+			statements := []toc.StatementWithType{
+				{
+					Schema: "public", Name: "mview", ObjectType: "MATERIALIZED VIEW",
+					Statement: "\n\nCREATE MATERIALIZED VIEW public.mview TABLESPACE fast_ssd AS SELECT E'it''s \\' TABLESPACE fast_ssd' -- TABLESPACE fast_ssd\nWITH NO DATA;\n",
+				},
+			}
+
+			statements = removeTablespacesFromStatements(statements)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE MATERIALIZED VIEW public.mview AS SELECT E'it''s \\' TABLESPACE fast_ssd' -- TABLESPACE fast_ssd\nWITH NO DATA;\n"))
+		})
+	})
+	Describe("role statement editing", func() {
+		tableStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo", ObjectType: "TABLE",
+			Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n",
+		}
+		ownerStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo", ObjectType: "TABLE",
+			Statement: "\n\nALTER TABLE public.foo OWNER TO olduser;\n",
+		}
+		privilegesStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo", ObjectType: "TABLE",
+			Statement: "\n\nREVOKE ALL ON TABLE public.foo FROM PUBLIC;\nREVOKE ALL ON TABLE public.foo FROM olduser;\nGRANT SELECT ON TABLE public.foo TO olduser WITH GRANT OPTION;\nGRANT ALL ON TABLE public.foo TO \"Other User\";\n",
+		}
+		defaultPrivilegesStatement := toc.StatementWithType{
+			Schema: "public", ObjectType: "DEFAULT PRIVILEGES",
+			Statement: "\n\nALTER DEFAULT PRIVILEGES FOR ROLE olduser IN SCHEMA public REVOKE ALL ON TABLES FROM PUBLIC;\nALTER DEFAULT PRIVILEGES FOR ROLE olduser IN SCHEMA public GRANT SELECT ON TABLES TO olduser_reader;\n",
+		}
+		roleStatement := toc.StatementWithType{
+			Name: "olduser", ObjectType: "ROLE",
+			Statement: "\n\nCREATE ROLE olduser;\nALTER ROLE olduser WITH LOGIN;\n",
+		}
+		roleGrantStatement := toc.StatementWithType{
+			Name: "olduser_reader", ObjectType: "ROLE GRANT",
+			Statement: "\n\nGRANT olduser TO olduser_reader GRANTED BY olduser;\n",
+		}
+		It("removes owner statements", func() {
+			statements := []toc.StatementWithType{tableStatement, ownerStatement, privilegesStatement}
+			statements = removeOwnerStatements(statements)
+			Expect(statements).To(Equal([]toc.StatementWithType{tableStatement, privilegesStatement}))
+		})
+		It("removes privilege statements but not role memberships", func() {
+			statements := []toc.StatementWithType{tableStatement, ownerStatement, privilegesStatement, defaultPrivilegesStatement, roleGrantStatement}
+			statements = removePrivilegeStatements(statements)
+			Expect(statements).To(Equal([]toc.StatementWithType{tableStatement, ownerStatement, roleGrantStatement}))
+		})
+		It("does not remove privilege statements inside function bodies", func() {
+			functionStatement := toc.StatementWithType{
+				Schema: "public", Name: "grant_all", ObjectType: "FUNCTION",
+				Statement: "\n\nCREATE FUNCTION public.grant_all() RETURNS void AS $$\nBEGIN\nGRANT ALL ON TABLE public.foo TO olduser;\nEND\n$$ LANGUAGE plpgsql;\n\nREVOKE ALL ON FUNCTION public.grant_all() FROM PUBLIC;\n",
+			}
+			statements := removePrivilegeStatements([]toc.StatementWithType{functionStatement})
+			Expect(statements).To(HaveLen(1))
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE FUNCTION public.grant_all() RETURNS void AS $$\nBEGIN\nGRANT ALL ON TABLE public.foo TO olduser;\nEND\n$$ LANGUAGE plpgsql;\n\n"))
+		})
+		It("does not alter statements if no owner map was specified", func() {
+			statements := []toc.StatementWithType{ownerStatement, privilegesStatement}
+			statements = editStatementsOwnerMap(statements, nil)
+			Expect(statements).To(Equal([]toc.StatementWithType{ownerStatement, privilegesStatement}))
+		})
+		It("replaces mapped roles and skips creating them", func() {
+			statements := []toc.StatementWithType{roleStatement, tableStatement, ownerStatement, privilegesStatement, defaultPrivilegesStatement, roleGrantStatement}
+			ownerMap := &OwnerMap{Roles: map[string]string{"olduser": "tenant_owner", "olduser_reader": `"Tenant Reader"`}}
+
+			statements = editStatementsOwnerMap(statements, ownerMap)
+
+			Expect(statements).To(HaveLen(5))
+			Expect(statements[0]).To(Equal(tableStatement))
+			Expect(statements[1].Statement).To(Equal("\n\nALTER TABLE public.foo OWNER TO tenant_owner;\n"))
+			Expect(statements[2].Statement).To(Equal("\n\nREVOKE ALL ON TABLE public.foo FROM PUBLIC;\nREVOKE ALL ON TABLE public.foo FROM tenant_owner;\nGRANT SELECT ON TABLE public.foo TO tenant_owner WITH GRANT OPTION;\nGRANT ALL ON TABLE public.foo TO \"Other User\";\n"))
+			Expect(statements[3].Statement).To(Equal("\n\nALTER DEFAULT PRIVILEGES FOR ROLE tenant_owner IN SCHEMA public REVOKE ALL ON TABLES FROM PUBLIC;\nALTER DEFAULT PRIVILEGES FOR ROLE tenant_owner IN SCHEMA public GRANT SELECT ON TABLES TO \"Tenant Reader\";\n"))
+			Expect(statements[4].Statement).To(Equal("\n\nGRANT tenant_owner TO \"Tenant Reader\" GRANTED BY tenant_owner;\n"))
+		})
+		It("replaces each role only once when mappings are swapped or chained", func() {
+			statements := []toc.StatementWithType{ownerStatement, privilegesStatement, roleGrantStatement}
+			ownerMap := &OwnerMap{Roles: map[string]string{"olduser": "olduser_reader", "olduser_reader": "olduser", `"Other User"`: "olduser"}}
+
+			statements = editStatementsOwnerMap(statements, ownerMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nALTER TABLE public.foo OWNER TO olduser_reader;\n"))
+			Expect(statements[1].Statement).To(Equal("\n\nREVOKE ALL ON TABLE public.foo FROM PUBLIC;\nREVOKE ALL ON TABLE public.foo FROM olduser_reader;\nGRANT SELECT ON TABLE public.foo TO olduser_reader WITH GRANT OPTION;\nGRANT ALL ON TABLE public.foo TO olduser;\n"))
+			Expect(statements[2].Statement).To(Equal("\n\nGRANT olduser_reader TO olduser GRANTED BY olduser_reader;\n"))
+		})
+		It("does not replace roles inside function bodies", func() {
+			functionStatement := toc.StatementWithType{
+				Schema: "public", Name: "grant_all", ObjectType: "FUNCTION",
+				Statement: "\n\nCREATE FUNCTION public.grant_all() RETURNS void AS $$\nBEGIN\nGRANT ALL ON TABLE public.foo TO olduser;\nEND\n$$ LANGUAGE plpgsql;\n\nALTER FUNCTION public.grant_all() OWNER TO olduser;\n",
+			}
+			statements := editStatementsOwnerMap([]toc.StatementWithType{functionStatement}, &OwnerMap{Roles: map[string]string{"olduser": "tenant_owner"}})
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE FUNCTION public.grant_all() RETURNS void AS $$\nBEGIN\nGRANT ALL ON TABLE public.foo TO olduser;\nEND\n$$ LANGUAGE plpgsql;\n\nALTER FUNCTION public.grant_all() OWNER TO tenant_owner;\n"))
+		})
+	})
+	Describe("external table statement editing", func() {
+		externalStatement := toc.StatementWithType{
+			Schema: "public", Name: "ext", ObjectType: "TABLE",
+			Statement: "\n\nCREATE READABLE EXTERNAL TABLE public.ext (\n\ti integer\n) LOCATION (\n\t'gpfdist://etl-prod:8080/data1.csv',\n\t'gpfdist://etl-prod:8080/data2.csv'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8';",
+		}
+		s3Statement := toc.StatementWithType{
+			Schema: "public", Name: "s3_ext", ObjectType: "TABLE",
+			Statement: "\n\nCREATE READABLE EXTERNAL TABLE public.s3_ext (\n\ti integer\n) LOCATION (\n\t's3://s3.amazonaws.com/prod-bucket/data config=/home/gpadmin/s3.conf'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8';",
+		}
+		webStatement := toc.StatementWithType{
+			Schema: "public", Name: "web_ext", ObjectType: "TABLE",
+			Statement: "\n\nCREATE READABLE EXTERNAL WEB TABLE public.web_ext (\n\ti integer\n) EXECUTE 'curl http://prod-api/export' ON MASTER\nFORMAT 'TEXT'\nENCODING 'UTF8';",
+		}
+		ownerStatement := toc.StatementWithType{
+			Schema: "public", Name: "ext", ObjectType: "TABLE",
+			Statement: "\n\nALTER TABLE public.ext OWNER TO testrole;\n",
+		}
+		exchangeStatement := toc.StatementWithType{
+			Schema: "public", Name: "part_1_prt_ext", ObjectType: "EXCHANGE PARTITION",
+			Statement: "\n\nALTER TABLE public.part EXCHANGE PARTITION ext WITH TABLE public.ext WITHOUT VALIDATION;\n\nDROP TABLE public.ext;",
+		}
+		tableStatement := toc.StatementWithType{
+			Schema: "public", Name: "foo", ObjectType: "TABLE",
+			Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n",
+		}
+		It("rewrites locations using prefix and regex rules for the matching protocol", func() {
+			statements := []toc.StatementWithType{externalStatement, s3Statement, webStatement, tableStatement}
+			locationMap := &ExternalLocationMap{Rules: []ExternalLocationRule{
+				{Protocol: "gpfdist", Prefix: "gpfdist://etl-prod:8080/", Replacement: "gpfdist://etl-qa:8080/"},
+				{Protocol: "s3", Regex: `/prod-bucket/`, Replacement: "/qa-bucket/", regex: regexp.MustCompile(`/prod-bucket/`)},
+				{Protocol: "execute", Regex: `http://prod-api/(\w+)`, Replacement: "http://qa-api/$1", regex: regexp.MustCompile(`http://prod-api/(\w+)`)},
+			}}
+
+			editStatementsExternalLocationMap(statements, locationMap)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE READABLE EXTERNAL TABLE public.ext (\n\ti integer\n) LOCATION (\n\t'gpfdist://etl-qa:8080/data1.csv',\n\t'gpfdist://etl-qa:8080/data2.csv'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8';"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE READABLE EXTERNAL TABLE public.s3_ext (\n\ti integer\n) LOCATION (\n\t's3://s3.amazonaws.com/qa-bucket/data config=/home/gpadmin/s3.conf'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8';"))
+			Expect(statements[2].Statement).To(Equal("\n\nCREATE READABLE EXTERNAL WEB TABLE public.web_ext (\n\ti integer\n) EXECUTE 'curl http://qa-api/export' ON MASTER\nFORMAT 'TEXT'\nENCODING 'UTF8';"))
+			Expect(statements[3]).To(Equal(tableStatement))
+		})
+		It("does not rewrite locations for rules with a different protocol", func() {
+			statements := []toc.StatementWithType{externalStatement}
+			locationMap := &ExternalLocationMap{Rules: []ExternalLocationRule{{Protocol: "file", Prefix: "gpfdist://etl-prod:8080/", Replacement: "gpfdist://etl-qa:8080/"}}}
+
+			editStatementsExternalLocationMap(statements, locationMap)
+
+			Expect(statements).To(Equal([]toc.StatementWithType{externalStatement}))
+		})
+		It("removes external tables along with their metadata and partition exchanges", func() {
+			statements := []toc.StatementWithType{tableStatement, externalStatement, ownerStatement, webStatement, exchangeStatement}
+			statements = removeExternalTableStatements(statements)
+			Expect(statements).To(Equal([]toc.StatementWithType{tableStatement}))
+		})
+		It("converts materialized external tables to heap tables", func() {
+			writableStatement := toc.StatementWithType{
+				Schema: "public", Name: "ext_out", ObjectType: "TABLE",
+				Statement: "\n\nCREATE WRITABLE EXTERNAL TABLE public.ext_out (\n\ti integer\n) LOCATION (\n\t'gpfdist://etl-prod:8080/out.csv'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8'\nDISTRIBUTED RANDOMLY;",
+			}
+			statements := []toc.StatementWithType{externalStatement, ownerStatement, writableStatement}
+
+			convertExternalTablesToHeap(statements, map[string]bool{"public.ext": true})
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.ext (\n\ti integer\n) DISTRIBUTED RANDOMLY;"))
+			Expect(statements[1]).To(Equal(ownerStatement))
+			Expect(statements[2]).To(Equal(writableStatement))
+		})
+		It("gets the external tables with materialized data", func() {
+			dataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "foo"}, {Schema: "public", Name: "ext", IsExternal: true}}
+			Expect(getMaterializedExternalTables(dataEntries)).To(Equal(map[string]bool{"public.ext": true}))
+		})
+		It("returns an error for a rule with both a prefix and a regex", func() {
+			mapFile, _ := ioutil.TempFile("", "location_map.yaml")
+			defer os.Remove(mapFile.Name())
+			_, _ = mapFile.WriteString("rules:\n- prefix: gpfdist://etl-prod\n  regex: etl-prod\n  replacement: etl-qa\n")
+			_ = mapFile.Close()
+
+			_, err := ReadExternalLocationMap(mapFile.Name())
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("must specify exactly one of prefix or regex"))
+		})
+	})
+	Describe("table overrides", func() {
+		aoStatement := toc.StatementWithType{
+			Schema: "public", Name: "ao", ObjectType: "TABLE",
+			Statement: "\n\nCREATE TABLE public.ao (\n\ti integer,\n\tj integer\n) WITH (appendonly=true, compresstype=zlib) TABLESPACE fast_ssd DISTRIBUTED BY (i);\n\nCOMMENT ON TABLE public.ao IS 'DISTRIBUTED BY (j)';",
+		}
+		heapStatement := toc.StatementWithType{
+			Schema: "sales", Name: "orders", ObjectType: "TABLE",
+			Statement: "\n\nCREATE TABLE sales.orders (\n\tid integer\n) INHERITS (sales.base) DISTRIBUTED RANDOMLY PARTITION BY RANGE(id) \n          (\n          START (1) END (10) EVERY (5) WITH (tablename='orders_1_prt_1', appendonly=false )\n          );",
+		}
+		externalStatement := toc.StatementWithType{
+			Schema: "sales", Name: "ext", ObjectType: "TABLE",
+			Statement: "\n\nCREATE READABLE EXTERNAL TABLE sales.ext (\n\ti integer\n) LOCATION (\n\t'gpfdist://etl:8080/data.csv'\n)\nFORMAT 'TEXT'\nENCODING 'UTF8';",
+		}
+		It("does not alter statements if no overrides were specified", func() {
+			statements := []toc.StatementWithType{aoStatement}
+			applied := editStatementsTableOverrides(statements, nil)
+			Expect(statements).To(Equal([]toc.StatementWithType{aoStatement}))
+			Expect(applied).To(BeEmpty())
+		})
+		It("overrides storage and distribution using the first matching rule", func() {
+			statements := []toc.StatementWithType{aoStatement, heapStatement, externalStatement}
+			overrides := &TableOverrides{Rules: []TableOverrideRule{
+				{Table: "public.ao", Storage: "heap", Distribution: "DISTRIBUTED REPLICATED"},
+				{Pattern: `^sales\.`, Storage: "appendoptimized=true, orientation=column", pattern: regexp.MustCompile(`^sales\.`)},
+				{Pattern: `^sales\.orders$`, Distribution: "DISTRIBUTED BY (id)", pattern: regexp.MustCompile(`^sales\.orders$`)},
+			}}
+
+			applied := editStatementsTableOverrides(statements, overrides)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.ao (\n\ti integer,\n\tj integer\n) TABLESPACE fast_ssd DISTRIBUTED REPLICATED;\n\nCOMMENT ON TABLE public.ao IS 'DISTRIBUTED BY (j)';"))
+			Expect(statements[1].Statement).To(Equal("\n\nCREATE TABLE sales.orders (\n\tid integer\n) INHERITS (sales.base) WITH (appendoptimized=true, orientation=column) DISTRIBUTED RANDOMLY PARTITION BY RANGE(id) \n          (\n          START (1) END (10) EVERY (5) WITH (tablename='orders_1_prt_1', appendonly=false )\n          );"))
+			Expect(statements[2]).To(Equal(externalStatement))
+			Expect(applied).To(Equal(map[string]string{
+				"public.ao":    "storage heap, DISTRIBUTED REPLICATED",
+				"sales.orders": "storage appendoptimized=true, orientation=column",
+			}))
+		})
+		It("removes column encodings when overriding the storage to heap", func() {
+			statements := []toc.StatementWithType{{
+				Schema: "public", Name: "aoco", ObjectType: "TABLE",
+				Statement: "\n\nCREATE TABLE public.aoco (\n\ti integer ENCODING (compresstype=zlib, compresslevel=1),\n\tj text DEFAULT ' ENCODING (x)' ENCODING (compresstype=rle_type)\n) WITH (appendonly=true, orientation=column) DISTRIBUTED BY (i);",
+			}}
+			overrides := &TableOverrides{Rules: []TableOverrideRule{{Table: "public.aoco", Storage: "heap"}}}
+
+			editStatementsTableOverrides(statements, overrides)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.aoco (\n\ti integer,\n\tj text DEFAULT ' ENCODING (x)'\n) DISTRIBUTED BY (i);"))
+		})
+		It("overrides only the distribution policy, keeping the existing storage options", func() {
+			statements := []toc.StatementWithType{aoStatement}
+			overrides := &TableOverrides{Rules: []TableOverrideRule{{Table: "public.ao", Distribution: "DISTRIBUTED BY (j, i)"}}}
+
+			editStatementsTableOverrides(statements, overrides)
+
+			Expect(statements[0].Statement).To(Equal("\n\nCREATE TABLE public.ao (\n\ti integer,\n\tj integer\n) WITH (appendonly=true, compresstype=zlib) TABLESPACE fast_ssd DISTRIBUTED BY (j, i);\n\nCOMMENT ON TABLE public.ao IS 'DISTRIBUTED BY (j)';"))
+		})
+		It("returns an error for an invalid distribution", func() {
+			overridesFile, _ := ioutil.TempFile("", "table_overrides.yaml")
+			defer os.Remove(overridesFile.Name())
+			_, _ = overridesFile.WriteString("rules:\n- table: public.foo\n  distribution: BY (i)\n")
+			_ = overridesFile.Close()
+
+			_, err := ReadTableOverrides(overridesFile.Name())
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid distribution BY (i)"))
+		})
+		It("reads rules and compiles their patterns", func() {
+			overridesFile, _ := ioutil.TempFile("", "table_overrides.yaml")
+			defer os.Remove(overridesFile.Name())
+			_, _ = overridesFile.WriteString("rules:\n- pattern: ^sales\\.\n  storage: heap\n")
+			_ = overridesFile.Close()
+
+			overrides, err := ReadTableOverrides(overridesFile.Name())
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(overrides.Rules).To(HaveLen(1))
+			Expect(overrides.getRule("sales.orders")).To(Equal(&overrides.Rules[0]))
+			Expect(overrides.getRule("public.sales")).To(BeNil())
+		})
+	})
+	Describe("includeDependencies", func() {
+		var originalOpts *options.Options
+		var originalTOC *toc.TOC
+		metadata := "CREATE FUNCTION public.f() ...;CREATE TABLE public.t1 ...;CREATE VIEW public.v1 ...;CREATE TABLE public.t2 ...;ALTER SEQUENCE public.s1 OWNED BY public.t1.i;"
+		BeforeEach(func() {
+			originalOpts = opts
+			originalTOC = globalTOC
+			globalTOC = &toc.TOC{}
+			globalTOC.InitializeMetadataEntryMap()
+			globalTOC.HasDependencies = true
+			globalTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "f", ObjectType: "FUNCTION"}, 0, 31)
+			globalTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "t1", ObjectType: "TABLE",
+				Dependencies: []toc.ObjectKey{{Schema: "public", Name: "f", ObjectType: "FUNCTION"}}}, 31, 58)
+			globalTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "v1", ObjectType: "VIEW",
+				Dependencies: []toc.ObjectKey{{Schema: "public", Name: "t1", ObjectType: "TABLE"}}}, 58, 84)
+			globalTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "t2", ObjectType: "TABLE"}, 84, 111)
+			globalTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "s1", ObjectType: "SEQUENCE OWNER", ReferenceObject: "public.t1"}, 111, 157)
+		})
+		AfterEach(func() {
+			opts = originalOpts
+			globalTOC = originalTOC
+		})
+		It("includes the objects on which the included relations depend", func() {
+			opts = &options.Options{IncludedRelations: []string{"public.v1"}}
+
+			includeDependencies(false)
+
+			Expect(opts.IncludedRelations).To(Equal([]string{"public.v1", "public.t1", "public.s1"}))
+			statements := globalTOC.GetSQLStatementForObjectTypes("predata", strings.NewReader(metadata), []string{}, []string{}, []string{}, []string{}, opts.IncludedRelations, []string{})
+			Expect(statements).To(HaveLen(4))
+			Expect(statements[0].Name).To(Equal("f"))
+		})
+		It("includes the relations that depend on the included relations with includeDependents", func() {
+			opts = &options.Options{IncludedRelations: []string{"public.t1"}}
+
+			includeDependencies(true)
+
+			Expect(opts.IncludedRelations).To(ConsistOf("public.t1", "public.v1", "public.s1"))
+		})
+		It("does not include unrelated relations", func() {
+			opts = &options.Options{IncludedRelations: []string{"public.t2"}}
+
+			includeDependencies(true)
+
+			Expect(opts.IncludedRelations).To(Equal([]string{"public.t2"}))
+		})
+	})
+	Describe("truncateTablesBeforeDataRestore", func() {
+		var originalOpts *options.Options
+		var originalConnectionPool *dbconn.DBConn
+		var mock sqlmock.Sqlmock
+		BeforeEach(func() {
+			originalOpts = opts
+			originalConnectionPool = connectionPool
+			connectionPool, mock = testhelper.CreateAndConnectMockDB(1)
+			opts = &options.Options{}
+		})
+		AfterEach(func() {
+			opts = originalOpts
+			connectionPool = originalConnectionPool
+		})
+		It("truncates the tables to be restored in a single statement", func() {
+			mock.ExpectExec(regexp.QuoteMeta("TRUNCATE public.foo,public.bar;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			truncateTablesBeforeDataRestore(map[string][]toc.MasterDataEntry{
+				"20170101010101": {{Schema: "public", Name: "foo"}, {Schema: "public", Name: "bar"}},
+				"20170102010101": {},
+			})
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("truncates the tables in the redirect schema", func() {
+			opts.RedirectSchema = "other"
+			mock.ExpectExec(regexp.QuoteMeta("TRUNCATE other.foo;")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			truncateTablesBeforeDataRestore(map[string][]toc.MasterDataEntry{"20170101010101": {{Schema: "public", Name: "foo"}}})
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("does nothing when there are no tables to restore", func() {
+			truncateTablesBeforeDataRestore(map[string][]toc.MasterDataEntry{"20170101010101": {}})
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("getNumHelperJobs", func() {
+		var originalConnectionPool *dbconn.DBConn
+		var originalBackupConfig *history.BackupConfig
+		var originalPluginConfig *utils.PluginConfig
+		BeforeEach(func() {
+			originalConnectionPool = connectionPool
+			originalBackupConfig = backupConfig
+			originalPluginConfig = pluginConfig
+			connectionPool, _ = testhelper.CreateAndConnectMockDB(3)
+			backupConfig = &history.BackupConfig{SingleDataFile: true, FramedDataFiles: true}
+			pluginConfig = nil
+		})
+		AfterEach(func() {
+			connectionPool = originalConnectionPool
+			backupConfig = originalBackupConfig
+			pluginConfig = originalPluginConfig
+		})
+		It("uses a job per connection for framed data files", func() {
+			Expect(getNumHelperJobs()).To(Equal(3))
+		})
+		It("uses a single job for data files that are not framed", func() {
+			backupConfig.FramedDataFiles = false
+
+			Expect(getNumHelperJobs()).To(Equal(1))
+		})
+		It("uses a job per connection with a storage backend", func() {
+			pluginConfig = &utils.PluginConfig{Backend: "s3"}
+
+			Expect(getNumHelperJobs()).To(Equal(3))
+		})
+		It("uses a single job with a plugin that does not support restore_data_range", func() {
+			pluginFile, err := ioutil.TempFile("", "fake-plugin")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(pluginFile.Name())
+			_, _ = pluginFile.WriteString("#!/bin/bash\necho 0.4.0\n")
+			_ = pluginFile.Close()
+			Expect(os.Chmod(pluginFile.Name(), 0755)).To(Succeed())
+			pluginConfig = &utils.PluginConfig{ExecutablePath: pluginFile.Name()}
+
+			Expect(getNumHelperJobs()).To(Equal(1))
+		})
+	})
 })
@@ -0,0 +1,146 @@
+package restore
+
+/*
+ * This file contains structs and functions related to rewriting the roles
+ * referenced by restored objects, via --owner-map, --no-owner, and
+ * --no-privileges.
+ */
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * The keys and values of Roles are role names as they appear in SQL, quoted if
+ * necessary.
+ */
+type OwnerMap struct {
+	Roles map[string]string `yaml:"roles"`
+}
+
+const roleKeywordPattern = `\b(?:OWNER TO|TO|FROM|FOR ROLE|FOR|GRANTED BY) `
+
+var (
+	ownerLineRegex   = regexp.MustCompile(`^ALTER .+ OWNER TO ` + identifierPattern + `;$`)
+	roleLineRegex    = regexp.MustCompile(`^(?:GRANT |REVOKE |ALTER DEFAULT PRIVILEGES |CREATE USER MAPPING FOR )`)
+	roleRegex        = regexp.MustCompile(`(` + roleKeywordPattern + `)(` + identifierPattern + `)`)
+	grantedRoleRegex = regexp.MustCompile(`(^GRANT |` + roleKeywordPattern + `)(` + identifierPattern + `)`)
+)
+
+func ReadOwnerMap(filename string) (*OwnerMap, error) {
+	ownerMap := &OwnerMap{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(contents, ownerMap)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse owner map file %s", filename)
+	}
+	for oldRole, newRole := range ownerMap.Roles {
+		if newRole == "" {
+			return nil, errors.Errorf("No role given for %s in owner map file %s", oldRole, filename)
+		}
+	}
+	return ownerMap, nil
+}
+
+/*
+ * Applies shouldRemove to each line of each statement, dropping any statements
+ * that are left empty.  shouldRemove is passed each line with its literals and
+ * comments masked, so lines inside e.g. a function body never look like
+ * top-level statements.
+ */
+func removeStatementLines(statements []toc.StatementWithType, shouldRemove func(objectType string, line string) bool) []toc.StatementWithType {
+	newStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		lines := strings.Split(statement.Statement, "\n")
+		maskedLines := strings.Split(maskLiteralsAndComments(statement.Statement), "\n")
+		keptLines := make([]string, 0, len(lines))
+		for i, line := range lines {
+			if !shouldRemove(statement.ObjectType, maskedLines[i]) {
+				keptLines = append(keptLines, line)
+			}
+		}
+		statement.Statement = strings.Join(keptLines, "\n")
+		if strings.TrimSpace(statement.Statement) != "" {
+			newStatements = append(newStatements, statement)
+		}
+	}
+	return newStatements
+}
+
+func removeOwnerStatements(statements []toc.StatementWithType) []toc.StatementWithType {
+	return removeStatementLines(statements, func(objectType string, line string) bool {
+		return ownerLineRegex.MatchString(line)
+	})
+}
+
+/*
+ * Role memberships are not object privileges, so GRANT statements for ROLE
+ * GRANT objects are kept.
+ */
+func removePrivilegeStatements(statements []toc.StatementWithType) []toc.StatementWithType {
+	return removeStatementLines(statements, func(objectType string, line string) bool {
+		if objectType == "ROLE GRANT" {
+			return false
+		}
+		return objectType == "DEFAULT PRIVILEGES" || strings.HasPrefix(line, "GRANT ") || strings.HasPrefix(line, "REVOKE ")
+	})
+}
+
+/*
+ * Replaces mapped roles in owner, privilege, and user mapping statements.
+ * Each role name is looked up in the map exactly once, so swapped or chained
+ * mappings replace each role only according to its own mapping.  Mapped roles
+ * are expected to already exist in the restore cluster, so the statements
+ * creating the original roles are not restored.
+ */
+func editStatementsOwnerMap(statements []toc.StatementWithType, ownerMap *OwnerMap) []toc.StatementWithType {
+	if ownerMap == nil {
+		return statements
+	}
+	newStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if _, ok := ownerMap.Roles[statement.Name]; ok && (statement.ObjectType == "ROLE" || statement.ObjectType == "ROLE GUCS") {
+			continue
+		}
+		pattern := roleRegex
+		if statement.ObjectType == "ROLE GRANT" {
+			pattern = grantedRoleRegex
+		}
+		lines := strings.Split(statement.Statement, "\n")
+		maskedLines := strings.Split(maskLiteralsAndComments(statement.Statement), "\n")
+		for i, line := range lines {
+			if !ownerLineRegex.MatchString(maskedLines[i]) && !roleLineRegex.MatchString(maskedLines[i]) {
+				continue
+			}
+			lines[i] = replaceOutsideLiterals(line, pattern, func(match []string) string {
+				if newRole, ok := ownerMap.Roles[match[2]]; ok {
+					return match[1] + newRole
+				}
+				return match[0]
+			})
+		}
+		statement.Statement = strings.Join(lines, "\n")
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+func editStatementsRoles(statements []toc.StatementWithType) []toc.StatementWithType {
+	if MustGetFlagBool(options.NO_OWNER) {
+		statements = removeOwnerStatements(statements)
+	}
+	if MustGetFlagBool(options.NO_PRIVILEGES) {
+		statements = removePrivilegeStatements(statements)
+	}
+	return editStatementsOwnerMap(statements, ownerMap)
+}
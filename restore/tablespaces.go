@@ -0,0 +1,285 @@
+package restore
+
+/*
+ * This file contains structs and functions related to rewriting the tablespaces
+ * used by restored objects, via --tablespace-map and --no-tablespaces.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * The keys of Tablespaces are tablespace names as they appear in the backup,
+ * quoted if necessary.  Location, SegmentLocations, and Filespace only affect
+ * CREATE TABLESPACE statements, so they are only used with --with-globals.
+ */
+type TablespaceMap struct {
+	Tablespaces map[string]TablespaceMapping `yaml:"tablespaces"`
+}
+
+type TablespaceMapping struct {
+	Name             string         `yaml:"name"`
+	Location         string         `yaml:"location"`
+	SegmentLocations map[int]string `yaml:"segment_locations"`
+	Filespace        string         `yaml:"filespace"`
+}
+
+const identifierPattern = `(?:"(?:[^"]|"")+"|[A-Za-z_][A-Za-z0-9_$]*)`
+
+var (
+	tablespaceObjectTypes = map[string]bool{"TABLE": true, "MATERIALIZED VIEW": true, "INDEX": true, "DATABASE": true, "TABLESPACE": true}
+	setTablespaceRegex    = regexp.MustCompile(`\n?ALTER (?:INDEX|TABLE) [^\n]+? SET TABLESPACE ` + identifierPattern + `;`)
+	tablespaceClauseRegex = regexp.MustCompile(`\s?\bTABLESPACE ` + identifierPattern)
+	tablespaceNameRegex   = regexp.MustCompile(`\bTABLESPACE (` + identifierPattern + `)`)
+	createTablespaceRegex = regexp.MustCompile(`^\s*CREATE TABLESPACE `)
+	filespaceRegex        = regexp.MustCompile(` FILESPACE ` + identifierPattern + `;`)
+	locationRegex         = regexp.MustCompile(`LOCATION ('(?:[^']|'')*')(?:\n\tWITH \([^)]*\))?`)
+	dollarQuoteTagRegex   = regexp.MustCompile(`^\$(?:[A-Za-z_][A-Za-z0-9_]*)?\$`)
+)
+
+func ReadTablespaceMap(filename string) (*TablespaceMap, error) {
+	tablespaceMap := &TablespaceMap{}
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(contents, tablespaceMap)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse tablespace map file %s", filename)
+	}
+	for tablespace, mapping := range tablespaceMap.Tablespaces {
+		if mapping.Location != "" {
+			err = utils.ValidateFullPath(mapping.Location)
+			if err != nil {
+				return nil, err
+			}
+		}
+		for content, location := range mapping.SegmentLocations {
+			err = utils.ValidateFullPath(location)
+			if err != nil {
+				return nil, err
+			}
+			if content < 0 {
+				return nil, errors.Errorf("Invalid segment content ID %d for tablespace %s in tablespace map file", content, tablespace)
+			}
+		}
+	}
+	return tablespaceMap, nil
+}
+
+/*
+ * Replaces the name of each mapped tablespace in the TABLESPACE clauses of the
+ * given statements, and the locations of mapped tablespaces in their CREATE
+ * TABLESPACE statements.  Each name is looked up in the map exactly once, so
+ * swapped or chained mappings (a to b and b to c) rename each tablespace only
+ * according to its own mapping.
+ */
+func editStatementsTablespaceMap(statements []toc.StatementWithType, tablespaceMap *TablespaceMap) {
+	if tablespaceMap == nil {
+		return
+	}
+	for i, statement := range statements {
+		if !tablespaceObjectTypes[statement.ObjectType] {
+			continue
+		}
+		statements[i].Statement = replaceOutsideLiterals(statement.Statement, tablespaceNameRegex, func(match []string) string {
+			if mapping, ok := tablespaceMap.Tablespaces[match[1]]; ok && mapping.Name != "" {
+				return "TABLESPACE " + mapping.Name
+			}
+			return match[0]
+		})
+		if statement.ObjectType != "TABLESPACE" {
+			continue
+		}
+		mapping, ok := tablespaceMap.Tablespaces[statement.Name]
+		if !ok {
+			continue
+		}
+		if mapping.Name != "" {
+			statements[i].Name = mapping.Name
+		}
+		if !createTablespaceRegex.MatchString(statement.Statement) {
+			continue
+		}
+		if mapping.Location != "" || len(mapping.SegmentLocations) > 0 {
+			statements[i].Statement = locationRegex.ReplaceAllStringFunc(statements[i].Statement, mapping.locationClause)
+		}
+		if mapping.Filespace != "" {
+			statements[i].Statement = filespaceRegex.ReplaceAllLiteralString(statements[i].Statement, fmt.Sprintf(" FILESPACE %s;", mapping.Filespace))
+		}
+	}
+}
+
+/*
+ * Constructs the LOCATION clause for a mapped tablespace.  Per-segment
+ * locations from the backup are always dropped, as they would otherwise still
+ * refer to the source cluster's storage.
+ */
+func (mapping TablespaceMapping) locationClause(oldClause string) string {
+	location := locationRegex.FindStringSubmatch(oldClause)[1]
+	if mapping.Location != "" {
+		location = fmt.Sprintf("'%s'", utils.EscapeSingleQuotes(mapping.Location))
+	}
+	clause := fmt.Sprintf("LOCATION %s", location)
+	if len(mapping.SegmentLocations) > 0 {
+		contents := make([]int, 0, len(mapping.SegmentLocations))
+		for content := range mapping.SegmentLocations {
+			contents = append(contents, content)
+		}
+		sort.Ints(contents)
+		segmentLocations := make([]string, 0, len(contents))
+		for _, content := range contents {
+			segmentLocations = append(segmentLocations, fmt.Sprintf("content%d='%s'", content, utils.EscapeSingleQuotes(mapping.SegmentLocations[content])))
+		}
+		clause += fmt.Sprintf("\n\tWITH (%s)", strings.Join(segmentLocations, ", "))
+	}
+	return clause
+}
+
+/*
+ * Removes TABLESPACE clauses and ALTER ... SET TABLESPACE statements so that
+ * all objects are restored into the default tablespace.  TABLESPACE objects
+ * themselves are not restored at all.
+ */
+func removeTablespacesFromStatements(statements []toc.StatementWithType) []toc.StatementWithType {
+	newStatements := make([]toc.StatementWithType, 0, len(statements))
+	for _, statement := range statements {
+		if statement.ObjectType == "TABLESPACE" {
+			continue
+		}
+		if tablespaceObjectTypes[statement.ObjectType] {
+			statement.Statement = replaceOutsideLiterals(statement.Statement, setTablespaceRegex, removeMatch)
+			statement.Statement = replaceOutsideLiterals(statement.Statement, tablespaceClauseRegex, removeMatch)
+		}
+		newStatements = append(newStatements, statement)
+	}
+	return newStatements
+}
+
+func removeMatch(match []string) string {
+	return ""
+}
+
+/*
+ * Replaces each match of pattern in statement with the result of replace,
+ * which is passed the match and its submatches as in FindStringSubmatch.
+ * Matches that begin inside a string literal, a quoted identifier, or a
+ * comment are ignored, so that e.g. a view definition selecting the string
+ * 'TABLESPACE foo' is not altered.
+ */
+func replaceOutsideLiterals(statement string, pattern *regexp.Regexp, replace func(match []string) string) string {
+	masked := maskLiteralsAndComments(statement)
+	var result strings.Builder
+	end := 0
+	for _, indices := range pattern.FindAllStringSubmatchIndex(masked, -1) {
+		match := make([]string, len(indices)/2)
+		for i := range match {
+			if indices[2*i] >= 0 {
+				match[i] = statement[indices[2*i]:indices[2*i+1]]
+			}
+		}
+		result.WriteString(statement[end:indices[0]])
+		result.WriteString(replace(match))
+		end = indices[1]
+	}
+	result.WriteString(statement[end:])
+	return result.String()
+}
+
+/*
+ * Returns a copy of statement in which the contents of string literals,
+ * dollar-quoted strings, quoted identifiers, and comments are blanked out.
+ * The delimiters are kept and the copy has the same length as statement, so
+ * match indices in the copy are valid in the original and a quoted identifier
+ * still matches identifierPattern.
+ */
+func maskLiteralsAndComments(statement string) string {
+	masked := []byte(statement)
+	blank := func(start int, end int) {
+		for i := start; i < end; i++ {
+			if masked[i] != '\n' {
+				masked[i] = '_'
+			}
+		}
+	}
+	isIdentifierChar := func(i int) bool {
+		c := statement[i]
+		return c == '_' || c == '$' || (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || c >= 0x80
+	}
+	for i := 0; i < len(statement); {
+		switch {
+		case strings.HasPrefix(statement[i:], "--"):
+			end := strings.IndexByte(statement[i:], '\n')
+			if end < 0 {
+				end = len(statement) - i
+			}
+			blank(i+2, i+end)
+			i += end
+		case strings.HasPrefix(statement[i:], "/*"):
+			end := strings.Index(statement[i+2:], "*/")
+			if end < 0 {
+				blank(i+2, len(statement))
+				i = len(statement)
+				continue
+			}
+			blank(i+2, i+2+end)
+			i += end + 4
+		case statement[i] == '\'' || statement[i] == '"':
+			quote := statement[i]
+			backslashEscapes := quote == '\'' && i > 0 && (statement[i-1] == 'E' || statement[i-1] == 'e') && (i < 2 || !isIdentifierChar(i-2))
+			end := i + 1
+			for end < len(statement) {
+				if backslashEscapes && statement[end] == '\\' {
+					end += 2
+				} else if statement[end] == quote && end+1 < len(statement) && statement[end+1] == quote {
+					end += 2
+				} else if statement[end] == quote {
+					break
+				} else {
+					end++
+				}
+			}
+			if end > len(statement) {
+				end = len(statement)
+			}
+			blank(i+1, end)
+			i = end + 1
+		case statement[i] == '$' && (i == 0 || !isIdentifierChar(i-1)):
+			tag := dollarQuoteTagRegex.FindString(statement[i:])
+			if tag == "" {
+				i++
+				continue
+			}
+			end := strings.Index(statement[i+len(tag):], tag)
+			if end < 0 {
+				blank(i+len(tag), len(statement))
+				i = len(statement)
+				continue
+			}
+			blank(i+len(tag), i+len(tag)+end)
+			i += len(tag) + end + len(tag)
+		default:
+			i++
+		}
+	}
+	return string(masked)
+}
+
+func editStatementsTablespaces(statements []toc.StatementWithType) []toc.StatementWithType {
+	if MustGetFlagBool(options.NO_TABLESPACES) {
+		return removeTablespacesFromStatements(statements)
+	}
+	editStatementsTablespaceMap(statements, tablespaceMap)
+	return statements
+}
@@ -124,13 +124,17 @@ WHERE quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)`, quotedTa
 	 * are not already in the database so we don't get duplicate data.
 	 */
 	var errMsg string
-	if backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY) {
+	if backupConfig.DataOnly || !sectionRequested(SECTION_PREDATA) {
+		restoreType := "data-only restore"
+		if len(getSections()) > 0 {
+			restoreType = "restore without the predata section"
+		}
 		if len(relationsInDB) < len(relationList) {
 			dbRelationsSet := utils.NewSet(relationsInDB)
 			for _, restoreRelation := range relationList {
 				matches := dbRelationsSet.MatchesFilter(restoreRelation)
 				if !matches {
-					errMsg = fmt.Sprintf("Relation %s must exist for data-only restore", restoreRelation)
+					errMsg = fmt.Sprintf("Relation %s must exist for %s", restoreRelation, restoreType)
 				}
 			}
 		}
@@ -226,9 +230,6 @@ END AS string;`, utils.EscapeSingleQuotes(unquotedDBName))
 }
 
 func ValidateBackupFlagCombinations() {
-	if backupConfig.SingleDataFile && MustGetFlagInt(options.JOBS) != 1 {
-		gplog.Fatal(errors.Errorf("Cannot use jobs flag when restoring backups with a single data file per segment."), "")
-	}
 	if (backupConfig.IncludeTableFiltered || backupConfig.DataOnly) && MustGetFlagBool(options.WITH_GLOBALS) {
 		gplog.Fatal(errors.Errorf("Global metadata is not backed up in table-filtered or data-only backups."), "")
 	}
@@ -238,9 +239,42 @@ func ValidateBackupFlagCombinations() {
 	if backupConfig.DataOnly && MustGetFlagBool(options.METADATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use metadata-only flag when restoring data-only backup"), "")
 	}
+	validateBackupSectionCombinations(getSections())
 	validateBackupFlagPluginCombinations()
 }
 
+func ValidateSections(sections []string) error {
+	for _, section := range sections {
+		switch section {
+		case SECTION_PREDATA, SECTION_DATA, SECTION_POSTDATA, SECTION_STATISTICS:
+		default:
+			return errors.Errorf("Invalid section %s; valid sections are %s, %s, %s, and %s", section, SECTION_PREDATA, SECTION_DATA, SECTION_POSTDATA, SECTION_STATISTICS)
+		}
+	}
+	if len(sections) > 0 && !utils.Exists(sections, SECTION_PREDATA) {
+		if MustGetFlagBool(options.CREATE_DB) {
+			return errors.Errorf("Cannot use --%s without the %s section", options.CREATE_DB, SECTION_PREDATA)
+		}
+		if MustGetFlagBool(options.WITH_GLOBALS) {
+			return errors.Errorf("Cannot use --%s without the %s section", options.WITH_GLOBALS, SECTION_PREDATA)
+		}
+	}
+	return nil
+}
+
+func validateBackupSectionCombinations(sections []string) {
+	for _, section := range sections {
+		switch {
+		case backupConfig.DataOnly && (section == SECTION_PREDATA || section == SECTION_POSTDATA):
+			gplog.Fatal(errors.Errorf("Cannot restore the %s section of a data-only backup", section), "")
+		case backupConfig.MetadataOnly && section == SECTION_DATA:
+			gplog.Fatal(errors.Errorf("Cannot restore the %s section of a metadata-only backup", section), "")
+		case !backupConfig.WithStatistics && section == SECTION_STATISTICS:
+			gplog.Fatal(errors.Errorf("Cannot restore the %s section of a backup taken without statistics", section), "")
+		}
+	}
+}
+
 func validateBackupFlagPluginCombinations() {
 	if backupConfig.Plugin != "" && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
 		gplog.Fatal(errors.Errorf("Backup was taken with plugin %s. The --plugin-config flag must be used to restore.", backupConfig.Plugin), "")
@@ -257,9 +291,35 @@ func ValidateFlagCombinations(flags *pflag.FlagSet) {
 		options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE,
 		options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
 	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.DATA_ONLY)
+	options.CheckExclusiveFlags(flags, options.SECTION, options.DATA_ONLY, options.METADATA_ONLY, options.WITH_STATS)
+	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.REJECT_LIMIT)
 	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.TABLESPACE_MAP, options.NO_TABLESPACES)
+	options.CheckExclusiveFlags(flags, options.OWNER_MAP, options.NO_OWNER)
+	options.CheckExclusiveFlags(flags, options.EXTERNAL_LOCATION_MAP, options.NO_EXTERNAL_TABLES)
+	options.CheckExclusiveFlags(flags, options.EXTERNAL_AS_HEAP, options.NO_EXTERNAL_TABLES)
 	options.CheckExclusiveFlags(flags, options.REDIRECT_SCHEMA, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE)
+	options.CheckExclusiveFlags(flags, options.RETRY_ERRORS_FROM, options.REDIRECT_SCHEMA,
+		options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.EXCLUDE_RELATION_FILE,
+		options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
+	options.CheckExclusiveFlags(flags, options.RETRY_ERRORS_FROM, options.INCREMENTAL)
+	options.CheckExclusiveFlags(flags, options.RETRY_ERRORS_FROM, options.CREATE_DB)
+	options.CheckExclusiveFlags(flags, options.RETRY_ERRORS_FROM, options.WITH_GLOBALS)
 	if flags.Changed(options.REDIRECT_SCHEMA) && !(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) {
 		gplog.Fatal(errors.Errorf("Cannot use --redirect-schema without --include-table or --include-table-file"), "")
 	}
+	options.CheckExclusiveFlags(flags, options.INCLUDE_DEPENDENCIES, options.REDIRECT_SCHEMA)
+	if flags.Changed(options.INCLUDE_DEPENDENCIES) && !(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) {
+		gplog.Fatal(errors.Errorf("Cannot use --include-dependencies without --include-table or --include-table-file"), "")
+	}
+	if flags.Changed(options.INCLUDE_DEPENDENTS) && !flags.Changed(options.INCLUDE_DEPENDENCIES) {
+		gplog.Fatal(errors.Errorf("Cannot use --include-dependents without --include-dependencies"), "")
+	}
+	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.INCREMENTAL)
+	if flags.Changed(options.TRUNCATE_TABLE) && !(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) {
+		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table or --include-table-file"), "")
+	}
+	if flags.Changed(options.TRUNCATE_TABLE) && !flags.Changed(options.DATA_ONLY) {
+		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --data-only"), "")
+	}
 }
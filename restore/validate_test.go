@@ -32,10 +32,10 @@ var _ = Describe("restore/validate tests", func() {
 			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "predata")
 			backupfile.ByteCount = table1Len
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "table1", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", false)
 			backupfile.ByteCount += table2Len
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}, table1Len, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "", false)
 			backupfile.ByteCount += sequenceLen
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "somesequence", ObjectType: "SEQUENCE"}, table1Len+table2Len, backupfile.ByteCount)
 			restore.SetTOC(tocfile)
@@ -74,10 +74,10 @@ var _ = Describe("restore/validate tests", func() {
 		var opts *options.Options
 		BeforeEach(func() {
 			tocfile, _ = testutils.InitializeTestTOC(buffer, "metadata")
-			tocfile.AddMasterDataEntry("s1", "table1", 1, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s1", "table2", 2, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s2", "table1", 3, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s2", "table2", 4, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("s1", "table1", 1, "(j)", 0, "", false)
+			tocfile.AddMasterDataEntry("s1", "table2", 2, "(j)", 0, "", false)
+			tocfile.AddMasterDataEntry("s2", "table1", 3, "(j)", 0, "", false)
+			tocfile.AddMasterDataEntry("s2", "table2", 4, "(j)", 0, "", false)
 			restore.SetTOC(tocfile)
 
 			opts = &options.Options{}
@@ -164,6 +164,19 @@ var _ = Describe("restore/validate tests", func() {
 				restore.ValidateRelationsInRestoreDatabase(connectionPool, filterList)
 			})
 		})
+		Context("restore without the predata section", func() {
+			BeforeEach(func() {
+				_ = cmdFlags.Set(options.SECTION, "postdata")
+			})
+			It("panics if tables are missing from database", func() {
+				singleTableRow := sqlmock.NewRows([]string{"string"}).
+					AddRow("public.table1")
+				mock.ExpectQuery("SELECT (.*)").WillReturnRows(singleTableRow)
+				filterList = []string{"public.table1", "public.table2"}
+				defer testhelper.ShouldPanicWithMessage("Relation public.table2 must exist for restore without the predata section")
+				restore.ValidateRelationsInRestoreDatabase(connectionPool, filterList)
+			})
+		})
 		Context("restore includes metadata", func() {
 			It("passes if table is not present in database", func() {
 				noTableRows := sqlmock.NewRows([]string{"string"})
@@ -195,10 +208,10 @@ var _ = Describe("restore/validate tests", func() {
 		BeforeEach(func() {
 			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "predata")
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "table1", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", false)
 
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "", false)
 
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "somesequence", ObjectType: "SEQUENCE"}, 0, backupfile.ByteCount)
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "someview", ObjectType: "VIEW"}, 0, backupfile.ByteCount)
@@ -262,6 +275,22 @@ var _ = Describe("restore/validate tests", func() {
 			restore.ValidateIncludeRelationsInBackupSet(filterList)
 		})
 	})
+	Describe("ValidateSections", func() {
+		It("accepts any combination of sections", func() {
+			Expect(restore.ValidateSections([]string{"data", "postdata", "statistics"})).To(Succeed())
+		})
+		It("returns an error for an invalid section", func() {
+			err := restore.ValidateSections([]string{"data", "indexes"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Invalid section indexes; valid sections are predata, data, postdata, and statistics"))
+		})
+		It("returns an error when creating the database without the predata section", func() {
+			_ = cmdFlags.Set(options.CREATE_DB, "true")
+			err := restore.ValidateSections([]string{"data"})
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Cannot use --create-db without the predata section"))
+		})
+	})
 	Describe("ValidateDatabaseExistence", func() {
 		It("panics if createdb passed when db exists", func() {
 			dbExists := sqlmock.NewRows([]string{"string"}).
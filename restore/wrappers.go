@@ -15,6 +15,7 @@ import (
 	"github.com/greenplum-db/gpbackup/report"
 	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 )
 
 /*
@@ -51,6 +52,56 @@ func filtersEmpty(filters Filters) bool {
 	return len(filters.includeSchemas) == 0 && len(filters.excludeSchemas) == 0 && len(filters.includeRelations) == 0 && len(filters.excludeRelations) == 0
 }
 
+func isRelationType(objectType string) bool {
+	return objectType == "TABLE" || objectType == "VIEW" || objectType == "MATERIALIZED VIEW" || objectType == "SEQUENCE"
+}
+
+/*
+ * Adds the objects on which the included relations depend, along with the
+ * objects that depend on them if includeDependents is true, to the objects to
+ * be restored.  Relations are added to the included relations so that their
+ * data is restored as well, while all other objects are included via the TOC.
+ * Sequences owned by included tables are also included.
+ */
+func includeDependencies(includeDependents bool) {
+	includedRelations := make(map[string]bool)
+	for _, fqn := range opts.IncludedRelations {
+		includedRelations[fqn] = true
+	}
+	roots := make([]toc.ObjectKey, 0)
+	for _, entry := range globalTOC.PredataEntries {
+		if isRelationType(entry.ObjectType) && entry.ReferenceObject == "" && includedRelations[utils.MakeFQN(entry.Schema, entry.Name)] {
+			roots = append(roots, entry.Key())
+		}
+	}
+	if !globalTOC.HasDependencies {
+		gplog.Warn("Backup %s does not contain dependency information; only the schemas of the included relations and the sequences they own will be added to the restore", globalFPInfo.Timestamp)
+	}
+
+	includedObjects := make(map[toc.ObjectKey]bool)
+	for object := range globalTOC.GetDependencyClosure(roots, includeDependents) {
+		if !isRelationType(object.ObjectType) {
+			includedObjects[object] = true
+			continue
+		}
+		fqn := utils.MakeFQN(object.Schema, object.Name)
+		if !includedRelations[fqn] {
+			gplog.Verbose("Including %s %s as a dependency of the included relations", strings.ToLower(object.ObjectType), fqn)
+			opts.IncludedRelations = append(opts.IncludedRelations, fqn)
+			includedRelations[fqn] = true
+		}
+	}
+	for _, entry := range globalTOC.PredataEntries {
+		fqn := utils.MakeFQN(entry.Schema, entry.Name)
+		if entry.ObjectType == "SEQUENCE OWNER" && includedRelations[entry.ReferenceObject] && !includedRelations[fqn] {
+			gplog.Verbose("Including sequence %s owned by included table %s", fqn, entry.ReferenceObject)
+			opts.IncludedRelations = append(opts.IncludedRelations, fqn)
+			includedRelations[fqn] = true
+		}
+	}
+	globalTOC.SetIncludedObjects(includedObjects)
+}
+
 func SetLoggerVerbosity() {
 	if MustGetFlagBool(options.QUIET) {
 		gplog.SetVerbosity(gplog.LOGERROR)
@@ -61,6 +112,14 @@ func SetLoggerVerbosity() {
 	}
 }
 
+func runHooks(hookPoint string) {
+	dbName := MustGetFlagString(options.REDIRECT_DB)
+	if dbName == "" && backupConfig != nil {
+		dbName = utils.UnquoteIdent(backupConfig.DatabaseName)
+	}
+	hookConfig.RunHooks(hookPoint, utils.HookEnvironment{Utility: "gprestore", Timestamp: MustGetFlagString(options.TIMESTAMP), DBName: dbName})
+}
+
 func CreateConnectionPool(unquotedDBName string) {
 	connectionPool = dbconn.NewDBConnFromEnvironment(unquotedDBName)
 	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
@@ -132,6 +191,7 @@ func InitializeBackupConfig() {
 	backupConfig = history.ReadConfigFile(globalFPInfo.GetConfigFilePath())
 	utils.InitializePipeThroughParameters(backupConfig.Compressed, 0)
 	report.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
+	report.EnsureDataFormatCompatibility(backupConfig.DataFormatVersion, version)
 	report.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
 }
 
@@ -141,7 +201,7 @@ func BackupConfigurationValidation() {
 		VerifyBackupDirectoriesExistOnAllHosts()
 	}
 
-	VerifyMetadataFilePaths(MustGetFlagBool(options.WITH_STATS))
+	VerifyMetadataFilePaths(sectionRequested(SECTION_STATISTICS))
 
 	tocFilename := globalFPInfo.GetTOCFilePath()
 	globalTOC = toc.NewTOC(tocFilename)
@@ -189,7 +249,7 @@ func RecoverMetadataFilesUsingPlugin() {
 
 	metadataFiles := []string{globalFPInfo.GetConfigFilePath(), globalFPInfo.GetMetadataFilePath(),
 		globalFPInfo.GetBackupReportFilePath()}
-	if MustGetFlagBool(options.WITH_STATS) {
+	if sectionRequested(SECTION_STATISTICS) {
 		metadataFiles = append(metadataFiles, globalFPInfo.GetStatisticsFilePath())
 	}
 	for _, filename := range metadataFiles {
@@ -231,6 +291,32 @@ func FindHistoricalPluginVersion(timestamp string) string {
 	return historicalPluginVersion
 }
 
+/*
+ * Reads the error files written by writeErrorTables during a previous restore
+ * of this backup, returning the objects that failed during metadata restore
+ * and the tables that failed during data restore.
+ */
+func ReadErrorTablesForRetry(fpInfo filepath.FilePathInfo, restoreTimestamp string) ([]string, []string) {
+	metadataErrorFilename := fpInfo.GetErrorTablesMetadataFilePath(restoreTimestamp)
+	dataErrorFilename := fpInfo.GetErrorTablesDataFilePath(restoreTimestamp)
+	metadataObjects := make([]string, 0)
+	dataTables := make([]string, 0)
+	foundErrorFile := false
+	if iohelper.FileExistsAndIsReadable(metadataErrorFilename) {
+		metadataObjects = iohelper.MustReadLinesFromFile(metadataErrorFilename)
+		foundErrorFile = true
+	}
+	if iohelper.FileExistsAndIsReadable(dataErrorFilename) {
+		dataTables = iohelper.MustReadLinesFromFile(dataErrorFilename)
+		foundErrorFile = true
+	}
+	if !foundErrorFile {
+		gplog.Fatal(errors.Errorf("No error files found for restore with timestamp %s in %s", restoreTimestamp, fpInfo.GetDirForContent(-1)), "")
+	}
+	gplog.Info("Retrying %d object(s) that failed metadata restore and %d table(s) that failed data restore in restore %s", len(metadataObjects), len(dataTables), restoreTimestamp)
+	return metadataObjects, dataTables
+}
+
 /*
  * Metadata and/or data restore wrapper functions
  */
@@ -354,6 +440,43 @@ func GetExistingTableFQNs() ([]string, error) {
 	return existingTableFQNs, err
 }
 
+/*
+ * Returns the on-disk size of each table referenced by the given statements,
+ * keyed on the table FQN.
+ */
+func GetTableSizes(statements []toc.StatementWithType) (map[string]int64, error) {
+	tableSizes := make(map[string]int64)
+	tableSet := make(map[string]bool)
+	tableFQNs := make([]string, 0)
+	for _, statement := range statements {
+		if statement.ReferenceObject != "" && !tableSet[statement.ReferenceObject] {
+			tableSet[statement.ReferenceObject] = true
+			tableFQNs = append(tableFQNs, statement.ReferenceObject)
+		}
+	}
+	if len(tableFQNs) == 0 {
+		return tableSizes, nil
+	}
+
+	query := fmt.Sprintf(`SELECT quote_ident(n.nspname) || '.' || quote_ident(c.relname) AS name,
+				pg_relation_size(c.oid) AS size
+			  FROM pg_catalog.pg_class c
+				JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace
+			  WHERE quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)`, utils.SliceToQuotedString(tableFQNs))
+	results := make([]struct {
+		Name string
+		Size int64
+	}, 0)
+	err := connectionPool.Select(&results, query)
+	if err != nil {
+		return tableSizes, err
+	}
+	for _, result := range results {
+		tableSizes[result.Name] = result.Size
+	}
+	return tableSizes, nil
+}
+
 func GetExistingSchemas() ([]string, error) {
 	existingSchemas := make([]string, 0)
 
@@ -371,6 +494,9 @@ func TruncateTablesBeforeRestore(entries []toc.MasterDataEntry) error {
 	tableFQNs := make([]string, 0)
 	for _, entry := range entries {
 		tableFQN := utils.MakeFQN(entry.Schema, entry.Name)
+		if opts.RedirectSchema != "" {
+			tableFQN = utils.MakeFQN(opts.RedirectSchema, entry.Name)
+		}
 		tableFQNs = append(tableFQNs, tableFQN)
 	}
 	query += strings.Join(tableFQNs, ",")
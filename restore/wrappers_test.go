@@ -8,6 +8,7 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	backupfilepath "github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/restore"
@@ -126,6 +127,43 @@ var _ = Describe("wrapper tests", func() {
 		})
 
 	})
+	Describe("ReadErrorTablesForRetry", func() {
+		var fpInfo backupfilepath.FilePathInfo
+		var tempDir string
+		BeforeEach(func() {
+			tempDir, _ = ioutil.TempDir("", "temp")
+			fpInfo = backupfilepath.NewFilePathInfo(testutils.SetupTestCluster(), tempDir, "20170101010101", "gpseg")
+			err := os.MkdirAll(fpInfo.GetDirForContent(-1), 0777)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		AfterEach(func() {
+			_ = os.RemoveAll(tempDir)
+		})
+		It("reads both metadata and data error files", func() {
+			err := ioutil.WriteFile(fpInfo.GetErrorTablesMetadataFilePath("20170202020202"), []byte("public.foo\npublic.func(integer)"), 0444)
+			Expect(err).ToNot(HaveOccurred())
+			err = ioutil.WriteFile(fpInfo.GetErrorTablesDataFilePath("20170202020202"), []byte("public.foo\npublic.bar"), 0444)
+			Expect(err).ToNot(HaveOccurred())
+
+			metadataObjects, dataTables := restore.ReadErrorTablesForRetry(fpInfo, "20170202020202")
+
+			Expect(metadataObjects).To(Equal([]string{"public.foo", "public.func(integer)"}))
+			Expect(dataTables).To(Equal([]string{"public.foo", "public.bar"}))
+		})
+		It("returns an empty list for a missing error file", func() {
+			err := ioutil.WriteFile(fpInfo.GetErrorTablesDataFilePath("20170202020202"), []byte("public.bar"), 0444)
+			Expect(err).ToNot(HaveOccurred())
+
+			metadataObjects, dataTables := restore.ReadErrorTablesForRetry(fpInfo, "20170202020202")
+
+			Expect(metadataObjects).To(BeEmpty())
+			Expect(dataTables).To(Equal([]string{"public.bar"}))
+		})
+		It("panics if neither error file exists", func() {
+			defer testhelper.ShouldPanicWithMessage("No error files found for restore with timestamp 20170202020202")
+			restore.ReadErrorTablesForRetry(fpInfo, "20170202020202")
+		})
+	})
 	Describe("restore history tests", func() {
 		sampleConfigContents := `
 executablepath: /bin/echo
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var localTempFileRegex = regexp.MustCompile(`\.tmp[0-9]+$`)
+
+/*
+ * Stores files under Directory, which is expected to be shared by all hosts,
+ * such as an NFS mount.
+ */
+type LocalStorage struct {
+	Directory string
+}
+
+func NewLocalStorage(options map[string]string) (*LocalStorage, error) {
+	directory := options["directory"]
+	if directory == "" {
+		return nil, errors.New("The directory option is required for the local storage backend")
+	}
+	if !path.IsAbs(directory) {
+		return nil, errors.Errorf("The directory %s for the local storage backend must be an absolute path", directory)
+	}
+	return &LocalStorage{Directory: directory}, nil
+}
+
+func (local *LocalStorage) getPath(filename string) string {
+	return path.Join(local.Directory, GetObjectName(filename))
+}
+
+/*
+ * Files are written to a temporary file and renamed when the writer is closed,
+ * so that readers never see a partially written file.
+ */
+type localWriter struct {
+	*os.File
+	target string
+}
+
+func (writer *localWriter) Close() error {
+	err := writer.File.Close()
+	if err != nil {
+		_ = os.Remove(writer.Name())
+		return err
+	}
+	return os.Rename(writer.Name(), writer.target)
+}
+
+func (local *LocalStorage) NewWriter(filename string) (io.WriteCloser, error) {
+	target := local.getPath(filename)
+	err := os.MkdirAll(path.Dir(target), 0755)
+	if err != nil {
+		return nil, err
+	}
+	file, err := ioutil.TempFile(path.Dir(target), path.Base(target)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &localWriter{File: file, target: target}, nil
+}
+
+func (local *LocalStorage) NewReader(filename string) (io.ReadCloser, error) {
+	return os.Open(local.getPath(filename))
+}
+
+type localRangeReader struct {
+	*io.SectionReader
+	file *os.File
+}
+
+func (reader *localRangeReader) Close() error {
+	return reader.file.Close()
+}
+
+func (local *LocalStorage) NewRangeReader(filename string, startByte uint64, endByte uint64) (io.ReadCloser, error) {
+	file, err := os.Open(local.getPath(filename))
+	if err != nil {
+		return nil, err
+	}
+	return &localRangeReader{SectionReader: io.NewSectionReader(file, int64(startByte), int64(endByte-startByte)), file: file}, nil
+}
+
+/*
+ * Returns the names of all files whose object names begin with prefix.
+ */
+func (local *LocalStorage) List(prefix string) ([]string, error) {
+	names := make([]string, 0)
+	err := path.Walk(local.Directory, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && filePath == local.Directory {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := path.Rel(local.Directory, filePath)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(name, prefix) && !localTempFileRegex.MatchString(name) {
+			names = append(names, name)
+		}
+		return nil
+	})
+	sort.Strings(names)
+	return names, err
+}
+
+func (local *LocalStorage) Delete(filename string) error {
+	return local.DeleteObject(GetObjectName(filename))
+}
+
+func (local *LocalStorage) DeleteObject(name string) error {
+	err := os.Remove(path.Join(local.Directory, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
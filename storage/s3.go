@@ -0,0 +1,471 @@
+package storage
+
+/*
+ * This file contains an S3 storage backend that uses the S3 REST API directly,
+ * signing requests with AWS Signature Version 4, so that it works with any
+ * S3-compatible object store.
+ */
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DEFAULT_S3_REGION     = "us-east-1"
+	DEFAULT_S3_CHUNK_SIZE = 64 * 1024 * 1024
+	MIN_S3_CHUNK_SIZE     = 5 * 1024 * 1024
+	emptyPayloadHash      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+)
+
+/*
+ * Objects are stored in Bucket under Folder, using path-style requests to
+ * Endpoint.  Uploads larger than ChunkSize use multipart uploads.
+ */
+type S3Storage struct {
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Folder          string
+	AccessKeyID     string
+	SecretAccessKey string
+	ChunkSize       int
+	client          *http.Client
+}
+
+/*
+ * Credentials are read from the aws_access_key_id and aws_secret_access_key
+ * options, or from the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment
+ * variables if the options are not set.
+ */
+func NewS3Storage(options map[string]string) (*S3Storage, error) {
+	s3 := &S3Storage{
+		Endpoint:        strings.TrimSuffix(options["endpoint"], "/"),
+		Region:          options["region"],
+		Bucket:          options["bucket"],
+		Folder:          strings.Trim(options["folder"], "/"),
+		AccessKeyID:     options["aws_access_key_id"],
+		SecretAccessKey: options["aws_secret_access_key"],
+		ChunkSize:       DEFAULT_S3_CHUNK_SIZE,
+		client:          &http.Client{},
+	}
+	if s3.Bucket == "" {
+		return nil, errors.New("The bucket option is required for the s3 storage backend")
+	}
+	if s3.Region == "" {
+		s3.Region = DEFAULT_S3_REGION
+	}
+	if s3.Endpoint == "" {
+		s3.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s3.Region)
+	}
+	if _, err := url.ParseRequestURI(s3.Endpoint); err != nil {
+		return nil, errors.Errorf("Invalid endpoint %s for the s3 storage backend", s3.Endpoint)
+	}
+	if s3.AccessKeyID == "" {
+		s3.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s3.SecretAccessKey == "" {
+		s3.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+		return nil, errors.New("The aws_access_key_id and aws_secret_access_key options are required for the s3 storage backend")
+	}
+	if chunkSize := options["multipart_chunksize"]; chunkSize != "" {
+		size, err := ParseByteSize(chunkSize)
+		if err != nil || size <= 0 {
+			return nil, errors.Errorf("Invalid multipart_chunksize %s for the s3 storage backend", chunkSize)
+		}
+		if size < MIN_S3_CHUNK_SIZE {
+			return nil, errors.Errorf("multipart_chunksize %s is below the S3 minimum part size of 5MB", chunkSize)
+		}
+		s3.ChunkSize = int(size)
+	}
+	return s3, nil
+}
+
+/*
+ * Parses sizes such as 500MB or 1GB, with KB, MB, and GB as powers of 1024.
+ */
+func ParseByteSize(size string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}}
+	size = strings.ToUpper(strings.TrimSpace(size))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(size, unit.suffix) {
+			size = strings.TrimSpace(strings.TrimSuffix(size, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	value, err := strconv.ParseInt(size, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return value * multiplier, nil
+}
+
+func (s3 *S3Storage) getKey(filename string) string {
+	return s3.getObjectKey(GetObjectName(filename))
+}
+
+func (s3 *S3Storage) getObjectKey(name string) string {
+	if s3.Folder == "" {
+		return name
+	}
+	return s3.Folder + "/" + name
+}
+
+/*
+ * Encodes a string as required for canonical requests, leaving only unreserved
+ * characters, and slashes if encodeSlash is false, unencoded.
+ */
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		if (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') ||
+			b == '-' || b == '_' || b == '.' || b == '~' || (b == '/' && !encodeSlash) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:])
+}
+
+func getSigningKey(secretAccessKey string, date string, region string, service string) []byte {
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	return hmacSHA256(key, "aws4_request")
+}
+
+/*
+ * Signs the request with AWS Signature Version 4, using the host,
+ * x-amz-content-sha256, and x-amz-date headers as the signed headers.
+ */
+func (s3 *S3Storage) signRequest(request *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	request.Header.Set("x-amz-content-sha256", payloadHash)
+	request.Header.Set("x-amz-date", amzDate)
+
+	query := request.URL.Query()
+	queryKeys := make([]string, 0, len(query))
+	for key := range query {
+		queryKeys = append(queryKeys, key)
+	}
+	sort.Strings(queryKeys)
+	queryParts := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		queryParts = append(queryParts, uriEncode(key, true)+"="+uriEncode(query.Get(key), true))
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", request.URL.Host, payloadHash, amzDate)
+	canonicalRequest := strings.Join([]string{request.Method, uriEncode(request.URL.Path, false), strings.Join(queryParts, "&"),
+		canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s3.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+	signature := hex.EncodeToString(hmacSHA256(getSigningKey(s3.SecretAccessKey, date, s3.Region, "s3"), stringToSign))
+	request.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3.AccessKeyID, scope, signedHeaders, signature))
+}
+
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+/*
+ * Sends a signed request for the given key, or for the bucket if key is empty,
+ * and returns the response if its status code is expectedStatus.
+ */
+func (s3 *S3Storage) doRequest(method string, key string, query url.Values, body []byte, expectedStatus int) (*http.Response, error) {
+	return s3.doRequestWithHeader(method, key, query, nil, body, expectedStatus)
+}
+
+/*
+ * Sends a request as doRequest does, with additional headers that are sent
+ * unsigned.
+ */
+func (s3 *S3Storage) doRequestWithHeader(method string, key string, query url.Values, header http.Header, body []byte, expectedStatus int) (*http.Response, error) {
+	requestPath := "/" + s3.Bucket
+	if key != "" {
+		requestPath += "/" + key
+	}
+	requestURL, err := url.Parse(s3.Endpoint + uriEncode(requestPath, false))
+	if err != nil {
+		return nil, err
+	}
+	requestURL.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+	request, err := http.NewRequest(method, requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	s3.signRequest(request, payloadHash, time.Now())
+	response, err := s3.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != expectedStatus {
+		defer response.Body.Close()
+		contents, _ := ioutil.ReadAll(response.Body)
+		s3Err := s3Error{}
+		if xml.Unmarshal(contents, &s3Err) == nil && s3Err.Code != "" {
+			return nil, errors.Errorf("S3 request %s %s failed with status %d: %s: %s", method, requestURL.Path, response.StatusCode, s3Err.Code, s3Err.Message)
+		}
+		return nil, errors.Errorf("S3 request %s %s failed with status %d", method, requestURL.Path, response.StatusCode)
+	}
+	return response, nil
+}
+
+func (s3 *S3Storage) doRequestAndClose(method string, key string, query url.Values, body []byte, expectedStatus int) (http.Header, error) {
+	response, err := s3.doRequest(method, key, query, body, expectedStatus)
+	if err != nil {
+		return nil, err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+	return response.Header, nil
+}
+
+type s3Part struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+/*
+ * Buffers data up to the chunk size of the backend.  Files smaller than the
+ * chunk size are uploaded with a single request when the writer is closed,
+ * and larger files are uploaded in parts as each chunk is filled.
+ */
+type s3Writer struct {
+	s3       *S3Storage
+	key      string
+	buffer   []byte
+	uploadID string
+	parts    []s3Part
+	err      error
+}
+
+func (s3 *S3Storage) NewWriter(filename string) (io.WriteCloser, error) {
+	return &s3Writer{s3: s3, key: s3.getKey(filename)}, nil
+}
+
+/*
+ * The buffer grows as data is written, up to the chunk size, so that writing
+ * a small file does not allocate a whole chunk.
+ */
+func (writer *s3Writer) growBuffer(count int) {
+	needed := len(writer.buffer) + count
+	if needed <= cap(writer.buffer) {
+		return
+	}
+	size := 2 * cap(writer.buffer)
+	if size < needed {
+		size = needed
+	}
+	if size > writer.s3.ChunkSize {
+		size = writer.s3.ChunkSize
+	}
+	buffer := make([]byte, len(writer.buffer), size)
+	copy(buffer, writer.buffer)
+	writer.buffer = buffer
+}
+
+func (writer *s3Writer) Write(data []byte) (int, error) {
+	if writer.err != nil {
+		return 0, writer.err
+	}
+	written := 0
+	for len(data) > 0 {
+		count := writer.s3.ChunkSize - len(writer.buffer)
+		if count > len(data) {
+			count = len(data)
+		}
+		writer.growBuffer(count)
+		writer.buffer = append(writer.buffer, data[:count]...)
+		data = data[count:]
+		written += count
+		if len(writer.buffer) == writer.s3.ChunkSize {
+			writer.err = writer.uploadPart()
+			if writer.err != nil {
+				writer.abort()
+				return written, writer.err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (writer *s3Writer) uploadPart() error {
+	if writer.uploadID == "" {
+		response, err := writer.s3.doRequest("POST", writer.key, url.Values{"uploads": {""}}, nil, http.StatusOK)
+		if err != nil {
+			return err
+		}
+		defer response.Body.Close()
+		result := struct {
+			UploadID string `xml:"UploadId"`
+		}{}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to start multipart upload of %s", writer.key)
+		}
+		writer.uploadID = result.UploadID
+	}
+	partNumber := len(writer.parts) + 1
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {writer.uploadID}}
+	header, err := writer.s3.doRequestAndClose("PUT", writer.key, query, writer.buffer, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	writer.parts = append(writer.parts, s3Part{PartNumber: partNumber, ETag: header.Get("ETag")})
+	writer.buffer = writer.buffer[:0]
+	return nil
+}
+
+func (writer *s3Writer) abort() {
+	if writer.uploadID != "" {
+		_, _ = writer.s3.doRequestAndClose("DELETE", writer.key, url.Values{"uploadId": {writer.uploadID}}, nil, http.StatusNoContent)
+	}
+}
+
+func (writer *s3Writer) Close() error {
+	if writer.err != nil {
+		return writer.err
+	}
+	if writer.uploadID == "" {
+		_, writer.err = writer.s3.doRequestAndClose("PUT", writer.key, url.Values{}, writer.buffer, http.StatusOK)
+		return writer.err
+	}
+	if len(writer.buffer) > 0 {
+		writer.err = writer.uploadPart()
+		if writer.err != nil {
+			writer.abort()
+			return writer.err
+		}
+	}
+	completion, err := xml.Marshal(struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []s3Part `xml:"Part"`
+	}{Parts: writer.parts})
+	if err != nil {
+		return err
+	}
+	_, writer.err = writer.s3.doRequestAndClose("POST", writer.key, url.Values{"uploadId": {writer.uploadID}}, completion, http.StatusOK)
+	if writer.err != nil {
+		writer.abort()
+	}
+	return writer.err
+}
+
+func (s3 *S3Storage) NewReader(filename string) (io.ReadCloser, error) {
+	response, err := s3.doRequest("GET", s3.getKey(filename), url.Values{}, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+func (s3 *S3Storage) NewRangeReader(filename string, startByte uint64, endByte uint64) (io.ReadCloser, error) {
+	// HTTP ranges cannot be empty, so there is nothing to request for an empty range
+	if endByte <= startByte {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+	header := http.Header{"Range": {fmt.Sprintf("bytes=%d-%d", startByte, endByte-1)}}
+	response, err := s3.doRequestWithHeader("GET", s3.getKey(filename), url.Values{}, header, nil, http.StatusPartialContent)
+	if err != nil {
+		return nil, err
+	}
+	return response.Body, nil
+}
+
+/*
+ * Returns the names of all objects in the folder whose names, relative to the
+ * folder, begin with prefix.
+ */
+func (s3 *S3Storage) List(prefix string) ([]string, error) {
+	folderPrefix := ""
+	if s3.Folder != "" {
+		folderPrefix = s3.Folder + "/"
+	}
+	names := make([]string, 0)
+	continuationToken := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {folderPrefix + prefix}}
+		if continuationToken != "" {
+			query.Set("continuation-token", continuationToken)
+		}
+		response, err := s3.doRequest("GET", "", query, nil, http.StatusOK)
+		if err != nil {
+			return nil, err
+		}
+		result := struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}{}
+		err = xml.NewDecoder(response.Body).Decode(&result)
+		_ = response.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to parse S3 object list")
+		}
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, folderPrefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		continuationToken = result.NextContinuationToken
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (s3 *S3Storage) Delete(filename string) error {
+	return s3.DeleteObject(GetObjectName(filename))
+}
+
+func (s3 *S3Storage) DeleteObject(name string) error {
+	_, err := s3.doRequestAndClose("DELETE", s3.getObjectKey(name), url.Values{}, nil, http.StatusNoContent)
+	return err
+}
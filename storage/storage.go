@@ -0,0 +1,103 @@
+package storage
+
+/*
+ * This file contains the interface implemented by the built-in storage
+ * backends, which can be used in place of a plugin executable to store backup
+ * files in a local directory or an S3-compatible object store.
+ */
+
+import (
+	"io"
+	"os"
+	path "path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	LOCAL_STORAGE = "local"
+	S3_STORAGE    = "s3"
+)
+
+/*
+ * Files are identified by their paths in the backup directory, as with the
+ * plugin API, and each backend maps those paths to its own object names.
+ */
+type StorageBackend interface {
+	NewWriter(filename string) (io.WriteCloser, error)
+	NewReader(filename string) (io.ReadCloser, error)
+	// Returns a reader for the bytes of the file from startByte up to, but not including, endByte
+	NewRangeReader(filename string, startByte uint64, endByte uint64) (io.ReadCloser, error)
+	List(prefix string) ([]string, error)
+	Delete(filename string) error
+	// Deletes an object by its name as returned by List
+	DeleteObject(name string) error
+}
+
+func NewStorageBackend(backend string, options map[string]string) (StorageBackend, error) {
+	switch backend {
+	case LOCAL_STORAGE:
+		return NewLocalStorage(options)
+	case S3_STORAGE:
+		return NewS3Storage(options)
+	default:
+		return nil, errors.Errorf("Invalid storage backend %s; backend must be %s or %s", backend, LOCAL_STORAGE, S3_STORAGE)
+	}
+}
+
+/*
+ * Files in a timestamp directory are stored under backups/YYYYMMDD/timestamp,
+ * so that files backed up from different segment hosts can be restored to a
+ * cluster with a different layout.  All other files are stored by base name.
+ */
+func GetObjectName(filename string) string {
+	if index := strings.LastIndex(filename, "/backups/"); index != -1 {
+		return filename[index+1:]
+	}
+	return path.Base(filename)
+}
+
+/*
+ * Uploads the local file to the backend.
+ */
+func PutFile(backend StorageBackend, filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	writer, err := backend.NewWriter(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+/*
+ * Downloads the file from the backend, creating its local directory if needed.
+ */
+func GetFile(backend StorageBackend, filename string) error {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	reader, err := backend.NewReader(filename)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,19 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "storage tests")
+}
+
+var _ = BeforeSuite(func() {
+	_, _, _ = testhelper.SetupTestLogger()
+})
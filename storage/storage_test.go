@@ -0,0 +1,190 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/storage"
+	"github.com/greenplum-db/gpbackup/testutils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("storage tests", func() {
+	backupFile := "/data/gpseg0/backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz"
+	var tempDir string
+	BeforeEach(func() {
+		tempDir, _ = ioutil.TempDir("", "storage_test")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+	writeObject := func(backend storage.StorageBackend, filename string, contents string) {
+		writer, err := backend.NewWriter(filename)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = writer.Write([]byte(contents))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(writer.Close()).To(Succeed())
+	}
+	readObject := func(backend storage.StorageBackend, filename string) string {
+		reader, err := backend.NewReader(filename)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+		contents, err := ioutil.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		return string(contents)
+	}
+	readRange := func(backend storage.StorageBackend, filename string, startByte uint64, endByte uint64) string {
+		reader, err := backend.NewRangeReader(filename, startByte, endByte)
+		Expect(err).ToNot(HaveOccurred())
+		defer reader.Close()
+		contents, err := ioutil.ReadAll(reader)
+		Expect(err).ToNot(HaveOccurred())
+		return string(contents)
+	}
+
+	Describe("GetObjectName", func() {
+		It("keeps the path of files in a timestamp directory from the backups directory", func() {
+			Expect(storage.GetObjectName(backupFile)).To(Equal("backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz"))
+		})
+		It("uses the base name of other files", func() {
+			Expect(storage.GetObjectName("/tmp/gpbackup_history.yaml")).To(Equal("gpbackup_history.yaml"))
+		})
+	})
+	Describe("NewStorageBackend", func() {
+		It("returns an error for an unknown backend", func() {
+			_, err := storage.NewStorageBackend("ftp", map[string]string{})
+			Expect(err).To(MatchError("Invalid storage backend ftp; backend must be local or s3"))
+		})
+		It("requires a directory for the local backend", func() {
+			_, err := storage.NewStorageBackend(storage.LOCAL_STORAGE, map[string]string{})
+			Expect(err).To(MatchError("The directory option is required for the local storage backend"))
+		})
+		It("requires a bucket for the s3 backend", func() {
+			_, err := storage.NewStorageBackend(storage.S3_STORAGE, map[string]string{})
+			Expect(err).To(MatchError("The bucket option is required for the s3 storage backend"))
+		})
+		It("returns an error for an invalid multipart chunk size", func() {
+			_, err := storage.NewStorageBackend(storage.S3_STORAGE, map[string]string{"bucket": "bucket", "aws_access_key_id": "id", "aws_secret_access_key": "secret", "multipart_chunksize": "lots"})
+			Expect(err).To(MatchError("Invalid multipart_chunksize lots for the s3 storage backend"))
+		})
+		It("returns an error for a multipart chunk size below the S3 minimum", func() {
+			_, err := storage.NewStorageBackend(storage.S3_STORAGE, map[string]string{"bucket": "bucket", "aws_access_key_id": "id", "aws_secret_access_key": "secret", "multipart_chunksize": "4MB"})
+			Expect(err).To(MatchError("multipart_chunksize 4MB is below the S3 minimum part size of 5MB"))
+		})
+	})
+	Describe("ParseByteSize", func() {
+		It("parses sizes with units", func() {
+			Expect(storage.ParseByteSize("500MB")).To(Equal(int64(500 * 1024 * 1024)))
+			Expect(storage.ParseByteSize("2 gb")).To(Equal(int64(2 * 1024 * 1024 * 1024)))
+			Expect(storage.ParseByteSize("1024")).To(Equal(int64(1024)))
+		})
+	})
+	Describe("LocalStorage", func() {
+		var backend storage.StorageBackend
+		BeforeEach(func() {
+			var err error
+			backend, err = storage.NewStorageBackend(storage.LOCAL_STORAGE, map[string]string{"directory": tempDir})
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("writes, reads, lists, and deletes files", func() {
+			writeObject(backend, backupFile, "table data")
+
+			Expect(readObject(backend, backupFile)).To(Equal("table data"))
+			Expect(backend.List("backups/20200101/")).To(Equal([]string{"backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz"}))
+			Expect(backend.List("backups/20200102/")).To(BeEmpty())
+
+			Expect(backend.Delete(backupFile)).To(Succeed())
+			Expect(backend.List("")).To(BeEmpty())
+		})
+		It("deletes files by the names returned by List", func() {
+			writeObject(backend, backupFile, "table data")
+			writeObject(backend, "/data/gpbackup_history.yaml", "history")
+
+			Expect(backend.List("")).To(Equal([]string{"backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz", "gpbackup_history.yaml"}))
+			Expect(backend.DeleteObject("backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz")).To(Succeed())
+			Expect(backend.DeleteObject("gpbackup_history.yaml")).To(Succeed())
+			Expect(backend.List("")).To(BeEmpty())
+		})
+		It("reads byte ranges of files", func() {
+			writeObject(backend, backupFile, "table data")
+
+			Expect(readRange(backend, backupFile, 6, 10)).To(Equal("data"))
+			Expect(readRange(backend, backupFile, 3, 3)).To(Equal(""))
+		})
+		It("puts and gets local files", func() {
+			localFile := path.Join(tempDir, "local", "backups", "20200101", "20200101010101", "gpbackup_20200101010101_toc.yaml")
+			Expect(os.MkdirAll(path.Dir(localFile), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(localFile, []byte("toc contents"), 0644)).To(Succeed())
+
+			Expect(storage.PutFile(backend, localFile)).To(Succeed())
+			Expect(os.Remove(localFile)).To(Succeed())
+			Expect(storage.GetFile(backend, localFile)).To(Succeed())
+
+			Expect(ioutil.ReadFile(localFile)).To(Equal([]byte("toc contents")))
+		})
+	})
+	Describe("S3Storage", func() {
+		var fakeS3 *testutils.FakeS3Server
+		var backend storage.StorageBackend
+		BeforeEach(func() {
+			fakeS3 = testutils.NewFakeS3Server("bucket")
+			var err error
+			backend, err = storage.NewStorageBackend(storage.S3_STORAGE, map[string]string{
+				"endpoint":              fakeS3.URL,
+				"bucket":                "bucket",
+				"folder":                "/test/folder/",
+				"aws_access_key_id":     "id",
+				"aws_secret_access_key": "secret",
+			})
+			Expect(err).ToNot(HaveOccurred())
+			// Use tiny parts so that the multipart upload can be tested with small files
+			backend.(*storage.S3Storage).ChunkSize = 4
+		})
+		AfterEach(func() {
+			fakeS3.Close()
+		})
+		It("writes small files with a single request", func() {
+			writeObject(backend, backupFile, "abc")
+
+			Expect(fakeS3.Objects).To(Equal(map[string][]byte{"test/folder/backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz": []byte("abc")}))
+			Expect(fakeS3.Requests).To(Equal([]string{"PUT /bucket/test/folder/backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz"}))
+		})
+		It("writes large files with a multipart upload", func() {
+			writeObject(backend, backupFile, "table data")
+
+			Expect(readObject(backend, backupFile)).To(Equal("table data"))
+			Expect(fakeS3.Requests).To(HaveLen(6))
+			Expect(fakeS3.NumPendingUploads()).To(Equal(0))
+		})
+		It("reads byte ranges of objects", func() {
+			writeObject(backend, backupFile, "abc")
+
+			Expect(readRange(backend, backupFile, 1, 3)).To(Equal("bc"))
+			Expect(readRange(backend, backupFile, 2, 2)).To(Equal(""))
+			Expect(fakeS3.Requests).To(HaveLen(2))
+		})
+		It("lists and deletes objects in the folder", func() {
+			writeObject(backend, backupFile, "abc")
+			writeObject(backend, strings.Replace(backupFile, "16384", "16385", 1), "def")
+
+			Expect(backend.List("backups/20200101/")).To(Equal([]string{
+				"backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz",
+				"backups/20200101/20200101010101/gpbackup_0_20200101010101_16385.gz",
+			}))
+
+			Expect(backend.Delete(backupFile)).To(Succeed())
+			Expect(backend.List("")).To(Equal([]string{"backups/20200101/20200101010101/gpbackup_0_20200101010101_16385.gz"}))
+
+			Expect(backend.DeleteObject("backups/20200101/20200101010101/gpbackup_0_20200101010101_16385.gz")).To(Succeed())
+			Expect(backend.List("")).To(BeEmpty())
+		})
+		It("returns S3 errors", func() {
+			_, err := backend.NewReader(backupFile)
+			Expect(err).To(MatchError("S3 request GET /bucket/test/folder/backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz failed with status 404: NoSuchKey: NoSuchKey"))
+		})
+	})
+})
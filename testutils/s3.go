@@ -0,0 +1,154 @@
+package testutils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * FakeS3Server is an in-memory stand-in for an S3-compatible object store,
+ * supporting the path-style requests used by the s3 storage backend.
+ */
+type FakeS3Server struct {
+	*httptest.Server
+	Bucket  string
+	Objects map[string][]byte
+	// Requests records the method and path of each request, such as "PUT /bucket/key"
+	Requests []string
+	uploads  map[string]map[int][]byte
+	mutex    sync.Mutex
+}
+
+func NewFakeS3Server(bucket string) *FakeS3Server {
+	fake := &FakeS3Server{
+		Bucket:   bucket,
+		Objects:  make(map[string][]byte),
+		Requests: make([]string, 0),
+		uploads:  make(map[string]map[int][]byte),
+	}
+	fake.Server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	return fake
+}
+
+func (fake *FakeS3Server) writeError(writer http.ResponseWriter, status int, code string) {
+	writer.WriteHeader(status)
+	_, _ = fmt.Fprintf(writer, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (fake *FakeS3Server) handle(writer http.ResponseWriter, request *http.Request) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	fake.Requests = append(fake.Requests, fmt.Sprintf("%s %s", request.Method, request.URL.Path))
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		fake.writeError(writer, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	pathParts := strings.SplitN(strings.TrimPrefix(request.URL.Path, "/"), "/", 2)
+	if pathParts[0] != fake.Bucket {
+		fake.writeError(writer, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := ""
+	if len(pathParts) == 2 {
+		key = pathParts[1]
+	}
+	query := request.URL.Query()
+	body, _ := ioutil.ReadAll(request.Body)
+
+	switch {
+	case request.Method == "GET" && key == "":
+		fake.listObjects(writer, query.Get("prefix"))
+	case request.Method == "GET":
+		contents, ok := fake.Objects[key]
+		if !ok {
+			fake.writeError(writer, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		var start, end int
+		if _, err := fmt.Sscanf(request.Header.Get("Range"), "bytes=%d-%d", &start, &end); err == nil {
+			if start > end || end >= len(contents) {
+				fake.writeError(writer, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			writer.WriteHeader(http.StatusPartialContent)
+			contents = contents[start : end+1]
+		}
+		_, _ = writer.Write(contents)
+	case request.Method == "PUT" && query.Get("uploadId") != "":
+		parts, ok := fake.uploads[query.Get("uploadId")]
+		if !ok {
+			fake.writeError(writer, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		writer.Header().Set("ETag", fmt.Sprintf(`"etag%d"`, partNumber))
+	case request.Method == "PUT":
+		fake.Objects[key] = body
+	case request.Method == "POST" && query["uploads"] != nil:
+		uploadID := fmt.Sprintf("upload%d", len(fake.uploads)+1)
+		fake.uploads[uploadID] = make(map[int][]byte)
+		_, _ = fmt.Fprintf(writer, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", uploadID)
+	case request.Method == "POST" && query.Get("uploadId") != "":
+		parts, ok := fake.uploads[query.Get("uploadId")]
+		if !ok {
+			fake.writeError(writer, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		completion := struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}{}
+		_ = xml.Unmarshal(body, &completion)
+		contents := make([]byte, 0)
+		for _, part := range completion.Parts {
+			contents = append(contents, parts[part.PartNumber]...)
+		}
+		fake.Objects[key] = contents
+		delete(fake.uploads, query.Get("uploadId"))
+		_, _ = fmt.Fprint(writer, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+	case request.Method == "DELETE" && query.Get("uploadId") != "":
+		delete(fake.uploads, query.Get("uploadId"))
+		writer.WriteHeader(http.StatusNoContent)
+	case request.Method == "DELETE":
+		delete(fake.Objects, key)
+		writer.WriteHeader(http.StatusNoContent)
+	default:
+		fake.writeError(writer, http.StatusBadRequest, "InvalidRequest")
+	}
+}
+
+func (fake *FakeS3Server) listObjects(writer http.ResponseWriter, prefix string) {
+	keys := make([]string, 0)
+	for key := range fake.Objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	_, _ = fmt.Fprint(writer, "<ListBucketResult>")
+	for _, key := range keys {
+		_, _ = fmt.Fprint(writer, "<Contents><Key>")
+		_ = xml.EscapeText(writer, []byte(key))
+		_, _ = fmt.Fprint(writer, "</Key></Contents>")
+	}
+	_, _ = fmt.Fprint(writer, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+}
+
+/*
+ * Returns the number of multipart uploads that were started but neither
+ * completed nor aborted.
+ */
+func (fake *FakeS3Server) NumPendingUploads() int {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+	return len(fake.uploads)
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"io/ioutil"
 	"regexp"
+	"sort"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -13,16 +14,24 @@ import (
 
 type TOC struct {
 	metadataEntryMap    map[string]*[]MetadataEntry
+	includedObjects     map[ObjectKey]bool
 	GlobalEntries       []MetadataEntry
 	PredataEntries      []MetadataEntry
 	PostdataEntries     []MetadataEntry
 	StatisticsEntries   []MetadataEntry
 	DataEntries         []MasterDataEntry
 	IncrementalMetadata IncrementalEntries
+	HasDependencies     bool `yaml:"hasdependencies,omitempty"`
 }
 
+/*
+ * In a framed segment data file, the data for each table is written as an
+ * independent frame, compressed separately if the file is compressed, so that
+ * a table's data can be restored by reading only its frame.
+ */
 type SegmentTOC struct {
 	DataEntries map[uint]SegmentDataEntry
+	Framed      bool `yaml:"framed,omitempty"`
 }
 
 type MetadataEntry struct {
@@ -32,6 +41,32 @@ type MetadataEntry struct {
 	ReferenceObject string
 	StartByte       uint64
 	EndByte         uint64
+	Dependencies    []ObjectKey `yaml:"dependencies,omitempty"`
+}
+
+/*
+ * Identifies the object to which a metadata entry belongs.  All entries for an
+ * object, such as its CREATE statement and its comments and privileges, share
+ * the same key.
+ */
+type ObjectKey struct {
+	Schema     string
+	Name       string
+	ObjectType string
+}
+
+func (entry MetadataEntry) Key() ObjectKey {
+	return ObjectKey{Schema: entry.Schema, Name: entry.Name, ObjectType: entry.ObjectType}
+}
+
+func (key ObjectKey) Less(other ObjectKey) bool {
+	if key.Schema != other.Schema {
+		return key.Schema < other.Schema
+	}
+	if key.Name != other.Name {
+		return key.Name < other.Name
+	}
+	return key.ObjectType < other.ObjectType
 }
 
 type MasterDataEntry struct {
@@ -41,11 +76,21 @@ type MasterDataEntry struct {
 	AttributeString string
 	RowsCopied      int64
 	PartitionRoot   string
+	IsExternal      bool `yaml:"isexternal,omitempty"`
 }
 
+/*
+ * StartByte and EndByte are offsets in the uncompressed data, while
+ * FileStartByte and FileEndByte are the offsets of the table's frame in the
+ * data file itself.  FileIndex identifies the data file holding the table,
+ * for backups that write more than one data file per segment.
+ */
 type SegmentDataEntry struct {
-	StartByte uint64
-	EndByte   uint64
+	StartByte     uint64
+	EndByte       uint64
+	FileStartByte uint64 `yaml:"filestartbyte,omitempty"`
+	FileEndByte   uint64 `yaml:"fileendbyte,omitempty"`
+	FileIndex     int    `yaml:"fileindex,omitempty"`
 }
 
 type IncrementalEntries struct {
@@ -126,7 +171,7 @@ func (toc *TOC) GetSQLStatementForObjectTypes(section string, metadataFile io.Re
 	objectSet, schemaSet, relationSet := constructFilterSets(includeObjectTypes, excludeObjectTypes, includeSchemas, excludeSchemas, includeRelations, excludeRelations)
 	statements := make([]StatementWithType, 0)
 	for _, entry := range entries {
-		if shouldIncludeStatement(entry, objectSet, schemaSet, relationSet) {
+		if shouldIncludeStatement(entry, objectSet, schemaSet, relationSet) || (toc.includedObjects[entry.Key()] && objectSet.MatchesFilter(entry.ObjectType)) {
 			contents := make([]byte, entry.EndByte-entry.StartByte)
 			_, err := metadataFile.ReadAt(contents, int64(entry.StartByte))
 			gplog.FatalOnError(err)
@@ -242,6 +287,24 @@ func RemoveActiveRole(activeUser string, statements []StatementWithType) []State
 	return newStatements
 }
 
+/*
+ * Keeps only the statements for the objects in objectFQNs, along with any
+ * statements that reference one of those objects (e.g. an index on a table),
+ * so that the objects recorded in a previous restore's error files can be
+ * restored again.
+ */
+func FilterStatementsByObjectFQN(statements []StatementWithType, objectFQNs []string) []StatementWithType {
+	objectSet := utils.NewSet(objectFQNs)
+	newStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		fqn := utils.MakeFQN(statement.Schema, statement.Name)
+		if objectSet.MatchesFilter(fqn) || (statement.ReferenceObject != "" && objectSet.MatchesFilter(statement.ReferenceObject)) {
+			newStatements = append(newStatements, statement)
+		}
+	}
+	return newStatements
+}
+
 func (toc *TOC) InitializeMetadataEntryMap() {
 	toc.metadataEntryMap = make(map[string]*[]MetadataEntry, 4)
 	toc.metadataEntryMap["global"] = &toc.GlobalEntries
@@ -259,17 +322,123 @@ type TOCObjectWithMetadata interface {
 	FQN() string
 }
 
+/*
+ * Objects set here are included by GetSQLStatementForObjectTypes regardless of
+ * the schema and relation filters, so that the objects on which filtered
+ * relations depend can be restored along with them.
+ */
+func (toc *TOC) SetIncludedObjects(objects map[ObjectKey]bool) {
+	toc.includedObjects = objects
+}
+
+/*
+ * Returns the objects on which each predata and postdata object depends.  Along
+ * with the dependencies recorded during backup, each object depends on its
+ * schema and on the relation given by its ReferenceObject, if those objects are
+ * in the TOC.  TOCs written before dependencies were recorded, for which
+ * HasDependencies is false, only contain these implicit dependencies.
+ */
+func (toc *TOC) GetDependencyGraph() map[ObjectKey][]ObjectKey {
+	entries := make([]MetadataEntry, 0, len(toc.PredataEntries)+len(toc.PostdataEntries))
+	entries = append(entries, toc.PredataEntries...)
+	entries = append(entries, toc.PostdataEntries...)
+
+	schemas := make(map[string]bool)
+	relations := make(map[string]ObjectKey)
+	for _, entry := range entries {
+		switch entry.ObjectType {
+		case "SCHEMA":
+			schemas[entry.Name] = true
+		case "TABLE", "VIEW", "MATERIALIZED VIEW", "SEQUENCE":
+			if entry.ReferenceObject == "" {
+				relations[utils.MakeFQN(entry.Schema, entry.Name)] = entry.Key()
+			}
+		}
+	}
+
+	graph := make(map[ObjectKey][]ObjectKey)
+	for _, entry := range entries {
+		key := entry.Key()
+		dependencies := make(map[ObjectKey]bool)
+		for _, dependency := range graph[key] {
+			dependencies[dependency] = true
+		}
+		for _, dependency := range entry.Dependencies {
+			dependencies[dependency] = true
+		}
+		if entry.ObjectType != "SCHEMA" && schemas[entry.Schema] {
+			dependencies[ObjectKey{Schema: entry.Schema, Name: entry.Schema, ObjectType: "SCHEMA"}] = true
+		}
+		if relation, ok := relations[entry.ReferenceObject]; ok {
+			dependencies[relation] = true
+		}
+		delete(dependencies, key)
+		graph[key] = sortObjectKeys(dependencies)
+	}
+	return graph
+}
+
+func sortObjectKeys(objects map[ObjectKey]bool) []ObjectKey {
+	sortedObjects := make([]ObjectKey, 0, len(objects))
+	for object := range objects {
+		sortedObjects = append(sortedObjects, object)
+	}
+	sort.Slice(sortedObjects, func(i int, j int) bool {
+		return sortedObjects[i].Less(sortedObjects[j])
+	})
+	return sortedObjects
+}
+
+/*
+ * Returns the given objects along with every object on which they depend,
+ * directly or indirectly, and with every object that depends on them as well
+ * if includeDependents is true.
+ */
+func (toc *TOC) GetDependencyClosure(objects []ObjectKey, includeDependents bool) map[ObjectKey]bool {
+	dependencies := toc.GetDependencyGraph()
+	dependents := make(map[ObjectKey][]ObjectKey)
+	for object, objectDependencies := range dependencies {
+		for _, dependency := range objectDependencies {
+			dependents[dependency] = append(dependents[dependency], object)
+		}
+	}
+	visit := func(closure map[ObjectKey]bool, roots []ObjectKey, edges map[ObjectKey][]ObjectKey) {
+		queue := append([]ObjectKey{}, roots...)
+		for len(queue) > 0 {
+			object := queue[0]
+			queue = queue[1:]
+			if closure[object] {
+				continue
+			}
+			closure[object] = true
+			queue = append(queue, edges[object]...)
+		}
+	}
+	roots := objects
+	if includeDependents {
+		dependentSet := make(map[ObjectKey]bool)
+		visit(dependentSet, objects, dependents)
+		roots = make([]ObjectKey, 0, len(dependentSet))
+		for object := range dependentSet {
+			roots = append(roots, object)
+		}
+	}
+	closure := make(map[ObjectKey]bool)
+	visit(closure, roots, dependencies)
+	return closure
+}
+
 func (toc *TOC) AddMetadataEntry(section string, entry MetadataEntry, start, end uint64) {
 	entry.StartByte = start
 	entry.EndByte = end
 	*toc.metadataEntryMap[section] = append(*toc.metadataEntryMap[section], entry)
 }
 
-func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string) {
-	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot})
+func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string, isExternal bool) {
+	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot, isExternal})
 }
 
-func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
+func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64, fileStartByte uint64, fileEndByte uint64, fileIndex int) {
 	// We use uint for oid since the flags package does not have a uint32 flag
-	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
+	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte, fileStartByte, fileEndByte, fileIndex}
 }
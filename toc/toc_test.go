@@ -6,6 +6,7 @@ import (
 
 	"github.com/greenplum-db/gpbackup/testutils"
 	"github.com/greenplum-db/gpbackup/toc"
+	"gopkg.in/yaml.v2"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -192,14 +193,142 @@ var _ = Describe("utils/toc tests", func() {
 				Expect(statements).To(Equal([]toc.StatementWithType{table1, capsTable, view, matView, sequence, sequenceTable, sequenceOwner}))
 			})
 		})
+		It("returns statements for included objects regardless of schema and relation filters", func() {
+			tocfile.SetIncludedObjects(map[toc.ObjectKey]bool{{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}: true})
+			statements := tocfile.GetSQLStatementForObjectTypes("predata", metadataFile, noInObj, noExObj, noInSchema, noExSchema, []string{"schema.view"}, noExRelation)
+
+			Expect(statements).To(Equal([]toc.StatementWithType{table2, view}))
+		})
+		It("does not return statements for included objects of an excluded type", func() {
+			tocfile.SetIncludedObjects(map[toc.ObjectKey]bool{{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}: true})
+			statements := tocfile.GetSQLStatementForObjectTypes("predata", metadataFile, noInObj, []string{"TABLE"}, noInSchema, noExSchema, []string{"schema.view"}, noExRelation)
+
+			Expect(statements).To(Equal([]toc.StatementWithType{view}))
+		})
+	})
+	Describe("GetDependencyGraph", func() {
+		schemaKey := toc.ObjectKey{Schema: "schema", Name: "schema", ObjectType: "SCHEMA"}
+		functionKey := toc.ObjectKey{Schema: "schema", Name: "somefunc(integer)", ObjectType: "FUNCTION"}
+		tableKey := toc.ObjectKey{Schema: "schema", Name: "table1", ObjectType: "TABLE"}
+		indexKey := toc.ObjectKey{Schema: "schema", Name: "index1", ObjectType: "INDEX"}
+		It("combines recorded dependencies with schema and reference object dependencies", func() {
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "schema", ObjectType: "SCHEMA"}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "somefunc(integer)", ObjectType: "FUNCTION"}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE", Dependencies: []toc.ObjectKey{functionKey}}, 0, 0)
+			tocfile.AddMetadataEntry("postdata", toc.MetadataEntry{Schema: "schema", Name: "index1", ObjectType: "INDEX", ReferenceObject: "schema.table1"}, 0, 0)
+
+			graph := tocfile.GetDependencyGraph()
+
+			Expect(graph).To(Equal(map[toc.ObjectKey][]toc.ObjectKey{
+				schemaKey:   {},
+				functionKey: {schemaKey},
+				tableKey:    {schemaKey, functionKey},
+				indexKey:    {schemaKey, tableKey},
+			}))
+		})
+		It("ignores implicit dependencies on objects not in the TOC", func() {
+			tocfile.AddMetadataEntry("postdata", toc.MetadataEntry{Schema: "schema", Name: "index1", ObjectType: "INDEX", ReferenceObject: "schema.table1"}, 0, 0)
+
+			graph := tocfile.GetDependencyGraph()
+
+			Expect(graph).To(Equal(map[toc.ObjectKey][]toc.ObjectKey{indexKey: {}}))
+		})
+	})
+	Describe("dependency serialization", func() {
+		It("writes and reads the dependencies of metadata entries", func() {
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE",
+				Dependencies: []toc.ObjectKey{{Schema: "schema", Name: "somefunc(integer)", ObjectType: "FUNCTION"}}}, 0, 0)
+			tocfile.HasDependencies = true
+
+			contents, err := yaml.Marshal(tocfile)
+			Expect(err).ToNot(HaveOccurred())
+			readTOC := &toc.TOC{}
+			Expect(yaml.Unmarshal(contents, readTOC)).To(Succeed())
+
+			Expect(readTOC.HasDependencies).To(BeTrue())
+			Expect(readTOC.PredataEntries).To(Equal(tocfile.PredataEntries))
+		})
+		It("reads TOCs written without dependencies", func() {
+			contents := []byte(`predataentries:
+- schema: schema
+  name: table1
+  objecttype: TABLE
+  referenceobject: ""
+  startbyte: 0
+  endbyte: 10
+`)
+			readTOC := &toc.TOC{}
+			Expect(yaml.Unmarshal(contents, readTOC)).To(Succeed())
+
+			Expect(readTOC.HasDependencies).To(BeFalse())
+			Expect(readTOC.PredataEntries).To(Equal([]toc.MetadataEntry{{Schema: "schema", Name: "table1", ObjectType: "TABLE", StartByte: 0, EndByte: 10}}))
+		})
+		It("does not write dependency fields for entries without dependencies", func() {
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE"}, 0, 10)
+
+			contents, err := yaml.Marshal(tocfile)
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(string(contents)).ToNot(ContainSubstring("dependencies"))
+		})
+	})
+	Describe("segment TOC serialization", func() {
+		It("writes and reads the frame offsets of data entries", func() {
+			segmentTOC := &toc.SegmentTOC{DataEntries: make(map[uint]toc.SegmentDataEntry), Framed: true}
+			segmentTOC.AddSegmentDataEntry(16384, 0, 100, 0, 40, 0)
+			segmentTOC.AddSegmentDataEntry(16385, 100, 150, 40, 70, 0)
+			segmentTOC.AddSegmentDataEntry(16386, 0, 80, 0, 30, 1)
+
+			contents, err := yaml.Marshal(segmentTOC)
+			Expect(err).ToNot(HaveOccurred())
+			readTOC := &toc.SegmentTOC{}
+			Expect(yaml.Unmarshal(contents, readTOC)).To(Succeed())
+
+			Expect(readTOC).To(Equal(segmentTOC))
+		})
+		It("reads segment TOCs written without frames", func() {
+			contents := []byte(`dataentries:
+  16384:
+    startbyte: 0
+    endbyte: 100
+`)
+			readTOC := &toc.SegmentTOC{}
+			Expect(yaml.Unmarshal(contents, readTOC)).To(Succeed())
+
+			Expect(readTOC.Framed).To(BeFalse())
+			Expect(readTOC.DataEntries).To(Equal(map[uint]toc.SegmentDataEntry{16384: {StartByte: 0, EndByte: 100}}))
+		})
+	})
+	Describe("GetDependencyClosure", func() {
+		typeKey := toc.ObjectKey{Schema: "schema", Name: "sometype", ObjectType: "TYPE"}
+		functionKey := toc.ObjectKey{Schema: "schema", Name: "somefunc(integer)", ObjectType: "FUNCTION"}
+		tableKey := toc.ObjectKey{Schema: "schema", Name: "table1", ObjectType: "TABLE"}
+		viewKey := toc.ObjectKey{Schema: "schema", Name: "view", ObjectType: "VIEW"}
+		otherTableKey := toc.ObjectKey{Schema: "schema", Name: "table2", ObjectType: "TABLE"}
+		BeforeEach(func() {
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "sometype", ObjectType: "TYPE"}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "somefunc(integer)", ObjectType: "FUNCTION", Dependencies: []toc.ObjectKey{typeKey}}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE", Dependencies: []toc.ObjectKey{functionKey}}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "view", ObjectType: "VIEW", Dependencies: []toc.ObjectKey{tableKey}}, 0, 0)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table2", ObjectType: "TABLE"}, 0, 0)
+		})
+		It("returns objects along with their transitive dependencies", func() {
+			closure := tocfile.GetDependencyClosure([]toc.ObjectKey{tableKey}, false)
+			Expect(closure).To(Equal(map[toc.ObjectKey]bool{tableKey: true, functionKey: true, typeKey: true}))
+		})
+		It("returns dependents and their dependencies when requested", func() {
+			closure := tocfile.GetDependencyClosure([]toc.ObjectKey{functionKey}, true)
+			Expect(closure).To(Equal(map[toc.ObjectKey]bool{functionKey: true, typeKey: true, tableKey: true, viewKey: true}))
+			Expect(closure).ToNot(HaveKey(otherTableKey))
+		})
 	})
 	Describe("GetDataEntriesMatching", func() {
 		BeforeEach(func() {
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema2", "table2", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema3", "table3", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema3", "table3_partition1", 1, "(i)", 0, "table3")
-			tocfile.AddMasterDataEntry("schema3", "table3_partition2", 1, "(i)", 0, "table3")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", false)
+			tocfile.AddMasterDataEntry("schema2", "table2", 1, "(i)", 0, "", false)
+			tocfile.AddMasterDataEntry("schema3", "table3", 1, "(i)", 0, "", false)
+			tocfile.AddMasterDataEntry("schema3", "table3_partition1", 1, "(i)", 0, "table3", false)
+			tocfile.AddMasterDataEntry("schema3", "table3_partition2", 1, "(i)", 0, "table3", false)
 		})
 		Context("Non-empty restore plan", func() {
 			restorePlanTableFQNs := []string{"schema1.table1", "schema2.table2", "schema3.table3", "schema3.table3_partition1", "schema3.table3_partition2"}
@@ -398,24 +527,40 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(resultStatements).To(Equal([]toc.StatementWithType{user1, user2}))
 		})
 	})
+	Describe("FilterStatementsByObjectFQN", func() {
+		table := toc.StatementWithType{Schema: "schema", Name: "table1", ObjectType: "TABLE", Statement: "CREATE TABLE schema.table1"}
+		otherTable := toc.StatementWithType{Schema: "schema", Name: "table2", ObjectType: "TABLE", Statement: "CREATE TABLE schema.table2"}
+		function := toc.StatementWithType{Schema: "schema", Name: "func(integer)", ObjectType: "FUNCTION", Statement: "CREATE FUNCTION schema.func(integer)"}
+		tableIndex := toc.StatementWithType{Schema: "schema", Name: "idx", ObjectType: "INDEX", ReferenceObject: "schema.table1", Statement: "CREATE INDEX idx ON schema.table1(i)"}
+		It("keeps statements for the listed objects and the statements that reference them", func() {
+			resultStatements := toc.FilterStatementsByObjectFQN([]toc.StatementWithType{table, otherTable, function, tableIndex}, []string{"schema.table1", "schema.func(integer)"})
+
+			Expect(resultStatements).To(Equal([]toc.StatementWithType{table, function, tableIndex}))
+		})
+		It("returns no statements if no objects are listed", func() {
+			resultStatements := toc.FilterStatementsByObjectFQN([]toc.StatementWithType{table, otherTable}, []string{})
+
+			Expect(resultStatements).To(BeEmpty())
+		})
+	})
 	Describe("GetIncludedPartitionRoots", func() {
 		It("does not return anything if relations are not leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", false)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema0.name0", "schema1.name1"})
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns root parition of leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 2, "attribute0", 1, "root0")
-			tocfile.AddMasterDataEntry("schema1", "name1", 3, "attribute0", 1, "root1")
+			tocfile.AddMasterDataEntry("schema0", "name0", 2, "attribute0", 1, "root0", false)
+			tocfile.AddMasterDataEntry("schema1", "name1", 3, "attribute0", 1, "root1", false)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema0.name0", "schema1.name1"})
 			Expect(roots).To(ConsistOf("schema0.root0", "schema1.root1"))
 		})
 		It("only returns root partitions of leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", false)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", false)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema2.name2", "schema3.name3"})
 			Expect(roots).To(ConsistOf("schema2.root2", "schema3.root3"))
 		})
@@ -424,18 +569,18 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns nothing if relation is not part of TOC data entries", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", false)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", false)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema4.name4", "schema5.name5"})
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns empty if no relations are passed in", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", false)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", false)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", false)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{})
 			Expect(roots).To(BeEmpty())
 		})
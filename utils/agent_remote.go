@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	path "path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -25,17 +26,41 @@ import (
  * possibility that the COPY FROM commands start before gpbackup_helper is done
  * starting up and setting up the first pipe.
  */
-func CreateFirstSegmentPipeOnAllHosts(oid string, c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+func CreateFirstSegmentPipesOnAllHosts(oids []string, c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
 	remoteOutput := c.GenerateAndExecuteCommand("Creating segment data pipes", func(contentID int) string {
-		pipeName := fpInfo.GetSegmentPipeFilePath(contentID)
-		pipeName = fmt.Sprintf("%s_%s", pipeName, oid)
-		return fmt.Sprintf("mkfifo %s", pipeName)
+		pipeNames := make([]string, len(oids))
+		for i, oid := range oids {
+			pipeNames[i] = fmt.Sprintf("%s_%s", fpInfo.GetSegmentPipeFilePath(contentID), oid)
+		}
+		return fmt.Sprintf("mkfifo %s", strings.Join(pipeNames, " "))
 	}, cluster.ON_SEGMENTS)
 	c.CheckClusterError(remoteOutput, "Unable to create segment data pipes", func(contentID int) string {
 		return "Unable to create segment data pipe"
 	})
 }
 
+/*
+ * When gpbackup_helper runs multiple jobs for a single-data-file backup or
+ * restore, each with its own chain of pipes, the tables are assigned to the
+ * jobs round-robin in ascending oid order.  Both gpbackup_helper and
+ * gpbackup or gprestore use this assignment, so that each connection copies
+ * its tables in the order that the corresponding helper job opens their pipes.
+ * During backup, each job writes its own data file.
+ */
+func AssignOidsToHelperJobs(oidList []int, numJobs int) [][]int {
+	sortedOids := make([]int, len(oidList))
+	copy(sortedOids, oidList)
+	sort.Ints(sortedOids)
+	if numJobs > len(sortedOids) {
+		numJobs = len(sortedOids)
+	}
+	oidsByJob := make([][]int, numJobs)
+	for i, oid := range sortedOids {
+		oidsByJob[i%numJobs] = append(oidsByJob[i%numJobs], oid)
+	}
+	return oidsByJob
+}
+
 func WriteOidListToSegments(oidList []string, c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
 	localOidFile, err := operating.System.TempFile("", "gpbackup-oids")
 	gplog.FatalOnError(err, "Cannot open temporary file to write oids")
@@ -111,7 +136,7 @@ func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	}
 }
 
-func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool) {
+func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool, jobs int) {
 	gphomePath := operating.System.Getenv("GPHOME")
 	pluginStr := ""
 	if pluginConfigFile != "" {
@@ -122,22 +147,29 @@ func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, oper
 	if onErrorContinue {
 		onErrorContinueStr = " --on-error-continue"
 	}
+	jobsStr := ""
+	if jobs > 1 {
+		jobsStr = fmt.Sprintf(" --jobs %d", jobs)
+	}
+	throttleStr := GetDataThrottle().GetHelperFlags()
+	// The heredoc would expand $$ to the PID of the remote shell instead of that of the script
+	ioNiceStr := strings.Replace(GetDataThrottle().GetIONiceCommand(), "$", `\$`, -1)
 	remoteOutput := c.GenerateAndExecuteCommand("Starting gpbackup_helper agent", func(contentID int) string {
 		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
 		pipeFile := fpInfo.GetSegmentPipeFilePath(contentID)
 		backupFile := fpInfo.GetTableBackupFilePath(contentID, 0, GetPipeThroughProgram().Extension, true)
-		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, onErrorContinueStr)
+		helperCmdStr := fmt.Sprintf("gpbackup_helper %s --toc-file %s --oid-file %s --pipe-file %s --data-file %s --content %d%s%s%s%s%s", operation, tocFile, oidFile, pipeFile, backupFile, contentID, pluginStr, compressStr, onErrorContinueStr, jobsStr, throttleStr)
 		// we run these commands in sequence to ensure that any failure is critical; the last command ensures the agent process was successfully started
 		return fmt.Sprintf(`cat << HEREDOC > %[1]s && chmod +x %[1]s && ( nohup %[1]s &> /dev/null &)
 #!/bin/bash
 source %[2]s/greenplum_path.sh
-%[2]s/bin/%s
+%[4]s%[2]s/bin/%[3]s
 
 HEREDOC
 
-`, scriptFile, gphomePath, helperCmdStr)
+`, scriptFile, gphomePath, helperCmdStr, ioNiceStr)
 	}, cluster.ON_SEGMENTS)
 	c.CheckClusterError(remoteOutput, "Error starting gpbackup_helper agent", func(contentID int) string {
 		return "Error starting gpbackup_helper agent"
@@ -145,11 +177,12 @@ HEREDOC
 }
 
 func CleanUpHelperFilesOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
-	remoteOutput := c.GenerateAndExecuteCommand("Removing oid list and helper script files from segment data directories", func(contentID int) string {
+	remoteOutput := c.GenerateAndExecuteCommand("Removing oid list, helper script, and helper status files from segment data directories", func(contentID int) string {
 		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
-		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile)
+		statusFile := GetHelperStatusFilePath(fpInfo.GetSegmentPipeFilePath(contentID))
+		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s && rm -f %s %s_tmp", errorFile, oidFile, scriptFile, statusFile, statusFile)
 	}, cluster.ON_SEGMENTS)
 	errMsg := fmt.Sprintf("Unable to remove segment helper file(s). See %s for a complete list of segments with errors and remove manually.",
 		gplog.GetLogFilePath())
@@ -121,12 +121,53 @@ var _ = Describe("agent remote", func() {
 			Expect(err).To(Equal(tw.WriteErr))
 		})
 	})
+	Describe("AssignOidsToHelperJobs", func() {
+		It("assigns oids to jobs round-robin in ascending order", func() {
+			Expect(utils.AssignOidsToHelperJobs([]int{5, 1, 4, 2, 3}, 2)).To(Equal([][]int{{1, 3, 5}, {2, 4}}))
+		})
+		It("uses no more jobs than there are oids", func() {
+			Expect(utils.AssignOidsToHelperJobs([]int{2, 1}, 4)).To(Equal([][]int{{1}, {2}}))
+		})
+		It("assigns every oid to one job when there is one job", func() {
+			Expect(utils.AssignOidsToHelperJobs([]int{3, 1, 2}, 1)).To(Equal([][]int{{1, 2, 3}}))
+		})
+		It("does not reorder the given oid list", func() {
+			oids := []int{3, 1, 2}
+			utils.AssignOidsToHelperJobs(oids, 2)
+			Expect(oids).To(Equal([]int{3, 1, 2}))
+		})
+	})
+	Describe("CreateFirstSegmentPipesOnAllHosts", func() {
+		It("creates the first pipe for each data file on each segment", func() {
+			utils.CreateFirstSegmentPipesOnAllHosts([]string{"1", "2"}, testCluster, fpInfo)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0][4]).To(MatchRegexp(`^mkfifo /data/gpseg0/gpbackup_0_11112233445566_pipe_\d+_1 /data/gpseg0/gpbackup_0_11112233445566_pipe_\d+_2$`))
+			Expect(cc[1][4]).To(MatchRegexp(`^mkfifo /data/gpseg1/gpbackup_1_11112233445566_pipe_\d+_1 /data/gpseg1/gpbackup_1_11112233445566_pipe_\d+_2$`))
+		})
+	})
 	Describe("StartGpbackupHelpers()", func() {
 		It("Correctly propagates --on-error-continue flag to gpbackup_helper", func() {
-			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "/tmp/pluginConfigFile.yml", " compressStr", true)
+			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "/tmp/pluginConfigFile.yml", " compressStr", true, 1)
 
 			cc := testExecutor.ClusterCommands[0]
 			Expect(cc[0][4]).To(ContainSubstring(" --on-error-continue"))
+			Expect(cc[0][4]).ToNot(ContainSubstring(" --jobs"))
+		})
+		It("passes the number of jobs to gpbackup_helper when there are several", func() {
+			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "", " compressStr", false, 4)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0][4]).To(ContainSubstring(" --jobs 4"))
+		})
+		It("passes the bandwidth limit to gpbackup_helper and sets the I/O priority of its script", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: 7})
+			defer utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "", " compressStr", false, 1)
+
+			cc := testExecutor.ClusterCommands[0]
+			Expect(cc[0][4]).To(ContainSubstring(" --max-bandwidth 1048576"))
+			Expect(cc[0][4]).To(ContainSubstring(`ionice -c 2 -n 7 -p \$\$ > /dev/null 2>&1; `))
 		})
 	})
 	Describe("CheckAgentErrorsOnSegments", func() {
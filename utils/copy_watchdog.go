@@ -0,0 +1,227 @@
+package utils
+
+/*
+ * This file contains structs and functions related to enforcing time limits
+ * on the COPY commands that back up and restore table data.
+ */
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/pkg/errors"
+)
+
+// How often the overall and inactivity timeouts are checked
+const COPY_WATCHDOG_INTERVAL = time.Second
+
+type watchedCopy struct {
+	connNum   int
+	tableName string
+	cancel    context.CancelFunc
+	timer     *time.Timer
+	reason    error
+}
+
+/*
+ * A CopyWatchdog cancels COPY commands that exceed the per-table timeout,
+ * that are running when the overall timeout for the data backup or restore is
+ * exceeded, or that are running when no data has moved for the inactivity
+ * timeout.  A timeout of zero means no limit.
+ *
+ * A completed COPY always counts as activity.  In single-data-file backups and
+ * restores, the data moved by gpbackup_helper also counts, as reported through
+ * RecordActivity; otherwise, the inactivity timeout must be longer than the
+ * longest time taken to copy a single table.
+ */
+type CopyWatchdog struct {
+	tableTimeout      time.Duration
+	overallTimeout    time.Duration
+	inactivityTimeout time.Duration
+	startTime         time.Time
+	lastActivity      time.Time
+	overallExceeded   bool
+	activeCopies      map[int]*watchedCopy
+	timeoutHandler    func()
+	mutex             sync.Mutex
+	stopChan          chan struct{}
+	waitGroup         sync.WaitGroup
+}
+
+func NewCopyWatchdog(tableTimeout time.Duration, overallTimeout time.Duration, inactivityTimeout time.Duration) *CopyWatchdog {
+	now := time.Now()
+	return &CopyWatchdog{
+		tableTimeout:      tableTimeout,
+		overallTimeout:    overallTimeout,
+		inactivityTimeout: inactivityTimeout,
+		startTime:         now,
+		lastActivity:      now,
+		activeCopies:      make(map[int]*watchedCopy),
+		stopChan:          make(chan struct{}),
+	}
+}
+
+/*
+ * Takes the timeouts in minutes, as given by --copy-timeout, --data-timeout,
+ * and --inactivity-timeout.
+ */
+func NewCopyWatchdogFromMinutes(tableTimeout int, overallTimeout int, inactivityTimeout int) *CopyWatchdog {
+	return NewCopyWatchdog(time.Duration(tableTimeout)*time.Minute, time.Duration(overallTimeout)*time.Minute, time.Duration(inactivityTimeout)*time.Minute)
+}
+
+// A timeout of zero means no limit, so only negative timeouts are rejected
+func ValidateTimeout(flagName string, minutes int) error {
+	if minutes < 0 {
+		return errors.Errorf("--%s must be a non-negative integer", flagName)
+	}
+	return nil
+}
+
+/*
+ * The timeout handler is called whenever a COPY is canceled, such as to stop
+ * the gpbackup_helper agents whose pipes the canceled COPY was using.
+ */
+func (watchdog *CopyWatchdog) SetTimeoutHandler(handler func()) {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	watchdog.timeoutHandler = handler
+}
+
+// The helper chain of a canceled COPY cannot continue, so the helpers are stopped
+func (watchdog *CopyWatchdog) StopHelpersOnTimeout(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string) {
+	watchdog.SetTimeoutHandler(func() {
+		CleanUpSegmentHelperProcesses(c, fpInfo, operation)
+	})
+}
+
+func (watchdog *CopyWatchdog) Start() {
+	if watchdog.overallTimeout == 0 && watchdog.inactivityTimeout == 0 {
+		return
+	}
+	watchdog.mutex.Lock()
+	watchdog.startTime = time.Now()
+	watchdog.lastActivity = watchdog.startTime
+	watchdog.mutex.Unlock()
+	watchdog.waitGroup.Add(1)
+	go func() {
+		defer watchdog.waitGroup.Done()
+		ticker := time.NewTicker(COPY_WATCHDOG_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watchdog.stopChan:
+				return
+			case now := <-ticker.C:
+				watchdog.CheckTimeouts(now)
+			}
+		}
+	}()
+}
+
+func (watchdog *CopyWatchdog) Stop() {
+	close(watchdog.stopChan)
+	watchdog.waitGroup.Wait()
+}
+
+func (watchdog *CopyWatchdog) RecordActivity() {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	watchdog.lastActivity = time.Now()
+}
+
+func (watchdog *CopyWatchdog) OverallTimeoutExceeded() bool {
+	watchdog.mutex.Lock()
+	defer watchdog.mutex.Unlock()
+	return watchdog.overallExceeded
+}
+
+/*
+ * Returns the context with which to run the COPY of the given table, and
+ * a function to call with the result of the COPY once it finishes.  If the
+ * COPY failed because the watchdog canceled it, that function returns an
+ * error giving the reason it was canceled instead of the error from the COPY.
+ */
+func (watchdog *CopyWatchdog) StartCopy(whichConn int, tableName string) (context.Context, func(error) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	watchdog.mutex.Lock()
+	copyInfo := &watchedCopy{connNum: whichConn, tableName: tableName, cancel: cancel}
+	if len(watchdog.activeCopies) == 0 {
+		// Time spent between COPY commands does not count as inactivity
+		watchdog.lastActivity = time.Now()
+	}
+	watchdog.activeCopies[whichConn] = copyInfo
+	if watchdog.overallExceeded {
+		copyInfo.reason = errors.Errorf("COPY of table %s canceled after exceeding the data timeout of %s", tableName, watchdog.overallTimeout)
+		cancel()
+	} else if watchdog.tableTimeout > 0 {
+		copyInfo.timer = time.AfterFunc(watchdog.tableTimeout, func() {
+			watchdog.cancelCopies([]*watchedCopy{copyInfo}, fmt.Sprintf("running for longer than the copy timeout of %s", watchdog.tableTimeout))
+		})
+	}
+	watchdog.mutex.Unlock()
+
+	finishCopy := func(err error) error {
+		watchdog.mutex.Lock()
+		defer watchdog.mutex.Unlock()
+		if copyInfo.timer != nil {
+			copyInfo.timer.Stop()
+		}
+		cancel()
+		delete(watchdog.activeCopies, whichConn)
+		watchdog.lastActivity = time.Now()
+		if err != nil && copyInfo.reason != nil {
+			gplog.Debug("Canceled COPY of table %s returned error: %v", tableName, err)
+			return copyInfo.reason
+		}
+		return err
+	}
+	return ctx, finishCopy
+}
+
+func (watchdog *CopyWatchdog) CheckTimeouts(now time.Time) {
+	watchdog.mutex.Lock()
+	reason := ""
+	if watchdog.overallTimeout > 0 && !watchdog.overallExceeded && now.Sub(watchdog.startTime) >= watchdog.overallTimeout {
+		watchdog.overallExceeded = true
+		reason = fmt.Sprintf("exceeding the data timeout of %s", watchdog.overallTimeout)
+	} else if watchdog.inactivityTimeout > 0 && len(watchdog.activeCopies) > 0 && now.Sub(watchdog.lastActivity) >= watchdog.inactivityTimeout {
+		reason = fmt.Sprintf("no data was moved for the inactivity timeout of %s", watchdog.inactivityTimeout)
+		// Restart the inactivity timeout for any COPY commands that follow
+		watchdog.lastActivity = now
+	}
+	copies := make([]*watchedCopy, 0, len(watchdog.activeCopies))
+	for _, copyInfo := range watchdog.activeCopies {
+		copies = append(copies, copyInfo)
+	}
+	watchdog.mutex.Unlock()
+
+	if reason != "" {
+		watchdog.cancelCopies(copies, reason)
+	}
+}
+
+func (watchdog *CopyWatchdog) cancelCopies(copies []*watchedCopy, reason string) {
+	watchdog.mutex.Lock()
+	numCanceled := 0
+	for _, copyInfo := range copies {
+		// Skip any COPY that has already finished or been canceled
+		if watchdog.activeCopies[copyInfo.connNum] != copyInfo || copyInfo.reason != nil {
+			continue
+		}
+		gplog.Warn("Canceling COPY of table %s after %s", copyInfo.tableName, reason)
+		copyInfo.reason = errors.Errorf("COPY of table %s canceled after %s", copyInfo.tableName, reason)
+		copyInfo.cancel()
+		numCanceled++
+	}
+	handler := watchdog.timeoutHandler
+	watchdog.mutex.Unlock()
+
+	if numCanceled > 0 && handler != nil {
+		handler()
+	}
+}
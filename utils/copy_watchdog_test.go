@@ -0,0 +1,99 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/copy_watchdog tests", func() {
+	copyErr := errors.New("canceling statement due to user request")
+	Describe("ValidateTimeout", func() {
+		It("accepts zero for no limit and positive timeouts", func() {
+			Expect(utils.ValidateTimeout("copy-timeout", 0)).To(Succeed())
+			Expect(utils.ValidateTimeout("copy-timeout", 30)).To(Succeed())
+		})
+		It("rejects negative timeouts", func() {
+			Expect(utils.ValidateTimeout("copy-timeout", -1)).To(MatchError("--copy-timeout must be a non-negative integer"))
+		})
+	})
+	Describe("StartCopy", func() {
+		It("returns the error from a COPY that was not canceled", func() {
+			watchdog := utils.NewCopyWatchdog(time.Hour, 0, 0)
+			ctx, finishCopy := watchdog.StartCopy(0, "public.foo")
+
+			Expect(finishCopy(copyErr)).To(Equal(copyErr))
+			Expect(ctx.Err()).To(HaveOccurred())
+		})
+		It("cancels a COPY that runs for longer than the copy timeout", func() {
+			handlerCalls := make(chan bool, 1)
+			watchdog := utils.NewCopyWatchdog(10*time.Millisecond, 0, 0)
+			watchdog.SetTimeoutHandler(func() { handlerCalls <- true })
+			ctx, finishCopy := watchdog.StartCopy(0, "public.foo")
+
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(finishCopy(copyErr)).To(MatchError("COPY of table public.foo canceled after running for longer than the copy timeout of 10ms"))
+			Eventually(handlerCalls).Should(Receive())
+			Expect(logfile).To(Say("Canceling COPY of table public.foo after running for longer than the copy timeout of 10ms"))
+		})
+		It("does not report a COPY that succeeded as it was canceled", func() {
+			watchdog := utils.NewCopyWatchdog(10*time.Millisecond, 0, 0)
+			ctx, finishCopy := watchdog.StartCopy(0, "public.foo")
+
+			Eventually(ctx.Done()).Should(BeClosed())
+			Expect(finishCopy(nil)).To(Succeed())
+		})
+	})
+	Describe("CheckTimeouts", func() {
+		It("cancels all COPY commands once the data timeout is exceeded", func() {
+			watchdog := utils.NewCopyWatchdog(0, time.Minute, 0)
+			ctx0, finishCopy0 := watchdog.StartCopy(0, "public.foo")
+			ctx1, finishCopy1 := watchdog.StartCopy(1, "public.bar")
+
+			watchdog.CheckTimeouts(time.Now().Add(time.Minute))
+
+			Expect(ctx0.Err()).To(HaveOccurred())
+			Expect(ctx1.Err()).To(HaveOccurred())
+			Expect(finishCopy0(copyErr)).To(MatchError("COPY of table public.foo canceled after exceeding the data timeout of 1m0s"))
+			Expect(finishCopy1(copyErr)).To(MatchError("COPY of table public.bar canceled after exceeding the data timeout of 1m0s"))
+			Expect(watchdog.OverallTimeoutExceeded()).To(BeTrue())
+
+			ctx2, finishCopy2 := watchdog.StartCopy(0, "public.baz")
+			Expect(ctx2.Err()).To(HaveOccurred())
+			Expect(finishCopy2(copyErr)).To(MatchError("COPY of table public.baz canceled after exceeding the data timeout of 1m0s"))
+		})
+		It("cancels the COPY commands in progress when no data has moved for the inactivity timeout", func() {
+			watchdog := utils.NewCopyWatchdog(0, 0, time.Minute)
+			ctx, finishCopy := watchdog.StartCopy(0, "public.foo")
+
+			watchdog.CheckTimeouts(time.Now().Add(30 * time.Second))
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+
+			watchdog.CheckTimeouts(time.Now().Add(time.Minute))
+			Expect(ctx.Err()).To(HaveOccurred())
+			Expect(finishCopy(copyErr)).To(MatchError("COPY of table public.foo canceled after no data was moved for the inactivity timeout of 1m0s"))
+		})
+		It("restarts the inactivity timeout when activity is recorded", func() {
+			watchdog := utils.NewCopyWatchdog(0, 0, time.Minute)
+			ctx, _ := watchdog.StartCopy(0, "public.foo")
+			watchdog.RecordActivity()
+
+			watchdog.CheckTimeouts(time.Now().Add(59 * time.Second))
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+		})
+		It("does not count time between COPY commands as inactivity", func() {
+			watchdog := utils.NewCopyWatchdog(0, 0, time.Minute)
+
+			watchdog.CheckTimeouts(time.Now().Add(time.Hour))
+			ctx, _ := watchdog.StartCopy(0, "public.foo")
+			watchdog.CheckTimeouts(time.Now().Add(30 * time.Second))
+
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,232 @@
+package utils
+
+/*
+ * This file contains structs and functions related to the status files that
+ * gpbackup_helper agents write while backing up or restoring a single data
+ * file, which gpbackup and gprestore poll to report the progress of each
+ * segment and to detect segments that have stalled.
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"gopkg.in/cheggaaa/pb.v1"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// How often gpbackup_helper writes its status file
+	HELPER_STATUS_WRITE_INTERVAL = 2 * time.Second
+	// How often gpbackup and gprestore read the status files on the segments
+	HELPER_STATUS_POLL_INTERVAL = 10 * time.Second
+	// How long a segment may go without progress before it is reported as stalled
+	HELPER_STALL_TIMEOUT = 5 * time.Minute
+)
+
+type HelperStatus struct {
+	CurrentOids     []int  `yaml:"currentoids"`
+	TablesCompleted int    `yaml:"tablescompleted"`
+	TotalTables     int    `yaml:"totaltables"`
+	BytesProcessed  uint64 `yaml:"bytesprocessed"`
+	BytesPerSecond  uint64 `yaml:"bytespersecond"`
+	UpdateTime      int64  `yaml:"updatetime"`
+}
+
+func GetHelperStatusFilePath(pipeFile string) string {
+	return fmt.Sprintf("%s_status", pipeFile)
+}
+
+/*
+ * The status file is written to a temporary file and renamed, so that it is
+ * never read while partially written.
+ */
+func WriteHelperStatusFile(filename string, status HelperStatus) error {
+	statusBytes, err := yaml.Marshal(status)
+	if err != nil {
+		return err
+	}
+	tempFilename := fmt.Sprintf("%s_tmp", filename)
+	err = ioutil.WriteFile(tempFilename, statusBytes, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tempFilename, filename)
+}
+
+/*
+ * Segments whose helper has not yet written a status file, or whose status
+ * file could not be read, are left out of the returned map.  Polling is done
+ * without logging the command, as it runs throughout the data phase.
+ */
+func ReadHelperStatusesOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]HelperStatus {
+	commandMap := c.GenerateSSHCommandMapForSegments(false, func(contentID int) string {
+		statusFile := GetHelperStatusFilePath(fpInfo.GetSegmentPipeFilePath(contentID))
+		return fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi", statusFile)
+	})
+	remoteOutput := c.ExecuteClusterCommand(cluster.ON_SEGMENTS, commandMap)
+
+	statuses := make(map[int]HelperStatus)
+	for contentID, stdout := range remoteOutput.Stdouts {
+		if remoteOutput.Errors[contentID] != nil || strings.TrimSpace(stdout) == "" {
+			continue
+		}
+		var status HelperStatus
+		err := yaml.Unmarshal([]byte(stdout), &status)
+		if err != nil {
+			gplog.Debug("Could not parse gpbackup_helper status on segment %d: %v", contentID, err)
+			continue
+		}
+		statuses[contentID] = status
+	}
+	return statuses
+}
+
+func FormatHelperThroughput(statuses map[int]HelperStatus) string {
+	var totalBytesPerSecond uint64
+	for _, status := range statuses {
+		totalBytesPerSecond += status.BytesPerSecond
+	}
+	return fmt.Sprintf("%s/s", pb.Format(int64(totalBytesPerSecond)).To(pb.U_BYTES).String())
+}
+
+type segmentActivity struct {
+	status       HelperStatus
+	lastUpdate   time.Time
+	lastProgress time.Time
+	stalled      bool
+}
+
+/*
+ * A HelperStatusMonitor polls the gpbackup_helper status files during a
+ * single-data-file backup or restore.  The total throughput is shown in the
+ * progress bar, the progress of each segment is logged in verbose mode, and a
+ * warning is logged for each segment that stalls.  If onProgress is not nil,
+ * it is called whenever any segment has processed more data.  Times are
+ * measured on the coordinator, as the clocks on the segment hosts may differ
+ * from its clock.
+ */
+type HelperStatusMonitor struct {
+	cluster     *cluster.Cluster
+	fpInfo      filepath.FilePathInfo
+	progressBar ProgressBar
+	onProgress  func()
+	segments    map[int]*segmentActivity
+	stopChan    chan struct{}
+	waitGroup   sync.WaitGroup
+}
+
+func NewHelperStatusMonitor(c *cluster.Cluster, fpInfo filepath.FilePathInfo, progressBar ProgressBar, onProgress func()) *HelperStatusMonitor {
+	return &HelperStatusMonitor{
+		cluster:     c,
+		fpInfo:      fpInfo,
+		progressBar: progressBar,
+		onProgress:  onProgress,
+		segments:    make(map[int]*segmentActivity),
+		stopChan:    make(chan struct{}),
+	}
+}
+
+func (monitor *HelperStatusMonitor) Start() {
+	monitor.waitGroup.Add(1)
+	go func() {
+		defer monitor.waitGroup.Done()
+		ticker := time.NewTicker(HELPER_STATUS_POLL_INTERVAL)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-monitor.stopChan:
+				return
+			case <-ticker.C:
+				monitor.RecordStatuses(ReadHelperStatusesOnSegments(monitor.cluster, monitor.fpInfo), time.Now())
+			}
+		}
+	}()
+}
+
+func (monitor *HelperStatusMonitor) Stop() {
+	close(monitor.stopChan)
+	monitor.waitGroup.Wait()
+	monitor.progressBar.Postfix("")
+}
+
+/*
+ * A segment is stalled if its helper has not updated its status file within
+ * the stall timeout, which means that the helper is hung or has died, or if it
+ * has processed no data within the timeout while other segments have.  Each
+ * stall is only reported once, and is reported again if the segment resumes
+ * and stalls again.  Returns the content IDs of newly stalled segments.
+ */
+func (monitor *HelperStatusMonitor) RecordStatuses(statuses map[int]HelperStatus, now time.Time) []int {
+	anyProgress := false
+	progressed := false
+	for contentID, status := range statuses {
+		activity, ok := monitor.segments[contentID]
+		if !ok {
+			activity = &segmentActivity{lastUpdate: now, lastProgress: now}
+			monitor.segments[contentID] = activity
+		}
+		if status.UpdateTime != activity.status.UpdateTime {
+			activity.lastUpdate = now
+		}
+		if status.BytesProcessed != activity.status.BytesProcessed || status.TablesCompleted != activity.status.TablesCompleted {
+			activity.lastProgress = now
+			progressed = true
+			if activity.stalled {
+				gplog.Info("Segment %d on host %s has resumed processing data", contentID, monitor.cluster.GetHostForContent(contentID))
+				activity.stalled = false
+			}
+		}
+		activity.status = status
+		if now.Sub(activity.lastProgress) < HELPER_STALL_TIMEOUT {
+			anyProgress = true
+		}
+	}
+
+	newlyStalled := make([]int, 0)
+	contentIDs := make([]int, 0, len(monitor.segments))
+	for contentID := range monitor.segments {
+		contentIDs = append(contentIDs, contentID)
+	}
+	sort.Ints(contentIDs)
+	for _, contentID := range contentIDs {
+		activity := monitor.segments[contentID]
+		status := activity.status
+		if gplog.GetVerbosity() >= gplog.LOGVERBOSE {
+			gplog.Verbose("Segment %d: %d of %d tables complete, %s processed (%s/s), current table oid(s): %v", contentID,
+				status.TablesCompleted, status.TotalTables, pb.Format(int64(status.BytesProcessed)).To(pb.U_BYTES).String(),
+				pb.Format(int64(status.BytesPerSecond)).To(pb.U_BYTES).String(), status.CurrentOids)
+		}
+		if activity.stalled || status.TablesCompleted == status.TotalTables {
+			continue
+		}
+		hostname := monitor.cluster.GetHostForContent(contentID)
+		if now.Sub(activity.lastUpdate) >= HELPER_STALL_TIMEOUT {
+			gplog.Warn("gpbackup_helper on segment %d on host %s has not reported its status in %s; it may be hung or have exited",
+				contentID, hostname, now.Sub(activity.lastUpdate).Round(time.Second))
+		} else if now.Sub(activity.lastProgress) >= HELPER_STALL_TIMEOUT && anyProgress {
+			gplog.Warn("Segment %d on host %s has processed no data in %s while other segments have; it may be stalled",
+				contentID, hostname, now.Sub(activity.lastProgress).Round(time.Second))
+		} else {
+			continue
+		}
+		activity.stalled = true
+		newlyStalled = append(newlyStalled, contentID)
+	}
+
+	if progressed && monitor.onProgress != nil {
+		monitor.onProgress()
+	}
+	if len(statuses) > 0 {
+		monitor.progressBar.Postfix(fmt.Sprintf(" %s", FormatHelperThroughput(statuses)))
+	}
+	return newlyStalled
+}
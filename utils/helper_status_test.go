@@ -0,0 +1,156 @@
+package utils_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/helper_status tests", func() {
+	var (
+		fpInfo       filepath.FilePathInfo
+		testCluster  *cluster.Cluster
+		testExecutor *testhelper.TestExecutor
+	)
+	BeforeEach(func() {
+		masterSeg := cluster.SegConfig{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"}
+		localSegOne := cluster.SegConfig{ContentID: 0, Hostname: "localhost", DataDir: "/data/gpseg0"}
+		remoteSegOne := cluster.SegConfig{ContentID: 1, Hostname: "remotehost1", DataDir: "/data/gpseg1"}
+
+		testExecutor = &testhelper.TestExecutor{ClusterOutput: &cluster.RemoteOutput{}}
+		testCluster = cluster.NewCluster([]cluster.SegConfig{masterSeg, localSegOne, remoteSegOne})
+		testCluster.Executor = testExecutor
+
+		fpInfo = filepath.NewFilePathInfo(testCluster, "", "11112233445566", "")
+	})
+	Describe("WriteHelperStatusFile", func() {
+		It("writes the status as yaml without leaving a temporary file", func() {
+			tempDir, _ := ioutil.TempDir("", "helper_status_test")
+			defer os.RemoveAll(tempDir)
+			statusFile := path.Join(tempDir, "gpbackup_0_11112233445566_pipe_1234_status")
+
+			err := utils.WriteHelperStatusFile(statusFile, utils.HelperStatus{CurrentOids: []int{16384}, TablesCompleted: 1, TotalTables: 3, BytesProcessed: 1024, BytesPerSecond: 512, UpdateTime: 1577836800})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(ioutil.ReadFile(statusFile)).To(Equal([]byte(`currentoids:
+- 16384
+tablescompleted: 1
+totaltables: 3
+bytesprocessed: 1024
+bytespersecond: 512
+updatetime: 1577836800
+`)))
+			Expect(path.Glob(path.Join(tempDir, "*_tmp"))).To(BeEmpty())
+		})
+	})
+	Describe("ReadHelperStatusesOnSegments", func() {
+		It("reads the status file on each segment", func() {
+			utils.ReadHelperStatusesOnSegments(testCluster, fpInfo)
+
+			Expect(testExecutor.NumExecutions).To(Equal(1))
+			cc := testExecutor.ClusterCommands[0]
+			statusFile0 := fmt.Sprintf("/data/gpseg0/gpbackup_0_11112233445566_pipe_%d_status", fpInfo.PID)
+			Expect(cc[0][4]).To(Equal(fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi", statusFile0)))
+			statusFile1 := fmt.Sprintf("/data/gpseg1/gpbackup_1_11112233445566_pipe_%d_status", fpInfo.PID)
+			Expect(cc[1][4]).To(Equal(fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi", statusFile1)))
+		})
+		It("skips segments without a readable status", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{0: "tablescompleted: 2\nbytesprocessed: 100\n", 1: "", 2: "not: [valid"},
+				Errors:  map[int]error{},
+			}
+
+			statuses := utils.ReadHelperStatusesOnSegments(testCluster, fpInfo)
+
+			Expect(statuses).To(Equal(map[int]utils.HelperStatus{0: {TablesCompleted: 2, BytesProcessed: 100}}))
+		})
+		It("parses the status files written by WriteHelperStatusFile", func() {
+			tempDir, _ := ioutil.TempDir("", "helper_status_test")
+			defer os.RemoveAll(tempDir)
+			statuses := map[int]utils.HelperStatus{
+				0: {CurrentOids: []int{16384, 16390}, TablesCompleted: 1, TotalTables: 3, BytesProcessed: 1024, BytesPerSecond: 512, UpdateTime: 1577836800},
+				1: {CurrentOids: []int{}, TablesCompleted: 3, TotalTables: 3, BytesProcessed: 4096, UpdateTime: 1577836802},
+			}
+			stdouts := make(map[int]string)
+			for contentID, status := range statuses {
+				statusFile := path.Join(tempDir, fmt.Sprintf("gpbackup_%d_11112233445566_pipe_1234_status", contentID))
+				Expect(utils.WriteHelperStatusFile(statusFile, status)).To(Succeed())
+				contents, err := ioutil.ReadFile(statusFile)
+				Expect(err).ToNot(HaveOccurred())
+				stdouts[contentID] = string(contents)
+			}
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{Stdouts: stdouts, Errors: map[int]error{}}
+
+			Expect(utils.ReadHelperStatusesOnSegments(testCluster, fpInfo)).To(Equal(statuses))
+		})
+	})
+	Describe("FormatHelperThroughput", func() {
+		It("formats the total throughput of all segments", func() {
+			statuses := map[int]utils.HelperStatus{0: {BytesPerSecond: 1024 * 1024}, 1: {BytesPerSecond: 1024 * 1024}}
+			Expect(utils.FormatHelperThroughput(statuses)).To(Equal("2.00 MiB/s"))
+		})
+	})
+	Describe("HelperStatusMonitor", func() {
+		var (
+			monitor *utils.HelperStatusMonitor
+			start   time.Time
+		)
+		BeforeEach(func() {
+			monitor = utils.NewHelperStatusMonitor(testCluster, fpInfo, utils.NewProgressBar(3, "Tables backed up: ", utils.PB_NONE), nil)
+			start = time.Unix(1577836800, 0)
+			monitor.RecordStatuses(map[int]utils.HelperStatus{
+				0: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 1},
+				1: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 1},
+			}, start)
+		})
+		It("reports a segment that processes no data while other segments do", func() {
+			stalled := monitor.RecordStatuses(map[int]utils.HelperStatus{
+				0: {TotalTables: 3, BytesProcessed: 200, UpdateTime: 2},
+				1: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 2},
+			}, start.Add(utils.HELPER_STALL_TIMEOUT))
+
+			Expect(stalled).To(Equal([]int{1}))
+			Expect(logfile).To(Say("Segment 1 on host remotehost1 has processed no data in 5m0s while other segments have; it may be stalled"))
+		})
+		It("reports a segment whose helper stops updating its status", func() {
+			stalled := monitor.RecordStatuses(map[int]utils.HelperStatus{
+				0: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 1},
+				1: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 2},
+			}, start.Add(utils.HELPER_STALL_TIMEOUT))
+
+			Expect(stalled).To(Equal([]int{0}))
+			Expect(logfile).To(Say("gpbackup_helper on segment 0 on host localhost has not reported its status in 5m0s"))
+		})
+		It("does not report segments when no segment is processing data", func() {
+			stalled := monitor.RecordStatuses(map[int]utils.HelperStatus{
+				0: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 2},
+				1: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 2},
+			}, start.Add(utils.HELPER_STALL_TIMEOUT))
+
+			Expect(stalled).To(BeEmpty())
+		})
+		It("reports a stall once until the segment resumes", func() {
+			statuses := map[int]utils.HelperStatus{
+				0: {TotalTables: 3, BytesProcessed: 200, UpdateTime: 2},
+				1: {TotalTables: 3, BytesProcessed: 100, UpdateTime: 2},
+			}
+			Expect(monitor.RecordStatuses(statuses, start.Add(utils.HELPER_STALL_TIMEOUT))).To(Equal([]int{1}))
+			Expect(monitor.RecordStatuses(statuses, start.Add(utils.HELPER_STALL_TIMEOUT+time.Minute))).To(BeEmpty())
+
+			statuses[1] = utils.HelperStatus{TotalTables: 3, BytesProcessed: 300, UpdateTime: 3}
+			Expect(monitor.RecordStatuses(statuses, start.Add(utils.HELPER_STALL_TIMEOUT+2*time.Minute))).To(BeEmpty())
+			Expect(logfile).To(Say("Segment 1 on host remotehost1 has resumed processing data"))
+		})
+	})
+})
@@ -0,0 +1,184 @@
+package utils
+
+/*
+ * This file contains structs and functions related to running user-configured
+ * hooks (executables or SQL files) at fixed points during a backup or restore.
+ */
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	HOOK_BEFORE_SETUP    = "before_setup"
+	HOOK_AFTER_SETUP     = "after_setup"
+	HOOK_BEFORE_PREDATA  = "before_predata"
+	HOOK_AFTER_PREDATA   = "after_predata"
+	HOOK_BEFORE_DATA     = "before_data"
+	HOOK_AFTER_DATA      = "after_data"
+	HOOK_BEFORE_POSTDATA = "before_postdata"
+	HOOK_AFTER_POSTDATA  = "after_postdata"
+	HOOK_ON_FAILURE      = "on_failure"
+)
+
+var validHookPoints = []string{HOOK_BEFORE_SETUP, HOOK_AFTER_SETUP, HOOK_BEFORE_PREDATA, HOOK_AFTER_PREDATA,
+	HOOK_BEFORE_DATA, HOOK_AFTER_DATA, HOOK_BEFORE_POSTDATA, HOOK_AFTER_POSTDATA, HOOK_ON_FAILURE}
+
+type HookConfig struct {
+	Hooks map[string][]Hook `yaml:"hooks"`
+}
+
+type Hook struct {
+	Executable string `yaml:"executable"`
+	SQLFile    string `yaml:"sql_file"`
+	Fatal      bool   `yaml:"fatal"`
+}
+
+/*
+ * Information about the current backup or restore that is passed to hooks
+ * through environment variables.
+ */
+type HookEnvironment struct {
+	Utility   string
+	Timestamp string
+	DBName    string
+}
+
+func ReadHookConfig(configFile string) (*HookConfig, error) {
+	gplog.Info("Reading Hook Config %s", configFile)
+	config := &HookConfig{}
+	contents, err := operating.System.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(contents, config)
+	if err != nil {
+		return nil, err
+	}
+	for hookPoint, hooks := range config.Hooks {
+		if !Exists(validHookPoints, hookPoint) {
+			return nil, errors.Errorf("Invalid hook point %s in hook config file; valid hook points are %s", hookPoint, strings.Join(validHookPoints, ", "))
+		}
+		for i, hook := range hooks {
+			if (hook.Executable == "") == (hook.SQLFile == "") {
+				return nil, errors.Errorf("Each hook in %s must specify exactly one of executable or sql_file", hookPoint)
+			}
+			if hook.SQLFile != "" && hookPoint == HOOK_BEFORE_SETUP {
+				return nil, errors.Errorf("SQL file hooks cannot be used in %s, as the database is not yet known", hookPoint)
+			}
+			hooks[i].Executable = os.ExpandEnv(hook.Executable)
+			hooks[i].SQLFile = os.ExpandEnv(hook.SQLFile)
+			err = ValidateFullPath(hooks[i].Executable)
+			if err != nil {
+				return nil, err
+			}
+			err = ValidateFullPath(hooks[i].SQLFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return config, nil
+}
+
+/*
+ * Runs every hook configured for hookPoint in order.  A failing hook is fatal
+ * only if it is marked as such, and never during on_failure hooks, since those
+ * run while the utility is already exiting.
+ */
+func (config *HookConfig) RunHooks(hookPoint string, env HookEnvironment) {
+	if config == nil || len(config.Hooks[hookPoint]) == 0 {
+		return
+	}
+	gplog.Verbose("Running %s hooks", hookPoint)
+	var conn *dbconn.DBConn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	for _, hook := range config.Hooks[hookPoint] {
+		var err error
+		if hook.SQLFile != "" && conn == nil {
+			/*
+			 * SQL hooks use their own connection so that they cannot affect
+			 * the transactions used by the backup or restore itself.
+			 */
+			conn = dbconn.NewDBConnFromEnvironment(env.DBName)
+			err = conn.Connect(1)
+			if err != nil {
+				conn = nil
+			}
+		}
+		if err == nil {
+			err = hook.Run(hookPoint, env, conn)
+		}
+		if err != nil {
+			if hook.Fatal && hookPoint != HOOK_ON_FAILURE {
+				gplog.Fatal(err, "")
+			}
+			gplog.Warn("%v", err)
+		}
+	}
+}
+
+func (hook Hook) Run(hookPoint string, env HookEnvironment, conn *dbconn.DBConn) error {
+	if hook.SQLFile != "" {
+		gplog.Verbose("Executing %s hook SQL file %s", hookPoint, hook.SQLFile)
+		contents, err := operating.System.ReadFile(hook.SQLFile)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read %s hook SQL file %s", hookPoint, hook.SQLFile)
+		}
+		_, err = conn.Exec(string(contents))
+		if err != nil {
+			return errors.Wrapf(err, "Error executing %s hook SQL file %s", hookPoint, hook.SQLFile)
+		}
+		return nil
+	}
+
+	gplog.Verbose("Executing %s hook %s", hookPoint, hook.Executable)
+	cmd := exec.Command(hook.Executable)
+	cmd.Env = append(os.Environ(), env.Variables(hookPoint)...)
+	output, err := cmd.CombinedOutput()
+	if len(output) > 0 {
+		gplog.Verbose("Output of %s hook %s: %s", hookPoint, hook.Executable, strings.TrimSpace(string(output)))
+	}
+	if err != nil {
+		return errors.Errorf("Hook %s failed during %s: %v. %s", hook.Executable, hookPoint, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (env HookEnvironment) Variables(hookPoint string) []string {
+	return []string{
+		fmt.Sprintf("GPBACKUP_UTILITY=%s", env.Utility),
+		fmt.Sprintf("GPBACKUP_HOOK=%s", hookPoint),
+		fmt.Sprintf("GPBACKUP_TIMESTAMP=%s", env.Timestamp),
+		fmt.Sprintf("GPBACKUP_DBNAME=%s", env.DBName),
+		fmt.Sprintf("GPBACKUP_EXIT_STATUS=%s", GetExitStatus()),
+	}
+}
+
+/*
+ * Translates the current gplog error code into the exit status names used in
+ * the email contacts file.
+ */
+func GetExitStatus() string {
+	switch gplog.GetErrorCode() {
+	case 1:
+		return "success_with_errors"
+	case 2:
+		return "failure"
+	default:
+		return "success"
+	}
+}
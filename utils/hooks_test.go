@@ -0,0 +1,127 @@
+package utils_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/hooks tests", func() {
+	var tempDir string
+	env := utils.HookEnvironment{Utility: "gpbackup", Timestamp: "20170101010101", DBName: "testdb"}
+
+	BeforeEach(func() {
+		operating.System = operating.InitializeSystemFunctions()
+		tempDir, _ = ioutil.TempDir("", "temp")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+		gplog.SetErrorCode(0)
+	})
+	writeFile := func(name string, contents string, mode os.FileMode) string {
+		filename := filepath.Join(tempDir, name)
+		err := ioutil.WriteFile(filename, []byte(contents), mode)
+		Expect(err).ToNot(HaveOccurred())
+		return filename
+	}
+	Describe("ReadHookConfig", func() {
+		It("reads executable and SQL file hooks", func() {
+			configFile := writeFile("hooks.yaml", `hooks:
+  before_setup:
+  - executable: /bin/true
+    fatal: true
+  after_data:
+  - sql_file: /tmp/after_data.sql
+  - executable: /bin/echo
+`, 0644)
+			config, err := utils.ReadHookConfig(configFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.Hooks[utils.HOOK_BEFORE_SETUP]).To(Equal([]utils.Hook{{Executable: "/bin/true", Fatal: true}}))
+			Expect(config.Hooks[utils.HOOK_AFTER_DATA]).To(Equal([]utils.Hook{{SQLFile: "/tmp/after_data.sql"}, {Executable: "/bin/echo"}}))
+		})
+		It("returns an error for an invalid hook point", func() {
+			configFile := writeFile("hooks.yaml", "hooks:\n  before_lunch:\n  - executable: /bin/true\n", 0644)
+			_, err := utils.ReadHookConfig(configFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("Invalid hook point before_lunch"))
+		})
+		It("returns an error if a hook specifies both an executable and a SQL file", func() {
+			configFile := writeFile("hooks.yaml", "hooks:\n  after_setup:\n  - executable: /bin/true\n    sql_file: /tmp/a.sql\n", 0644)
+			_, err := utils.ReadHookConfig(configFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("Each hook in after_setup must specify exactly one of executable or sql_file"))
+		})
+		It("returns an error for a SQL file hook before setup", func() {
+			configFile := writeFile("hooks.yaml", "hooks:\n  before_setup:\n  - sql_file: /tmp/a.sql\n", 0644)
+			_, err := utils.ReadHookConfig(configFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("SQL file hooks cannot be used in before_setup"))
+		})
+		It("returns an error for a relative executable path", func() {
+			configFile := writeFile("hooks.yaml", "hooks:\n  after_setup:\n  - executable: bin/hook.sh\n", 0644)
+			_, err := utils.ReadHookConfig(configFile)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(Equal("bin/hook.sh is not an absolute path."))
+		})
+	})
+	Describe("Hook.Run", func() {
+		It("passes backup information to an executable through environment variables", func() {
+			outputFile := filepath.Join(tempDir, "env_output")
+			script := writeFile("hook.sh", "#!/bin/bash\necho \"$GPBACKUP_UTILITY $GPBACKUP_HOOK $GPBACKUP_TIMESTAMP $GPBACKUP_DBNAME $GPBACKUP_EXIT_STATUS\" > "+outputFile+"\n", 0755)
+			gplog.SetErrorCode(1)
+
+			err := utils.Hook{Executable: script}.Run(utils.HOOK_AFTER_DATA, env, nil)
+
+			Expect(err).ToNot(HaveOccurred())
+			contents, _ := ioutil.ReadFile(outputFile)
+			Expect(strings.TrimSpace(string(contents))).To(Equal("gpbackup after_data 20170101010101 testdb success_with_errors"))
+		})
+		It("returns an error containing the output of a failing executable", func() {
+			script := writeFile("hook.sh", "#!/bin/bash\necho 'could not pause ETL'\nexit 3\n", 0755)
+
+			err := utils.Hook{Executable: script}.Run(utils.HOOK_BEFORE_DATA, env, nil)
+
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("failed during before_data: exit status 3. could not pause ETL"))
+		})
+		It("executes the contents of a SQL file", func() {
+			sqlFile := writeFile("hook.sql", "SELECT pg_catalog.pg_sleep(0);", 0644)
+			mock.ExpectExec("SELECT pg_catalog.pg_sleep\\(0\\);").WillReturnResult(sqlmock.NewResult(0, 0))
+
+			err := utils.Hook{SQLFile: sqlFile}.Run(utils.HOOK_AFTER_SETUP, env, connectionPool)
+
+			Expect(err).ToNot(HaveOccurred())
+		})
+	})
+	Describe("RunHooks", func() {
+		It("does nothing if there is no hook config", func() {
+			var config *utils.HookConfig
+			config.RunHooks(utils.HOOK_BEFORE_SETUP, env)
+		})
+		It("logs a warning if a non-fatal hook fails", func() {
+			config := utils.HookConfig{Hooks: map[string][]utils.Hook{utils.HOOK_AFTER_SETUP: {{Executable: "/bin/false"}}}}
+			config.RunHooks(utils.HOOK_AFTER_SETUP, env)
+			Expect(string(logfile.Contents())).To(ContainSubstring("[WARNING]:-Hook /bin/false failed during after_setup"))
+		})
+		It("panics if a fatal hook fails", func() {
+			config := utils.HookConfig{Hooks: map[string][]utils.Hook{utils.HOOK_AFTER_SETUP: {{Executable: "/bin/false", Fatal: true}}}}
+			defer testhelper.ShouldPanicWithMessage("Hook /bin/false failed during after_setup")
+			config.RunHooks(utils.HOOK_AFTER_SETUP, env)
+		})
+		It("does not panic if a fatal hook fails during on_failure", func() {
+			config := utils.HookConfig{Hooks: map[string][]utils.Hook{utils.HOOK_ON_FAILURE: {{Executable: "/bin/false", Fatal: true}}}}
+			config.RunHooks(utils.HOOK_ON_FAILURE, env)
+			Expect(string(logfile.Contents())).To(ContainSubstring("[WARNING]:-Hook /bin/false failed during on_failure"))
+		})
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/exec"
 	path "path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -14,15 +15,20 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/storage"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 )
 
 const RequiredPluginVersion = "0.3.0"
+const DeleteBackupPluginVersion = "0.4.0"
+const ListBackupsPluginVersion = "0.5.0"
+const RestoreDataRangePluginVersion = "0.6.0"
 const SecretKeyFile = ".encrypt"
 
 type PluginConfig struct {
-	ExecutablePath      string            `yaml:"executablepath"`
+	ExecutablePath      string            `yaml:"executablepath,omitempty"`
+	Backend             string            `yaml:"backend,omitempty"`
 	ConfigPath          string            `yaml:"-"`
 	Options             map[string]string `yaml:"options"`
 	backupPluginVersion string            `yaml:"-"`
@@ -47,27 +53,76 @@ func ReadPluginConfig(configFile string) (*PluginConfig, error) {
 	if err != nil {
 		return nil, err
 	}
-	if config.ExecutablePath == "" {
-		return nil, errors.New("executablepath is required in config file")
-	}
-	config.ExecutablePath = os.ExpandEnv(config.ExecutablePath)
-	err = ValidateFullPath(config.ExecutablePath)
-	if err != nil {
-		return nil, err
+	if config.Backend != "" {
+		if config.ExecutablePath != "" {
+			return nil, errors.New("executablepath and backend cannot both be specified in config file")
+		}
+		if config.Options == nil {
+			config.Options = make(map[string]string)
+		}
+		_, err = storage.NewStorageBackend(config.Backend, config.Options)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if config.ExecutablePath == "" {
+			return nil, errors.New("executablepath is required in config file")
+		}
+		config.ExecutablePath = os.ExpandEnv(config.ExecutablePath)
+		err = ValidateFullPath(config.ExecutablePath)
+		if err != nil {
+			return nil, err
+		}
 	}
 	configFilename := path.Base(configFile)
 	config.ConfigPath = path.Join("/tmp", configFilename)
 	return config, nil
 }
 
+/*
+ * Configs with a backend use one of the built-in storage backends, which run
+ * within gpbackup and gpbackup_helper, instead of a plugin executable.
+ */
+func (plugin *PluginConfig) UsesStorageBackend() bool {
+	return plugin.Backend != ""
+}
+
+func (plugin *PluginConfig) GetStorageBackend() (storage.StorageBackend, error) {
+	return storage.NewStorageBackend(plugin.Backend, plugin.Options)
+}
+
+/*
+ * Returns the command that performs the given plugin operation on a segment
+ * host, to which the name of the file to process is appended.  Storage
+ * backends have no executable of their own, so their data is streamed
+ * through gpbackup_helper.
+ */
+func (plugin *PluginConfig) GetPluginCommand(command string) string {
+	if plugin.UsesStorageBackend() {
+		return fmt.Sprintf("%s/bin/gpbackup_helper --plugin-config %s --storage-command %s --data-file",
+			operating.System.Getenv("GPHOME"), plugin.ConfigPath, command)
+	}
+	return fmt.Sprintf("%s %s %s", plugin.ExecutablePath, command, plugin.ConfigPath)
+}
+
 func (plugin *PluginConfig) BackupFile(filenamePath string) error {
-	command := fmt.Sprintf("%s backup_file %s %s", plugin.ExecutablePath, plugin.ConfigPath, filenamePath)
-	gplog.Debug("%s", command)
-	output, err := exec.Command("bash", "-c", command).CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Plugin failed to process %s. %s", filenamePath, string(output))
+	if plugin.UsesStorageBackend() {
+		backend, err := plugin.GetStorageBackend()
+		if err == nil {
+			err = storage.PutFile(backend, filenamePath)
+		}
+		if err != nil {
+			return fmt.Errorf("Storage backend %s failed to process %s. %v", plugin.Backend, filenamePath, err)
+		}
+	} else {
+		command := fmt.Sprintf("%s %s", plugin.GetPluginCommand("backup_file"), filenamePath)
+		gplog.Debug("%s", command)
+		output, err := exec.Command("bash", "-c", command).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("Plugin failed to process %s. %s", filenamePath, string(output))
+		}
 	}
-	err = operating.System.Chmod(filenamePath, 0755)
+	err := operating.System.Chmod(filenamePath, 0755)
 	return err
 }
 
@@ -80,19 +135,36 @@ func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
 	directory, _ := path.Split(filenamePath)
 	err := operating.System.MkdirAll(directory, 0755)
 	gplog.FatalOnError(err)
-	command := fmt.Sprintf("%s restore_file %s %s", plugin.ExecutablePath, plugin.ConfigPath, filenamePath)
+	if plugin.UsesStorageBackend() {
+		backend, err := plugin.GetStorageBackend()
+		if err == nil {
+			err = storage.GetFile(backend, filenamePath)
+		}
+		gplog.FatalOnError(err, fmt.Sprintf("Storage backend %s failed to process %s", plugin.Backend, filenamePath))
+		return
+	}
+	command := fmt.Sprintf("%s %s", plugin.GetPluginCommand("restore_file"), filenamePath)
 	gplog.Debug("%s", command)
 	output, err := exec.Command("bash", "-c", command).CombinedOutput()
 	gplog.FatalOnError(err, string(output))
 }
 
 func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) string {
+	if plugin.UsesStorageBackend() {
+		// The storage backends are part of gpbackup_helper, whose version is checked separately
+		return ""
+	}
 	plugin.checkPluginAPIVersion(c)
 
 	return plugin.getPluginNativeVersion(c)
 }
 
-func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
+/*
+ * Checks that the plugin API version is consistent across hosts and at least
+ * RequiredPluginVersion, and returns it so that callers can check support for
+ * commands added in later versions.
+ */
+func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) semver.Version {
 	command := fmt.Sprintf("source %s/greenplum_path.sh && %s plugin_api_version",
 		operating.System.Getenv("GPHOME"), plugin.ExecutablePath)
 	remoteOutput := c.GenerateAndExecuteCommand(
@@ -146,6 +218,41 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 		cluster.LogFatalClusterError("Plugin API version incorrect",
 			cluster.ON_HOSTS_AND_MASTER, numIncorrect)
 	}
+	return version
+}
+
+func (plugin *PluginConfig) checkPluginCommandSupported(c *cluster.Cluster, command string, commandVersion string) error {
+	version := plugin.checkPluginAPIVersion(c)
+	requiredVersion, err := semver.Make(commandVersion)
+	if err != nil {
+		gplog.Fatal(fmt.Errorf("cannot parse hardcoded internal string of required version: %s",
+			err.Error()), commandVersion)
+	}
+	if !version.GE(requiredVersion) {
+		return errors.Errorf("Plugin %s API version %s does not support %s, which requires API version %s",
+			plugin.ExecutablePath, version, command, requiredVersion)
+	}
+	return nil
+}
+
+/*
+ * Checks whether the plugin on the local host supports reading a byte range
+ * of a data file with restore_data_range.  This is called by gprestore and by
+ * gpbackup_helper on each segment host, so it does not go through the cluster.
+ */
+func (plugin *PluginConfig) SupportsRestoreDataRange() (bool, error) {
+	if plugin.UsesStorageBackend() {
+		return true, nil
+	}
+	output, err := exec.Command("bash", "-c", fmt.Sprintf("%s plugin_api_version", plugin.ExecutablePath)).Output()
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to execute plugin %s", plugin.ExecutablePath)
+	}
+	version, err := semver.Make(strings.TrimSpace(string(output)))
+	if err != nil {
+		return false, errors.Wrapf(err, "Unable to parse plugin API version")
+	}
+	return version.GE(semver.MustParse(RestoreDataRangePluginVersion)), nil
 }
 
 func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
@@ -227,6 +334,11 @@ func (plugin *PluginConfig) CleanupPluginForRestore(c *cluster.Cluster, fpInfo f
 func (plugin *PluginConfig) executeHook(c *cluster.Cluster, verboseCommandMsg string,
 	command string, fpInfo filepath.FilePathInfo, noFatal bool) {
 
+	// Storage backends need no setup or cleanup
+	if plugin.UsesStorageBackend() {
+		return
+	}
+
 	// Execute command once on master
 	scope := MASTER
 	_, _ = plugin.buildHookErrorMsgAndFunc(command, scope)
@@ -411,8 +523,8 @@ func (plugin *PluginConfig) BackupSegmentTOCs(c *cluster.Cluster, fpInfo filepat
 	remoteOutput = c.GenerateAndExecuteCommand("Processing segment TOC files with plugin",
 		func(contentID int) string {
 			tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
-			return fmt.Sprintf("source %s/greenplum_path.sh && %s backup_file %s %s && " +
-				"chmod 0755 %s", operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.ConfigPath, tocFile, tocFile)
+			return fmt.Sprintf("source %s/greenplum_path.sh && %s %s && " +
+				"chmod 0755 %s", operating.System.Getenv("GPHOME"), plugin.GetPluginCommand("backup_file"), tocFile, tocFile)
 		}, cluster.ON_SEGMENTS)
 	c.CheckClusterError(remoteOutput, "Unable to process segment TOC files using plugin", func(contentID int) string {
 		return "See gpAdminLog for gpbackup_helper on segment host for details: Error occurred with plugin"
@@ -423,9 +535,9 @@ func (plugin *PluginConfig) RestoreSegmentTOCs(c *cluster.Cluster, fpInfo filepa
 	var command string
 	remoteOutput := c.GenerateAndExecuteCommand("Processing segment TOC files with plugin", func(contentID int) string {
 		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
-		command = fmt.Sprintf("mkdir -p %s && source %s/greenplum_path.sh && %s restore_file %s %s",
+		command = fmt.Sprintf("mkdir -p %s && source %s/greenplum_path.sh && %s %s",
 			fpInfo.GetDirForContent(contentID), operating.System.Getenv("GPHOME"),
-			plugin.ExecutablePath, plugin.ConfigPath, tocFile)
+			plugin.GetPluginCommand("restore_file"), tocFile)
 		return 	command
 	}, cluster.ON_SEGMENTS)
 	gplog.Debug("%s", command)
@@ -434,6 +546,100 @@ func (plugin *PluginConfig) RestoreSegmentTOCs(c *cluster.Cluster, fpInfo filepa
 	})
 }
 
+/*
+ * Returns the timestamps of the backups stored at the plugin destination,
+ * newest first.
+ */
+func (plugin *PluginConfig) ListBackups(c *cluster.Cluster) ([]string, error) {
+	var timestamps []string
+	if plugin.UsesStorageBackend() {
+		backend, err := plugin.GetStorageBackend()
+		if err != nil {
+			return nil, err
+		}
+		names, err := backend.List("backups/")
+		if err != nil {
+			return nil, err
+		}
+		// Backup files are stored as backups/YYYYMMDD/timestamp/filename
+		for _, name := range names {
+			parts := strings.Split(name, "/")
+			if len(parts) == 4 && filepath.IsValidTimestamp(parts[2]) {
+				timestamps = append(timestamps, parts[2])
+			}
+		}
+	} else {
+		err := plugin.checkPluginCommandSupported(c, "list_backups", ListBackupsPluginVersion)
+		if err != nil {
+			return nil, err
+		}
+		command := fmt.Sprintf("source %s/greenplum_path.sh && %s list_backups %s",
+			operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.ConfigPath)
+		gplog.Debug("%s", command)
+		output, err := c.ExecuteLocalCommand(command)
+		if err != nil {
+			return nil, fmt.Errorf("Plugin failed to list backups. %s", output)
+		}
+		timestamps = strings.Fields(output)
+		for _, timestamp := range timestamps {
+			if !filepath.IsValidTimestamp(timestamp) {
+				return nil, errors.Errorf("Plugin returned invalid backup timestamp %s", timestamp)
+			}
+		}
+	}
+
+	uniqueTimestamps := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, timestamp := range timestamps {
+		if !seen[timestamp] {
+			seen[timestamp] = true
+			uniqueTimestamps = append(uniqueTimestamps, timestamp)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(uniqueTimestamps)))
+	return uniqueTimestamps, nil
+}
+
+/*
+ * Deletes all files for the backup with the given timestamp from the plugin
+ * destination.
+ */
+func (plugin *PluginConfig) DeleteBackup(c *cluster.Cluster, timestamp string) error {
+	if plugin.UsesStorageBackend() {
+		backend, err := plugin.GetStorageBackend()
+		if err != nil {
+			return err
+		}
+		names, err := backend.List(fmt.Sprintf("backups/%s/%s/", timestamp[0:8], timestamp))
+		if err != nil {
+			return err
+		}
+		if len(names) == 0 {
+			return errors.Errorf("Backup %s was not found in storage backend %s", timestamp, plugin.Backend)
+		}
+		for _, name := range names {
+			err = backend.DeleteObject(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := plugin.checkPluginCommandSupported(c, "delete_backup", DeleteBackupPluginVersion)
+	if err != nil {
+		return err
+	}
+	command := fmt.Sprintf("source %s/greenplum_path.sh && %s delete_backup %s %s",
+		operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.ConfigPath, timestamp)
+	gplog.Debug("%s", command)
+	output, err := c.ExecuteLocalCommand(command)
+	if err != nil {
+		return fmt.Errorf("Plugin failed to delete backup %s. %s", timestamp, output)
+	}
+	return nil
+}
+
 func (plugin *PluginConfig) UsesEncryption() bool {
 	return plugin.Options["password_encryption"] == "on" ||
 		(plugin.Options["replication"] == "on" && plugin.Options["remote_password_encryption"] == "on")
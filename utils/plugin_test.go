@@ -349,5 +349,121 @@ options:
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("executablepath is required in config file"))
 		})
+		It("reads a config that uses a storage backend instead of an executable", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(fmt.Sprintf("backend: local\noptions:\n  directory: %s\n", tempDir)), nil
+			}
+
+			config, err := utils.ReadPluginConfig("/home/gpadmin/myconfigpath")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.UsesStorageBackend()).To(BeTrue())
+			Expect(config.ConfigPath).To(Equal("/tmp/myconfigpath"))
+		})
+		It("returns an error if both executablepath and backend are specified", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte("executablepath: /a/b/myPlugin\nbackend: local\n"), nil
+			}
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("executablepath and backend cannot both be specified in config file"))
+		})
+		It("returns an error if the storage backend options are invalid", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) { return []byte("backend: s3\n"), nil }
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("The bucket option is required for the s3 storage backend"))
+		})
+	})
+	Describe("GetPluginCommand", func() {
+		It("returns the plugin executable command", func() {
+			Expect(subject.GetPluginCommand("backup_data")).To(Equal("/a/b/myPlugin backup_data /tmp/my_plugin_config.yaml"))
+		})
+		It("runs storage backend commands through gpbackup_helper", func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/greenplum-db" }
+			subject.ExecutablePath = ""
+			subject.Backend = "local"
+
+			Expect(subject.GetPluginCommand("restore_data")).To(Equal("/usr/local/greenplum-db/bin/gpbackup_helper --plugin-config /tmp/my_plugin_config.yaml --storage-command restore_data --data-file"))
+		})
+	})
+	Describe("ListBackups and DeleteBackup", func() {
+		setAPIVersion := func(version string) {
+			executor.ClusterOutputs[0] = &cluster.RemoteOutput{
+				Stdouts: map[int]string{-1: version, 0: version, 1: version},
+			}
+		}
+		BeforeEach(func() {
+			operating.System.Getenv = func(key string) string { return "/usr/local/greenplum-db" }
+		})
+		It("lists the unique backup timestamps returned by the plugin, newest first", func() {
+			setAPIVersion(utils.ListBackupsPluginVersion)
+			executor.LocalOutput = "20200101010101\n20200102010101\n20200101010101\n"
+
+			timestamps, err := subject.ListBackups(testCluster)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamps).To(Equal([]string{"20200102010101", "20200101010101"}))
+			Expect(executor.LocalCommands).To(Equal([]string{"source /usr/local/greenplum-db/greenplum_path.sh && /a/b/myPlugin list_backups /tmp/my_plugin_config.yaml"}))
+		})
+		It("returns an error if the plugin returns an invalid timestamp", func() {
+			setAPIVersion(utils.ListBackupsPluginVersion)
+			executor.LocalOutput = "20200101010101\nfoo\n"
+
+			_, err := subject.ListBackups(testCluster)
+			Expect(err).To(MatchError("Plugin returned invalid backup timestamp foo"))
+		})
+		It("returns an error if the plugin API version does not support list_backups", func() {
+			setAPIVersion(utils.DeleteBackupPluginVersion)
+
+			_, err := subject.ListBackups(testCluster)
+			Expect(err).To(MatchError("Plugin /a/b/myPlugin API version 0.4.0 does not support list_backups, which requires API version 0.5.0"))
+			Expect(executor.NumLocalExecutions).To(Equal(0))
+		})
+		It("deletes a backup using the plugin", func() {
+			setAPIVersion(utils.DeleteBackupPluginVersion)
+
+			Expect(subject.DeleteBackup(testCluster, "20200101010101")).To(Succeed())
+			Expect(executor.LocalCommands).To(Equal([]string{"source /usr/local/greenplum-db/greenplum_path.sh && /a/b/myPlugin delete_backup /tmp/my_plugin_config.yaml 20200101010101"}))
+		})
+		It("returns an error if the plugin API version does not support delete_backup", func() {
+			err := subject.DeleteBackup(testCluster, "20200101010101")
+			Expect(err).To(MatchError("Plugin /a/b/myPlugin API version 0.3.0 does not support delete_backup, which requires API version 0.4.0"))
+		})
+		It("lists and deletes backups in a storage backend", func() {
+			subject.ExecutablePath = ""
+			subject.Backend = "local"
+			subject.Options["directory"] = tempDir
+			for _, filename := range []string{
+				"backups/20200101/20200101010101/gpbackup_20200101010101_config.yaml",
+				"backups/20200101/20200101010101/gpbackup_0_20200101010101_16384.gz",
+				"backups/20200102/20200102010101/gpbackup_20200102010101_config.yaml",
+				"gpbackup_history.yaml",
+			} {
+				Expect(os.MkdirAll(filepath.Dir(filepath.Join(tempDir, filename)), 0755)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(tempDir, filename), []byte{}, 0644)).To(Succeed())
+			}
+
+			Expect(subject.ListBackups(testCluster)).To(Equal([]string{"20200102010101", "20200101010101"}))
+			Expect(subject.DeleteBackup(testCluster, "20200101010101")).To(Succeed())
+			Expect(subject.ListBackups(testCluster)).To(Equal([]string{"20200102010101"}))
+
+			err := subject.DeleteBackup(testCluster, "20200101010101")
+			Expect(err).To(MatchError("Backup 20200101010101 was not found in storage backend local"))
+			Expect(executor.NumRemoteExecutions).To(Equal(0))
+		})
+	})
+	Describe("BackupFile", func() {
+		It("stores the file using the storage backend", func() {
+			subject.ExecutablePath = ""
+			subject.Backend = "local"
+			subject.Options["directory"] = filepath.Join(tempDir, "storage")
+			backupFile := filepath.Join(tempDir, "backups", "20200101", "20200101010101", "gpbackup_20200101010101_config.yaml")
+			Expect(os.MkdirAll(filepath.Dir(backupFile), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(backupFile, []byte("config"), 0644)).To(Succeed())
+
+			Expect(subject.BackupFile(backupFile)).To(Succeed())
+
+			Expect(ioutil.ReadFile(filepath.Join(tempDir, "storage", "backups", "20200101", "20200101010101", "gpbackup_20200101010101_config.yaml"))).To(Equal([]byte("config")))
+		})
 	})
 })
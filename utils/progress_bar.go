@@ -53,6 +53,7 @@ type ProgressBar interface {
 	Finish()
 	Increment() int
 	Add(int) int
+	Postfix(string) *pb.ProgressBar
 }
 
 type VerboseProgressBar struct {
@@ -0,0 +1,343 @@
+package utils
+
+/*
+ * This file contains structs and functions related to limiting the rate at
+ * which data files are read and written, and the I/O priority with which it
+ * is done, so that backups and restores do not saturate shared storage.
+ */
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/storage"
+	"github.com/pkg/errors"
+	"gopkg.in/cheggaaa/pb.v1"
+)
+
+var (
+	dataThrottle = DataThrottle{IONiceLevel: -1}
+	dataTransfer DataTransfer
+)
+
+/*
+ * BytesPerSecond is the rate limit for each segment, or 0 for no limit, and
+ * IONiceLevel is the best-effort I/O scheduling priority, from 0 to 7, for
+ * the processes that read and write data files, or -1 to leave it unchanged.
+ */
+type DataThrottle struct {
+	BytesPerSecond int64
+	IONiceLevel    int
+}
+
+/*
+ * NumBytes is the data moved on all segments by a throttled backup or restore
+ * and Elapsed is the time taken to move it, from which the rate achieved under
+ * the limit is reported.
+ */
+type DataTransfer struct {
+	NumBytes    int64
+	NumSegments int
+	Elapsed     time.Duration
+}
+
+/*
+ * Sets the limit for each segment from --max-bandwidth and
+ * --max-bandwidth-per-host, which are given as sizes such as 100MB, and the
+ * I/O nice level.
+ */
+func InitializeDataThrottle(c *cluster.Cluster, maxBandwidth string, maxBandwidthPerHost string, ioNiceLevel int) error {
+	clusterBytesPerSecond, err := ParseBandwidth(maxBandwidth)
+	if err != nil {
+		return err
+	}
+	hostBytesPerSecond, err := ParseBandwidth(maxBandwidthPerHost)
+	if err != nil {
+		return err
+	}
+	dataThrottle = DataThrottle{BytesPerSecond: GetSegmentBandwidthLimit(c, clusterBytesPerSecond, hostBytesPerSecond), IONiceLevel: ioNiceLevel}
+	if dataThrottle.BytesPerSecond > 0 {
+		gplog.Verbose("Limiting data file I/O to %s", dataThrottle.String())
+	}
+	return nil
+}
+
+func GetDataThrottle() DataThrottle {
+	return dataThrottle
+}
+
+func SetDataThrottle(throttle DataThrottle) {
+	dataThrottle = throttle
+}
+
+func GetDataTransfer() DataTransfer {
+	return dataTransfer
+}
+
+func SetDataTransfer(transfer DataTransfer) {
+	dataTransfer = transfer
+}
+
+/*
+ * Parses a bandwidth such as 100MB, meaning 100MB per second, or returns 0 if
+ * no bandwidth is given.
+ */
+func ParseBandwidth(bandwidth string) (int64, error) {
+	if bandwidth == "" {
+		return 0, nil
+	}
+	bytesPerSecond, err := storage.ParseByteSize(bandwidth)
+	if err != nil || bytesPerSecond <= 0 {
+		return 0, errors.Errorf("Invalid bandwidth %s.  Bandwidth must be a positive size, such as 500KB, 100MB, or 1GB.", bandwidth)
+	}
+	return bytesPerSecond, nil
+}
+
+func ValidateIONiceLevel(ioNiceLevel int) error {
+	if ioNiceLevel < -1 || ioNiceLevel > 7 {
+		return errors.Errorf("I/O nice level must be between 0 and 7")
+	}
+	return nil
+}
+
+/*
+ * Every segment is given the same limit, so that data is distributed evenly
+ * across segments: the smaller of an equal share of the limit for the whole
+ * cluster and an equal share of the limit for the host with the most segments.
+ * A limit of 0 means no limit.
+ */
+func GetSegmentBandwidthLimit(c *cluster.Cluster, maxBandwidth int64, maxBandwidthPerHost int64) int64 {
+	numSegments := 0
+	segmentsPerHost := make(map[string]int)
+	maxSegmentsPerHost := 0
+	for _, contentID := range c.GetContentList() {
+		if contentID == -1 {
+			continue
+		}
+		numSegments++
+		host := c.GetHostForContent(contentID)
+		segmentsPerHost[host]++
+		if segmentsPerHost[host] > maxSegmentsPerHost {
+			maxSegmentsPerHost = segmentsPerHost[host]
+		}
+	}
+	limit := int64(0)
+	if maxBandwidth > 0 && numSegments > 0 {
+		limit = maxBandwidth / int64(numSegments)
+	}
+	if maxBandwidthPerHost > 0 && maxSegmentsPerHost > 0 {
+		hostLimit := maxBandwidthPerHost / int64(maxSegmentsPerHost)
+		if limit == 0 || hostLimit < limit {
+			limit = hostLimit
+		}
+	}
+	if (maxBandwidth > 0 || maxBandwidthPerHost > 0) && limit == 0 {
+		// Never round a limit down to no limit at all
+		limit = 1
+	}
+	return limit
+}
+
+func (throttle DataThrottle) String() string {
+	if throttle.BytesPerSecond == 0 {
+		return "None"
+	}
+	return fmt.Sprintf("%s/s per segment", pb.Format(throttle.BytesPerSecond).To(pb.U_BYTES).String())
+}
+
+/*
+ * Returns the flags that pass the rate limit to gpbackup_helper, which
+ * enforces it for all of the data files on its segment.
+ */
+func (throttle DataThrottle) GetHelperFlags() string {
+	if throttle.BytesPerSecond == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" --max-bandwidth %d", throttle.BytesPerSecond)
+}
+
+/*
+ * Returns a shell command that sets the I/O priority of the shell running it,
+ * and so of every command that it runs afterward.  Failing to set the priority,
+ * such as when ionice is not installed, is not an error.
+ */
+func (throttle DataThrottle) GetIONiceCommand() string {
+	if throttle.IONiceLevel < 0 {
+		return ""
+	}
+	return fmt.Sprintf("ionice -c 2 -n %d -p $$ > /dev/null 2>&1; ", throttle.IONiceLevel)
+}
+
+/*
+ * Returns a command to add to a COPY PROGRAM pipeline that limits the rate at
+ * which data passes through it and appends the number of bytes that passed
+ * through it to byteCountFile.  Each segment runs one pipeline per connection
+ * at the same time, so the segment's limit is divided among them.
+ */
+func (throttle DataThrottle) GetThrottleCommand(numConns int, byteCountFile string) string {
+	if throttle.BytesPerSecond == 0 {
+		return ""
+	}
+	bytesPerSecond := throttle.BytesPerSecond / int64(numConns)
+	if bytesPerSecond == 0 {
+		bytesPerSecond = 1
+	}
+	return fmt.Sprintf(" | %s/bin/gpbackup_helper --throttle --max-bandwidth %d --byte-count-file %s", operating.System.Getenv("GPHOME"), bytesPerSecond, byteCountFile)
+}
+
+/*
+ * Without a gpbackup_helper agent to throttle it, the data of a
+ * multiple-data-file backup or restore is throttled in its COPY PROGRAM
+ * pipeline.  Returns the command that sets the I/O priority of the pipeline
+ * and the command that limits its rate, either of which may be empty.
+ */
+func GetPipelineThrottleCommands(numConns int, fpInfo filepath.FilePathInfo) (string, string) {
+	byteCountFile := fpInfo.GetSegmentHelperFilePathForCopyCommand("bytes")
+	return dataThrottle.GetIONiceCommand(), dataThrottle.GetThrottleCommand(numConns, byteCountFile)
+}
+
+/*
+ * Returns the number of bytes that passed through the throttled COPY PROGRAM
+ * pipelines on each segment, and removes the files in which they were counted.
+ */
+func ReadPipelineByteCountsOnSegments(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]int64 {
+	remoteOutput := c.GenerateAndExecuteCommand("Reading data pipeline byte counts", func(contentID int) string {
+		byteCountFile := fpInfo.GetSegmentHelperFilePath(contentID, "bytes")
+		return fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; rm -f %[1]s; fi", byteCountFile)
+	}, cluster.ON_SEGMENTS)
+	byteCounts := make(map[int]int64)
+	for contentID, stdout := range remoteOutput.Stdouts {
+		if remoteOutput.Errors[contentID] != nil {
+			continue
+		}
+		for _, line := range strings.Fields(stdout) {
+			numBytes, err := strconv.ParseInt(line, 10, 64)
+			if err != nil {
+				gplog.Debug("Could not parse data pipeline byte count on segment %d: %v", contentID, err)
+				continue
+			}
+			byteCounts[contentID] += numBytes
+		}
+	}
+	return byteCounts
+}
+
+/*
+ * Adds the data moved by a throttled backup or restore within the elapsed time
+ * to the data transfer, as reported by the gpbackup_helper agents or, without
+ * agents, by the pipelines that throttled each COPY.  Nothing is recorded when
+ * there is no limit, as the pipelines then do not count their bytes.
+ */
+func RecordThrottledDataTransfer(c *cluster.Cluster, fpInfo filepath.FilePathInfo, usesHelperAgents bool, elapsed time.Duration) {
+	if dataThrottle.BytesPerSecond == 0 {
+		return
+	}
+	if usesHelperAgents {
+		for _, status := range ReadHelperStatusesOnSegments(c, fpInfo) {
+			dataTransfer.NumBytes += int64(status.BytesProcessed)
+		}
+	} else {
+		for _, numBytes := range ReadPipelineByteCountsOnSegments(c, fpInfo) {
+			dataTransfer.NumBytes += numBytes
+		}
+	}
+	dataTransfer.NumSegments = 0
+	for _, contentID := range c.GetContentList() {
+		if contentID != -1 {
+			dataTransfer.NumSegments++
+		}
+	}
+	dataTransfer.Elapsed += elapsed
+}
+
+/*
+ * Returns the average rate at which each segment moved data, to compare with
+ * the limit for each segment, or an empty string if no data was recorded.
+ */
+func (transfer DataTransfer) String() string {
+	if transfer.NumSegments == 0 || transfer.Elapsed <= 0 {
+		return ""
+	}
+	bytesPerSecond := float64(transfer.NumBytes) / float64(transfer.NumSegments) / transfer.Elapsed.Seconds()
+	return fmt.Sprintf("%s/s per segment", pb.Format(int64(bytesPerSecond)).To(pb.U_BYTES).String())
+}
+
+/*
+ * A RateLimiter delays the callers of Wait so that, together, they process no
+ * more than the given number of bytes per second.  It is safe for concurrent
+ * use, so that several readers and writers can share a single limit.
+ */
+type RateLimiter struct {
+	bytesPerSecond int64
+	nextTime       time.Time
+	mutex          sync.Mutex
+}
+
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	return &RateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+/*
+ * Returns how long the caller must wait after processing the given number of
+ * bytes at the given time.  Time that passes without any bytes being processed
+ * is not saved up to allow a burst later.
+ */
+func (limiter *RateLimiter) Reserve(numBytes int, now time.Time) time.Duration {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	if limiter.nextTime.Before(now) {
+		limiter.nextTime = now
+	}
+	limiter.nextTime = limiter.nextTime.Add(time.Duration(float64(numBytes) / float64(limiter.bytesPerSecond) * float64(time.Second)))
+	return limiter.nextTime.Sub(now)
+}
+
+func (limiter *RateLimiter) Wait(numBytes int) {
+	time.Sleep(limiter.Reserve(numBytes, time.Now()))
+}
+
+type throttledWriter struct {
+	writer  io.Writer
+	limiter *RateLimiter
+}
+
+func (throttled *throttledWriter) Write(p []byte) (int, error) {
+	n, err := throttled.writer.Write(p)
+	throttled.limiter.Wait(n)
+	return n, err
+}
+
+type throttledReader struct {
+	reader  io.Reader
+	limiter *RateLimiter
+}
+
+func (throttled *throttledReader) Read(p []byte) (int, error) {
+	n, err := throttled.reader.Read(p)
+	throttled.limiter.Wait(n)
+	return n, err
+}
+
+// If the limiter is nil, the writer is returned unchanged
+func NewThrottledWriter(writer io.Writer, limiter *RateLimiter) io.Writer {
+	if limiter == nil {
+		return writer
+	}
+	return &throttledWriter{writer: writer, limiter: limiter}
+}
+
+// If the limiter is nil, the reader is returned unchanged
+func NewThrottledReader(reader io.Reader, limiter *RateLimiter) io.Reader {
+	if limiter == nil {
+		return reader
+	}
+	return &throttledReader{reader: reader, limiter: limiter}
+}
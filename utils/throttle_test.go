@@ -0,0 +1,187 @@
+package utils_test
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/throttle tests", func() {
+	Describe("GetSegmentBandwidthLimit", func() {
+		var testCluster *cluster.Cluster
+		BeforeEach(func() {
+			testCluster = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "sdw1", DataDir: "/data/gpseg0"},
+				{ContentID: 1, Hostname: "sdw1", DataDir: "/data/gpseg1"},
+				{ContentID: 2, Hostname: "sdw1", DataDir: "/data/gpseg2"},
+				{ContentID: 3, Hostname: "sdw2", DataDir: "/data/gpseg3"},
+			})
+		})
+		It("returns no limit when neither bandwidth is given", func() {
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 0, 0)).To(Equal(int64(0)))
+		})
+		It("divides the cluster bandwidth among all segments", func() {
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 400, 0)).To(Equal(int64(100)))
+		})
+		It("divides the host bandwidth among the segments on the host with the most segments", func() {
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 0, 300)).To(Equal(int64(100)))
+		})
+		It("uses the lower of the two limits when both bandwidths are given", func() {
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 800, 300)).To(Equal(int64(100)))
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 200, 3000)).To(Equal(int64(50)))
+		})
+		It("does not round a small limit down to no limit", func() {
+			Expect(utils.GetSegmentBandwidthLimit(testCluster, 2, 0)).To(Equal(int64(1)))
+		})
+	})
+	Describe("ParseBandwidth", func() {
+		It("parses a bandwidth with units", func() {
+			Expect(utils.ParseBandwidth("100MB")).To(Equal(int64(100 * 1024 * 1024)))
+		})
+		It("returns no limit for an empty bandwidth", func() {
+			Expect(utils.ParseBandwidth("")).To(Equal(int64(0)))
+		})
+		It("returns an error for a bandwidth that is not a positive size", func() {
+			_, err := utils.ParseBandwidth("0MB")
+			Expect(err).To(MatchError("Invalid bandwidth 0MB.  Bandwidth must be a positive size, such as 500KB, 100MB, or 1GB."))
+			_, err = utils.ParseBandwidth("fast")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("ValidateIONiceLevel", func() {
+		It("accepts levels between 0 and 7, and -1 for no level", func() {
+			Expect(utils.ValidateIONiceLevel(-1)).To(Succeed())
+			Expect(utils.ValidateIONiceLevel(0)).To(Succeed())
+			Expect(utils.ValidateIONiceLevel(7)).To(Succeed())
+		})
+		It("rejects levels outside that range", func() {
+			Expect(utils.ValidateIONiceLevel(8)).To(MatchError("I/O nice level must be between 0 and 7"))
+			Expect(utils.ValidateIONiceLevel(-2)).To(HaveOccurred())
+		})
+	})
+	Describe("DataThrottle", func() {
+		It("returns no commands or flags when there is no limit or level", func() {
+			throttle := utils.DataThrottle{IONiceLevel: -1}
+			Expect(throttle.String()).To(Equal("None"))
+			Expect(throttle.GetHelperFlags()).To(Equal(""))
+			Expect(throttle.GetIONiceCommand()).To(Equal(""))
+			Expect(throttle.GetThrottleCommand(4, "/data/gpseg0/bytes")).To(Equal(""))
+		})
+		It("divides the segment limit among the connections in the pipeline", func() {
+			throttle := utils.DataThrottle{BytesPerSecond: 4 * 1024 * 1024}
+			Expect(throttle.String()).To(Equal("4.00 MiB/s per segment"))
+			Expect(throttle.GetHelperFlags()).To(Equal(" --max-bandwidth 4194304"))
+			Expect(throttle.GetThrottleCommand(4, "/data/gpseg0/bytes")).To(HaveSuffix("/bin/gpbackup_helper --throttle --max-bandwidth 1048576 --byte-count-file /data/gpseg0/bytes"))
+		})
+	})
+	Describe("data transfer", func() {
+		var (
+			fpInfo       filepath.FilePathInfo
+			testCluster  *cluster.Cluster
+			testExecutor *testhelper.TestExecutor
+		)
+		BeforeEach(func() {
+			testExecutor = &testhelper.TestExecutor{ClusterOutput: &cluster.RemoteOutput{}}
+			testCluster = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, Hostname: "localhost", DataDir: "/data/gpseg-1"},
+				{ContentID: 0, Hostname: "sdw1", DataDir: "/data/gpseg0"},
+				{ContentID: 1, Hostname: "sdw2", DataDir: "/data/gpseg1"},
+			})
+			testCluster.Executor = testExecutor
+			fpInfo = filepath.NewFilePathInfo(testCluster, "", "20170101010101", "")
+			fpInfo.PID = 1234
+		})
+		AfterEach(func() {
+			utils.SetDataThrottle(utils.DataThrottle{IONiceLevel: -1})
+			utils.SetDataTransfer(utils.DataTransfer{})
+		})
+		It("initializes the throttle with the limit for each segment", func() {
+			Expect(utils.InitializeDataThrottle(testCluster, "4MB", "", 7)).To(Succeed())
+			Expect(utils.GetDataThrottle()).To(Equal(utils.DataThrottle{BytesPerSecond: 2 * 1024 * 1024, IONiceLevel: 7}))
+		})
+		It("returns an error for an invalid bandwidth", func() {
+			Expect(utils.InitializeDataThrottle(testCluster, "", "fast", -1)).To(HaveOccurred())
+		})
+		It("counts the bytes in each pipeline in a file on its segment", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: 7})
+			ioNiceCommand, throttleCommand := utils.GetPipelineThrottleCommands(2, fpInfo)
+			Expect(ioNiceCommand).To(Equal("ionice -c 2 -n 7 -p $$ > /dev/null 2>&1; "))
+			Expect(throttleCommand).To(HaveSuffix("--max-bandwidth 524288 --byte-count-file <SEG_DATA_DIR>/gpbackup_<SEGID>_20170101010101_bytes_1234"))
+		})
+		It("sums the byte counts of the pipelines on each segment and removes them", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{0: "100\n200\n", 1: "300\nnot a count\n", 2: "400\n"},
+				Errors:  map[int]error{2: errors.New("exit status 1")},
+			}
+
+			byteCounts := utils.ReadPipelineByteCountsOnSegments(testCluster, fpInfo)
+
+			Expect(byteCounts).To(Equal(map[int]int64{0: 300, 1: 300}))
+			Expect(testExecutor.ClusterCommands[0][0][4]).To(Equal("if [[ -f /data/gpseg0/gpbackup_0_20170101010101_bytes_1234 ]]; then cat /data/gpseg0/gpbackup_0_20170101010101_bytes_1234; rm -f /data/gpseg0/gpbackup_0_20170101010101_bytes_1234; fi"))
+		})
+		It("does not record the data transfer without a limit", func() {
+			utils.RecordThrottledDataTransfer(testCluster, fpInfo, false, time.Second)
+
+			Expect(testExecutor.NumExecutions).To(Equal(0))
+			Expect(utils.GetDataTransfer().String()).To(Equal(""))
+		})
+		It("records the data moved through the pipelines and reports the rate for each segment", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{0: "1048576\n", 1: "1048576\n1048576\n"},
+				Errors:  map[int]error{},
+			}
+
+			utils.RecordThrottledDataTransfer(testCluster, fpInfo, false, 2*time.Second)
+			utils.RecordThrottledDataTransfer(testCluster, fpInfo, false, time.Second)
+
+			Expect(utils.GetDataTransfer()).To(Equal(utils.DataTransfer{NumBytes: 6 * 1048576, NumSegments: 2, Elapsed: 3 * time.Second}))
+			Expect(utils.GetDataTransfer().String()).To(Equal("1.00 MiB/s per segment"))
+		})
+		It("records the data moved by the helper agents", func() {
+			utils.SetDataThrottle(utils.DataThrottle{BytesPerSecond: 1048576, IONiceLevel: -1})
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{
+				Stdouts: map[int]string{0: "bytesprocessed: 1048576\n", 1: "bytesprocessed: 3145728\n"},
+				Errors:  map[int]error{},
+			}
+
+			utils.RecordThrottledDataTransfer(testCluster, fpInfo, true, 4*time.Second)
+
+			Expect(utils.GetDataTransfer().String()).To(Equal("512.00 KiB/s per segment"))
+		})
+	})
+	Describe("RateLimiter", func() {
+		It("delays callers in proportion to the number of bytes processed", func() {
+			limiter := utils.NewRateLimiter(1000)
+			now := time.Now()
+			Expect(limiter.Reserve(500, now)).To(Equal(500 * time.Millisecond))
+			Expect(limiter.Reserve(500, now)).To(Equal(time.Second))
+		})
+		It("does not allow a burst after a period without data", func() {
+			limiter := utils.NewRateLimiter(1000)
+			now := time.Now()
+			limiter.Reserve(500, now)
+			Expect(limiter.Reserve(500, now.Add(time.Minute))).To(Equal(500 * time.Millisecond))
+		})
+		It("writes all data through a throttled writer", func() {
+			buffer := &bytes.Buffer{}
+			writer := utils.NewThrottledWriter(buffer, utils.NewRateLimiter(1<<30))
+			_, err := writer.Write([]byte("data"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(buffer.String()).To(Equal("data"))
+		})
+		It("returns the writer unchanged when there is no limiter", func() {
+			buffer := &bytes.Buffer{}
+			Expect(utils.NewThrottledWriter(buffer, nil)).To(BeIdenticalTo(buffer))
+		})
+	})
+})